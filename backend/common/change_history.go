@@ -0,0 +1,348 @@
+package common
+
+import (
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/util"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tables whose changes are recorded, by entity type
+var changeHistoryEntities = map[string]string{
+	"users": "user",
+	"roles": "role",
+	"menus": "menu",
+	"apis":  "api",
+}
+
+// Columns that change with every update and are left out of the diffs
+var changeHistoryIgnoredColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+const changeHistoryBeforeKey = "change_history:before"
+
+// Record the changes of users, roles, menus and apis made through gorm.
+// Changes are made by the user of the request when the database is used with the request as its context.
+func registerChangeHistory(db *gorm.DB) {
+	db.Callback().Create().After("gorm:create").Register("change_history:after_create", changeHistoryAfterCreate)
+	db.Callback().Update().Before("gorm:update").Register("change_history:before_update", func(db *gorm.DB) {
+		changeHistoryBefore(db, false)
+	})
+	db.Callback().Update().After("gorm:update").Register("change_history:after_update", changeHistoryAfterUpdate)
+	db.Callback().Delete().Before("gorm:delete").Register("change_history:before_delete", func(db *gorm.DB) {
+		changeHistoryBefore(db, true)
+	})
+	db.Callback().Delete().After("gorm:delete").Register("change_history:after_delete", changeHistoryAfterDelete)
+}
+
+// Record a change that is not made to the columns of an entity, e.g. the permissions of a role
+func RecordChange(db *gorm.DB, entityType string, entityId uint, action string, changes []model.FieldChange) {
+	if len(changes) == 0 {
+		return
+	}
+	saveChangeLogs(db, []model.ChangeLog{newChangeLog(db, entityType, entityId, action, changes)})
+}
+
+// Change of a list field like the menus of a role, nothing when the lists have the same items
+func ListChanges(field string, before []string, after []string) []model.FieldChange {
+	before = append([]string{}, before...)
+	after = append([]string{}, after...)
+	sort.Strings(before)
+	sort.Strings(after)
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	return []model.FieldChange{{Field: field, Before: before, After: after}}
+}
+
+func changeHistoryEntity(db *gorm.DB) (string, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return "", false
+	}
+	entityType, ok := changeHistoryEntities[db.Statement.Schema.Table]
+	return entityType, ok
+}
+
+// Keep the rows an update or delete is going to change
+func changeHistoryBefore(db *gorm.DB, isDelete bool) {
+	if _, ok := changeHistoryEntity(db); !ok {
+		return
+	}
+	conditions := changeHistoryConditions(db, isDelete)
+	if len(conditions) == 0 {
+		return
+	}
+	rows, err := loadChangeRows(db, conditions)
+	if err != nil {
+		Log.Errorf("Failed to get records before the change: %v", err)
+		return
+	}
+	db.InstanceSet(changeHistoryBeforeKey, rows)
+}
+
+func changeHistoryAfterCreate(db *gorm.DB) {
+	entityType, ok := changeHistoryEntity(db)
+	if !ok {
+		return
+	}
+	// Associations are saved by creating them unless they exist, which does not change existing records
+	if _, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+		return
+	}
+	ids := changeHistoryPrimaryKeys(db)
+	if len(ids) == 0 {
+		return
+	}
+	rows, err := loadChangeRows(db, []clause.Expression{clause.IN{Column: clause.PrimaryColumn, Values: ids}})
+	if err != nil {
+		Log.Errorf("Failed to get created records: %v", err)
+		return
+	}
+	logs := make([]model.ChangeLog, 0, len(rows))
+	for _, row := range rows {
+		logs = append(logs, newChangeLog(db, entityType, rowId(row), "create", diffChangeRows(db, nil, row)))
+	}
+	saveChangeLogs(db, logs)
+}
+
+func changeHistoryAfterUpdate(db *gorm.DB) {
+	entityType, ok := changeHistoryEntity(db)
+	if !ok {
+		return
+	}
+	before := changeHistoryBeforeRows(db)
+	if len(before) == 0 {
+		return
+	}
+	// The rows are looked up again by their ids, the update may have changed the columns they were found by
+	ids := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row["id"])
+	}
+	rows, err := loadChangeRows(db, []clause.Expression{clause.IN{Column: clause.PrimaryColumn, Values: ids}})
+	if err != nil {
+		Log.Errorf("Failed to get updated records: %v", err)
+		return
+	}
+	after := make(map[uint]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		after[rowId(row)] = row
+	}
+	logs := make([]model.ChangeLog, 0, len(before))
+	for _, row := range before {
+		id := rowId(row)
+		changes := diffChangeRows(db, row, after[id])
+		if len(changes) == 0 {
+			continue
+		}
+		action := "update"
+		// Records are restored from the recycle bin by clearing their deletion time
+		if row["deleted_at"] != nil && after[id] != nil && after[id]["deleted_at"] == nil {
+			action = "restore"
+		}
+		logs = append(logs, newChangeLog(db, entityType, id, action, changes))
+	}
+	saveChangeLogs(db, logs)
+}
+
+func changeHistoryAfterDelete(db *gorm.DB) {
+	entityType, ok := changeHistoryEntity(db)
+	if !ok {
+		return
+	}
+	// Soft-deleted records are purged by deleting them unscoped
+	action := "delete"
+	if db.Statement.Unscoped {
+		action = "purge"
+	}
+	before := changeHistoryBeforeRows(db)
+	logs := make([]model.ChangeLog, 0, len(before))
+	for _, row := range before {
+		logs = append(logs, newChangeLog(db, entityType, rowId(row), action, diffChangeRows(db, row, nil)))
+	}
+	saveChangeLogs(db, logs)
+}
+
+func changeHistoryBeforeRows(db *gorm.DB) []map[string]interface{} {
+	if db.Error != nil {
+		return nil
+	}
+	value, ok := db.InstanceGet(changeHistoryBeforeKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := value.([]map[string]interface{})
+	return rows
+}
+
+// Conditions of the statement, including the primary keys of the model it was called with, as gorm adds them itself
+func changeHistoryConditions(db *gorm.DB, isDelete bool) []clause.Expression {
+	stmt := db.Statement
+	conditions := make([]clause.Expression, 0)
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			conditions = append(conditions, where.Exprs...)
+		}
+	}
+	if ids := changeHistoryPrimaryKeys(db); len(ids) > 0 {
+		conditions = append(conditions, clause.IN{Column: clause.PrimaryColumn, Values: ids})
+	}
+	// Without conditions gorm refuses the statement
+	if len(conditions) == 0 {
+		return conditions
+	}
+	// Soft deletes only change the records that are not deleted yet
+	if isDelete && !stmt.Unscoped && stmt.Schema.LookUpField("DeletedAt") != nil {
+		conditions = append(conditions, clause.Eq{Column: clause.Column{Name: "deleted_at"}, Value: nil})
+	}
+	return conditions
+}
+
+// Non-zero primary keys of the model or the created records
+func changeHistoryPrimaryKeys(db *gorm.DB) []interface{} {
+	stmt := db.Statement
+	field := stmt.Schema.PrioritizedPrimaryField
+	if field == nil || !stmt.ReflectValue.IsValid() {
+		return nil
+	}
+	ids := make([]interface{}, 0)
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			if id, zero := field.ValueOf(reflect.Indirect(stmt.ReflectValue.Index(i))); !zero {
+				ids = append(ids, id)
+			}
+		}
+	case reflect.Struct:
+		if id, zero := field.ValueOf(stmt.ReflectValue); !zero {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Rows of the statement's table including soft-deleted ones, in the statement's transaction
+func loadChangeRows(db *gorm.DB, conditions []clause.Expression) ([]map[string]interface{}, error) {
+	rows := make([]map[string]interface{}, 0)
+	entity := reflect.New(db.Statement.Schema.ModelType).Interface()
+	err := db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(entity).Clauses(clause.Where{Exprs: conditions}).Find(&rows).Error
+	return rows, err
+}
+
+func rowId(row map[string]interface{}) uint {
+	var id uint
+	fmt.Sscan(changeValue(row["id"]), &id)
+	return id
+}
+
+// Fields whose values differ, sensitive fields are masked.
+// A nil row is a record that did not exist, its fields are left out.
+func diffChangeRows(db *gorm.DB, before map[string]interface{}, after map[string]interface{}) []model.FieldChange {
+	columns := make([]string, 0)
+	for column := range before {
+		columns = append(columns, column)
+	}
+	for column := range after {
+		if _, ok := before[column]; !ok {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+
+	changes := make([]model.FieldChange, 0)
+	for _, column := range columns {
+		if changeHistoryIgnoredColumns[column] {
+			continue
+		}
+		var beforeValue, afterValue interface{}
+		if before != nil {
+			if v := before[column]; v != nil {
+				beforeValue = changeValue(v)
+			}
+		}
+		if after != nil {
+			if v := after[column]; v != nil {
+				afterValue = changeValue(v)
+			}
+		}
+		if beforeValue == afterValue {
+			continue
+		}
+		name := column
+		if field, ok := db.Statement.Schema.FieldsByDBName[column]; ok {
+			name = field.Name
+			if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+				name = tag
+			}
+		}
+		if isSensitiveField(name) || isSensitiveField(column) {
+			if beforeValue != nil {
+				beforeValue = util.RedactedValue
+			}
+			if afterValue != nil {
+				afterValue = util.RedactedValue
+			}
+		}
+		changes = append(changes, model.FieldChange{Field: name, Before: beforeValue, After: afterValue})
+	}
+	return changes
+}
+
+// Column values are compared as text, the driver returns the same value as different types depending on the protocol
+func changeValue(v interface{}) string {
+	switch value := v.(type) {
+	case []byte:
+		return string(value)
+	case time.Time:
+		return value.Format("2006-01-02 15:04:05.000")
+	case *time.Time:
+		return value.Format("2006-01-02 15:04:05.000")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func isSensitiveField(name string) bool {
+	for _, field := range config.Conf.OperationLog.RedactFields {
+		if strings.EqualFold(field, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// The actor is the user of the request the database is used with, the impersonator is the real user behind an impersonation
+func newChangeLog(db *gorm.DB, entityType string, entityId uint, action string, changes []model.FieldChange) model.ChangeLog {
+	log := model.ChangeLog{EntityType: entityType, EntityId: entityId, Action: action}
+	if ctx := db.Statement.Context; ctx != nil {
+		if user, ok := ctx.Value("user").(model.User); ok {
+			log.Actor = user.Username
+		}
+		if actor, ok := ctx.Value("actor").(model.User); ok {
+			log.Impersonator = actor.Username
+		}
+	}
+	data, _ := json.Marshal(changes)
+	log.Changes = string(data)
+	return log
+}
+
+// A change history that cannot be written does not undo the change
+func saveChangeLogs(db *gorm.DB, logs []model.ChangeLog) {
+	if len(logs) == 0 {
+		return
+	}
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&logs).Error; err != nil {
+		Log.Errorf("Failed to record %d changes: %v", len(logs), err)
+	}
+}
@@ -3,7 +3,10 @@ package common
 import (
 	"github.com/esyede/goadmin/backend/config"
 	"github.com/esyede/goadmin/backend/model"
+	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -53,6 +56,8 @@ func InitMysql() {
 	if config.Conf.Mysql.LogMode {
 		db.Debug()
 	}
+	// Record the changes of users, roles, menus and apis
+	registerChangeHistory(db)
 	// Global DB assignment
 	DB = db
 	// Automatically migrate table structure
@@ -60,13 +65,105 @@ func InitMysql() {
 	Log.Infof("初始化mysql数据库完成! dsn: %s", showDsn)
 }
 
+// Database used with a context, changes of users, roles, menus and apis are recorded as made by the user of a request context
+func DBWithContext(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return DB
+	}
+	return DB.WithContext(ctx)
+}
+
 // Automatically migrate table structure
 func dbAutoMigrate() {
+	releaseRecycledMenuNames()
 	DB.AutoMigrate(
 		&model.User{},
 		&model.Role{},
 		&model.Menu{},
 		&model.Api{},
 		&model.OperationLog{},
+		&model.Department{},
+		&model.Post{},
+		&model.RecycleRecord{},
+		&model.UserInvitation{},
+		&model.UserAttribute{},
+		&model.UserAttributeValue{},
+		&model.ChangeLog{},
+		&model.SecurityEvent{},
+		&model.OperationLogRollup{},
 	)
+	normalizeUserMobiles()
+}
+
+// Release the names of menus recycled before menu names became unique, as recycling does now,
+// the unique index on menus.name cannot be created while a recycled menu and a live one share a name
+func releaseRecycledMenuNames() {
+	if !DB.Migrator().HasTable(&model.Menu{}) {
+		return
+	}
+	// The original names are kept for a restore
+	if err := DB.AutoMigrate(&model.RecycleRecord{}); err != nil {
+		Log.Warnf("Failed to migrate the recycle records: %v", err)
+		return
+	}
+	var menus []model.Menu
+	err := DB.Unscoped().Select("id", "name").Where("deleted_at IS NOT NULL AND name NOT LIKE ?", "~%").Find(&menus).Error
+	if err != nil {
+		Log.Warnf("Failed to get the names of recycled menus: %v", err)
+		return
+	}
+	for _, menu := range menus {
+		b, _ := json.Marshal(map[string]string{"name": menu.Name})
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&model.RecycleRecord{}).
+				Where("entity_type = ? AND entity_id = ?", "menu", menu.ID).
+				Update("unique_values", string(b))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				err := tx.Create(&model.RecycleRecord{EntityType: "menu", EntityId: menu.ID, UniqueValues: string(b)}).Error
+				if err != nil {
+					return err
+				}
+			}
+			// A raw statement is not recorded as a change
+			return tx.Exec("UPDATE menus SET name = CONCAT('~', id) WHERE id = ?", menu.ID).Error
+		})
+		if err != nil {
+			Log.Warnf("Failed to release the name of recycled menu %d: %v", menu.ID, err)
+		}
+	}
+
+	var duplicates []string
+	err = DB.Model(&model.Menu{}).Group("name").Having("COUNT(*) > 1").Pluck("name", &duplicates).Error
+	if err != nil {
+		Log.Warnf("Failed to check menu names: %v", err)
+		return
+	}
+	if len(duplicates) > 0 {
+		Log.Warnf("Menu names are used by more than one menu, rename them so menu names can be made unique: %s", strings.Join(duplicates, ", "))
+	}
+}
+
+// Convert mobiles stored before E.164 was enforced, numbers that cannot be parsed or would collide are left as they are.
+// Mobiles released by users in the recycle bin start with "~" and are skipped.
+func normalizeUserMobiles() {
+	var users []model.User
+	err := DB.Unscoped().Select("id", "mobile").Where("mobile NOT LIKE ? AND mobile NOT LIKE ?", "+%", "~%").Find(&users).Error
+	if err != nil {
+		Log.Warnf("Failed to get mobiles to normalize: %v", err)
+		return
+	}
+	for _, user := range users {
+		mobile := NormalizeMobile(user.Mobile)
+		if mobile == user.Mobile {
+			Log.Warnf("Mobile of user %d is not a valid phone number: %s", user.ID, user.Mobile)
+			continue
+		}
+		err := DB.Unscoped().Model(&model.User{}).Where("id = ?", user.ID).Update("mobile", mobile).Error
+		if err != nil {
+			Log.Warnf("Failed to normalize the mobile of user %d: %v", user.ID, err)
+		}
+	}
 }
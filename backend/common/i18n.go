@@ -0,0 +1,203 @@
+package common
+
+import (
+	"github.com/esyede/goadmin/backend/config"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Locale the messages are written in, it needs no catalog
+const SourceLocale = "en"
+
+// Translations of a locale, keyed by the message in the source locale
+type catalog struct {
+	messages map[string]string
+	patterns []catalogPattern
+}
+
+// Message containing fmt verbs, matched against the formatted message
+type catalogPattern struct {
+	re          *regexp.Regexp
+	translation string
+}
+
+// Message catalogs by locale
+var catalogs = make(map[string]*catalog)
+
+var verbRe = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// Load the message catalogs
+func InitI18n() {
+	files, err := filepath.Glob(filepath.Join(config.Conf.I18n.Path, "*.json"))
+	if err != nil {
+		Log.Panicf("Failed to find message catalogs: %v", err)
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			Log.Panicf("Failed to read message catalog %s: %v", file, err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(b, &messages); err != nil {
+			Log.Panicf("Failed to parse message catalog %s: %v", file, err)
+		}
+		locale := strings.ToLower(strings.TrimSuffix(filepath.Base(file), ".json"))
+		catalogs[locale] = newCatalog(messages)
+	}
+	Log.Infof("Initialization of message catalogs completed, locales: %s", strings.Join(Locales(), ", "))
+}
+
+func newCatalog(messages map[string]string) *catalog {
+	cat := &catalog{messages: make(map[string]string)}
+	for message, translation := range messages {
+		if translation == "" {
+			continue
+		}
+		if !verbRe.MatchString(message) {
+			cat.messages[message] = translation
+			continue
+		}
+		// Every verb matches one argument, "%%" is a literal percent sign
+		var sb strings.Builder
+		last := 0
+		for _, loc := range verbRe.FindAllStringIndex(message, -1) {
+			sb.WriteString(regexp.QuoteMeta(message[last:loc[0]]))
+			if message[loc[0]:loc[1]] == "%%" {
+				sb.WriteString("%")
+			} else {
+				sb.WriteString("(.+?)")
+			}
+			last = loc[1]
+		}
+		sb.WriteString(regexp.QuoteMeta(message[last:]))
+		cat.patterns = append(cat.patterns, catalogPattern{
+			re:          regexp.MustCompile("^" + sb.String() + "$"),
+			translation: translation,
+		})
+	}
+	// Longer patterns are more specific
+	sort.Slice(cat.patterns, func(i, j int) bool {
+		return len(cat.patterns[i].re.String()) > len(cat.patterns[j].re.String())
+	})
+	return cat
+}
+
+func (cat *catalog) translate(message string) string {
+	if translation, ok := cat.messages[message]; ok {
+		return translation
+	}
+	for _, pattern := range cat.patterns {
+		args := pattern.re.FindStringSubmatch(message)
+		if args == nil {
+			continue
+		}
+		// The arguments fill the verbs of the translation in the order they appear in the message
+		i := 1
+		return verbRe.ReplaceAllStringFunc(pattern.translation, func(verb string) string {
+			if verb == "%%" {
+				return "%"
+			}
+			if i >= len(args) {
+				return verb
+			}
+			i++
+			return cat.translate(args[i-1])
+		})
+	}
+	// Messages like "Failed to update user: reason" are translated part by part
+	if i := strings.Index(message, ": "); i > 0 {
+		return cat.translate(message[:i]) + ": " + cat.translate(message[i+2:])
+	}
+	return message
+}
+
+// Translate a message into a locale, messages without a translation are returned unchanged
+func T(locale string, message string) string {
+	cat, ok := catalogs[locale]
+	if !ok || message == "" {
+		return message
+	}
+	return cat.translate(message)
+}
+
+// Supported locales
+func Locales() []string {
+	locales := []string{SourceLocale}
+	for locale := range catalogs {
+		if locale != SourceLocale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Whether messages can be shown in a locale
+func IsSupportedLocale(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok || locale == SourceLocale
+}
+
+// Locale used when the user and the browser ask for none of the supported ones
+func DefaultLocale() string {
+	if IsSupportedLocale(config.Conf.I18n.DefaultLocale) {
+		return config.Conf.I18n.DefaultLocale
+	}
+	return SourceLocale
+}
+
+// Pick the best supported locale for an Accept-Language header, e.g. "zh-CN,zh;q=0.9,en;q=0.8"
+func NegotiateLocale(acceptLanguage string) string {
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	ranges := make([]languageRange, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fields[0]), "_", "-"))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, languageRange{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	for _, r := range ranges {
+		if IsSupportedLocale(r.tag) {
+			return r.tag
+		}
+		// "zh-cn" falls back to "zh"
+		if i := strings.Index(r.tag, "-"); i > 0 && IsSupportedLocale(r.tag[:i]) {
+			return r.tag[:i]
+		}
+	}
+	return DefaultLocale()
+}
+
+// Locale of the messages of the current request
+func Locale(c *gin.Context) string {
+	if locale := c.GetString("locale"); locale != "" {
+		return locale
+	}
+	return DefaultLocale()
+}
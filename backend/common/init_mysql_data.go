@@ -63,120 +63,7 @@ func InitData() {
 		}
 	}
 
-	// 2. write menu
-	newMenus := make([]model.Menu, 0)
-	var uint0 uint = 0
-	var uint1 uint = 1
-	componentStr := "component"
-	systemUserStr := "/system/user"
-	userStr := "user"
-	peoplesStr := "peoples"
-	treeTableStr := "tree-table"
-	treeStr := "tree"
-	exampleStr := "example"
-	logOperationStr := "/log/operation-log"
-	documentationStr := "documentation"
-	var uint6 uint = 6
-	menus := []model.Menu{
-		{
-			Model:     gorm.Model{ID: 1},
-			Name:      "System",
-			Title:     "System Management",
-			Icon:      &componentStr,
-			Path:      "/system",
-			Component: "Layout",
-			Redirect:  &systemUserStr,
-			Sort:      10,
-			ParentId:  &uint0,
-			Roles:     roles[:1],
-			Creator:   "system",
-		},
-		{
-			Model:     gorm.Model{ID: 2},
-			Name:      "User",
-			Title:     "User Management",
-			Icon:      &userStr,
-			Path:      "user",
-			Component: "/system/user/index",
-			Sort:      11,
-			ParentId:  &uint1,
-			Roles:     roles[:1],
-			Creator:   "system",
-		},
-		{
-			Model:     gorm.Model{ID: 3},
-			Name:      "Role",
-			Title:     "Role Management",
-			Icon:      &peoplesStr,
-			Path:      "role",
-			Component: "/system/role/index",
-			Sort:      12,
-			ParentId:  &uint1,
-			Roles:     roles[:1],
-			Creator:   "system",
-		},
-		{
-			Model:     gorm.Model{ID: 4},
-			Name:      "Menu",
-			Title:     "Menu Management",
-			Icon:      &treeTableStr,
-			Path:      "menu",
-			Component: "/system/menu/index",
-			Sort:      13,
-			ParentId:  &uint1,
-			Roles:     roles[:1],
-			Creator:   "system",
-		},
-		{
-			Model:     gorm.Model{ID: 5},
-			Name:      "API",
-			Title:     "API Management",
-			Icon:      &treeStr,
-			Path:      "api",
-			Component: "/system/api/index",
-			Sort:      14,
-			ParentId:  &uint1,
-			Roles:     roles[:1],
-			Creator:   "system",
-		},
-		{
-			Model:     gorm.Model{ID: 6},
-			Name:      "Log",
-			Title:     "Log Management",
-			Icon:      &exampleStr,
-			Path:      "/log",
-			Component: "Layout",
-			Redirect:  &logOperationStr,
-			Sort:      20,
-			ParentId:  &uint0,
-			Roles:     roles[:2],
-			Creator:   "system",
-		},
-		{
-			Model:     gorm.Model{ID: 7},
-			Name:      "OperationLog",
-			Title:     "OperationLog",
-			Icon:      &documentationStr,
-			Path:      "operation-log",
-			Component: "/log/operation-log/index",
-			Sort:      21,
-			ParentId:  &uint6,
-			Roles:     roles[:2],
-			Creator:   "system",
-		},
-	}
-	for _, menu := range menus {
-		err := DB.First(&menu, menu.ID).Error
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			newMenus = append(newMenus, menu)
-		}
-	}
-	if len(newMenus) > 0 {
-		err := DB.Create(&newMenus).Error
-		if err != nil {
-			Log.Errorf("Failed to write system menu data: %v", err)
-		}
-	}
+	// 2. Menus are seeded from the menu file, see repository.InitMenuData
 
 	// 3. Write user
 	newUsers := make([]model.User, 0)
@@ -185,7 +72,7 @@ func InitData() {
 			Model:        gorm.Model{ID: 1},
 			Username:     "admin",
 			Password:     util.GenPasswd("123456"),
-			Mobile:       "081234567890",
+			Mobile:       "+6281234567890",
 			Avatar:       "https://i.pravatar.cc/300",
 			Nickname:     new(string),
 			Introduction: new(string),
@@ -197,7 +84,7 @@ func InitData() {
 			Model:        gorm.Model{ID: 2},
 			Username:     "faker",
 			Password:     util.GenPasswd("123456"),
-			Mobile:       "19999999999",
+			Mobile:       "+8619999999999",
 			Avatar:       "https://i.pravatar.cc/300",
 			Nickname:     new(string),
 			Introduction: new(string),
@@ -209,7 +96,7 @@ func InitData() {
 			Model:        gorm.Model{ID: 3},
 			Username:     "nike",
 			Password:     util.GenPasswd("123456"),
-			Mobile:       "081234567891",
+			Mobile:       "+6281234567891",
 			Avatar:       "https://i.pravatar.cc/300",
 			Nickname:     new(string),
 			Introduction: new(string),
@@ -221,7 +108,7 @@ func InitData() {
 			Model:        gorm.Model{ID: 4},
 			Username:     "bob",
 			Password:     util.GenPasswd("123456"),
-			Mobile:       "081234567892",
+			Mobile:       "+6281234567892",
 			Avatar:       "https://i.pravatar.cc/300",
 			Nickname:     new(string),
 			Introduction: new(string),
@@ -464,6 +351,342 @@ func InitData() {
 			Desc:     "Delete operation logs in batches",
 			Creator:  "system",
 		},
+		{
+			Method:   "GET",
+			Path:     "/department/list",
+			Category: "department",
+			Desc:     "Get department list",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/department/tree",
+			Category: "department",
+			Desc:     "Get department tree",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/department/create",
+			Category: "department",
+			Desc:     "Create department",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/department/update/:departmentId",
+			Category: "department",
+			Desc:     "Update department",
+			Creator:  "system",
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/department/delete/batch",
+			Category: "department",
+			Desc:     "Batch delete department",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/department/users/get/:departmentId",
+			Category: "department",
+			Desc:     "Get department members",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/department/users/update/:departmentId",
+			Category: "department",
+			Desc:     "Update department members",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/post/list",
+			Category: "post",
+			Desc:     "Get post list",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/post/create",
+			Category: "post",
+			Desc:     "Create post",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/post/update/:postId",
+			Category: "post",
+			Desc:     "Update post",
+			Creator:  "system",
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/post/delete/batch",
+			Category: "post",
+			Desc:     "Delete posts in batches",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/user/import",
+			Category: "user",
+			Desc:     "Import users",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/user/export",
+			Category: "user",
+			Desc:     "Export users",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/user/profile",
+			Category: "user",
+			Desc:     "Update own profile",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/user/profile/avatar",
+			Category: "user",
+			Desc:     "Upload own avatar",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/recycle/list/:entityType",
+			Category: "recycle",
+			Desc:     "Get recycle bin list",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/recycle/restore/:entityType",
+			Category: "recycle",
+			Desc:     "Restore records from the recycle bin",
+			Creator:  "system",
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/recycle/purge/:entityType",
+			Category: "recycle",
+			Desc:     "Permanently delete records from the recycle bin",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/invitation/create",
+			Category: "invitation",
+			Desc:     "Invite user",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/invitation/list",
+			Category: "invitation",
+			Desc:     "Get pending invitation list",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/invitation/resend/:invitationId",
+			Category: "invitation",
+			Desc:     "Resend invitation",
+			Creator:  "system",
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/invitation/revoke/:invitationId",
+			Category: "invitation",
+			Desc:     "Revoke invitation",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/user-attribute/list",
+			Category: "user-attribute",
+			Desc:     "Get user attribute list",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/user-attribute/create",
+			Category: "user-attribute",
+			Desc:     "Create user attribute",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/user-attribute/update/:attributeId",
+			Category: "user-attribute",
+			Desc:     "Update user attribute",
+			Creator:  "system",
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/user-attribute/delete/batch",
+			Category: "user-attribute",
+			Desc:     "Delete user attributes in batches",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/user/impersonate/:userId",
+			Category: "user",
+			Desc:     "Impersonate user",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/user/batch/status",
+			Category: "user",
+			Desc:     "Batch update user status",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/user/batch/roles",
+			Category: "user",
+			Desc:     "Batch update user roles",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/user/batch/password/reset",
+			Category: "user",
+			Desc:     "Batch reset user passwords",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/menu/move",
+			Category: "menu",
+			Desc:     "Move and reorder menus",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/menu/export",
+			Category: "menu",
+			Desc:     "Export menus as a menu file",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/menu/import/diff",
+			Category: "menu",
+			Desc:     "Compare a menu file with the menus",
+			Creator:  "system",
+		},
+		{
+			Method:   "POST",
+			Path:     "/menu/import",
+			Category: "menu",
+			Desc:     "Import menus from a menu file",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/operation/detail/:operationLogId",
+			Category: "log",
+			Desc:     "Get operation log detail",
+			Creator:  "system",
+		},
+		{
+			Method:   "PATCH",
+			Path:     "/log/ipLocation/reload",
+			Category: "log",
+			Desc:     "Reload the ip location database",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/operation/export",
+			Category: "log",
+			Desc:     "Export operation logs",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/operation/verify",
+			Category: "log",
+			Desc:     "Verify the hash chain of operation logs",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/change/history/:entityType/:entityId",
+			Category: "log",
+			Desc:     "Get the change history of a record",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/stats/traffic",
+			Category: "log",
+			Desc:     "Get operation log traffic statistics",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/stats/users",
+			Category: "log",
+			Desc:     "Get the users with the most operations",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/stats/paths",
+			Category: "log",
+			Desc:     "Get the endpoints with the most operations",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/stats/statuses",
+			Category: "log",
+			Desc:     "Get operation log status statistics",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/stats/logins",
+			Category: "log",
+			Desc:     "Get failed login statistics",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/operation/tail",
+			Category: "log",
+			Desc:     "Stream new operation logs",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/security/event/list",
+			Category: "log",
+			Desc:     "Get security event list",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/security/event/counts",
+			Category: "log",
+			Desc:     "Count security events by type",
+			Creator:  "system",
+		},
+		{
+			Method:   "GET",
+			Path:     "/log/stats/clients",
+			Category: "log",
+			Desc:     "Get browser, system and device statistics",
+			Creator:  "system",
+		},
 	}
 	newApi := make([]model.Api, 0)
 	newRoleCasbin := make([]model.RoleCasbin, 0)
@@ -487,6 +710,8 @@ func InitData() {
 				"/base/refreshToken",
 				"/user/info",
 				"/menu/access/tree/:userId",
+				"/user/profile",
+				"/user/profile/avatar",
 			}
 
 			if funk.ContainsString(basePaths, api.Path) {
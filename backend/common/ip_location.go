@@ -0,0 +1,104 @@
+package common
+
+import (
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/util"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	ipRegion      *util.Ip2Region // nil when there is no database file
+	ipRegionMu    sync.RWMutex
+	ipRegionCache *util.LRUCache
+)
+
+// Longest location stored in operation logs
+const ipLocationMaxLength = 50
+
+// Load the ip2region database used to locate the addresses of operation logs
+func InitIpLocation() {
+	ipRegionCache = util.NewLRUCache(config.Conf.IpLocation.CacheSize)
+	if err := ReloadIpLocation(); err != nil {
+		// Private addresses are still recognized without a database
+		Log.Warnf("IP locations are not available: %v", err)
+		return
+	}
+	Log.Info("Initialization of ip location completed!")
+}
+
+// Load the database file again, e.g. after it was replaced with a newer one
+func ReloadIpLocation() error {
+	data, err := ioutil.ReadFile(config.Conf.IpLocation.Database)
+	if err != nil {
+		// A removed database stops locating addresses
+		if os.IsNotExist(err) {
+			ipRegionMu.Lock()
+			ipRegion = nil
+			ipRegionMu.Unlock()
+			ipRegionCache.Clear()
+		}
+		return err
+	}
+	region, err := util.NewIp2Region(data)
+	if err != nil {
+		return err
+	}
+
+	ipRegionMu.Lock()
+	ipRegion = region
+	ipRegionMu.Unlock()
+	ipRegionCache.Clear()
+	return nil
+}
+
+// Location of an ip address, e.g. "Indonesia Jakarta", empty when unknown
+func IpLocation(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	switch {
+	case parsed.IsLoopback():
+		return "Loopback"
+	case parsed.IsPrivate(), parsed.IsLinkLocalUnicast(), parsed.IsUnspecified():
+		return "Private network"
+	}
+
+	if location, ok := ipRegionCache.Get(ip); ok {
+		return location
+	}
+	ipRegionMu.RLock()
+	region := ipRegion
+	ipRegionMu.RUnlock()
+	if region == nil {
+		return ""
+	}
+	result, err := region.Search(parsed)
+	if err != nil {
+		return ""
+	}
+
+	// Regions look like "Country|0|Province|City|ISP", unknown parts are 0 and the ISP is left out
+	parts := make([]string, 0, 4)
+	fields := strings.Split(result, "|")
+	if len(fields) > 4 {
+		fields = fields[:4]
+	}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || field == "0" || (len(parts) > 0 && parts[len(parts)-1] == field) {
+			continue
+		}
+		parts = append(parts, field)
+	}
+	location := strings.Join(parts, " ")
+	if runes := []rune(location); len(runes) > ipLocationMaxLength {
+		location = string(runes[:ipLocationMaxLength])
+	}
+	ipRegionCache.Set(ip, location)
+	return location
+}
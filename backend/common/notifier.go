@@ -0,0 +1,82 @@
+package common
+
+import (
+	"github.com/esyede/goadmin/backend/config"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// Message sent to a user
+type Notification struct {
+	To      string // Recipient address, an email for the smtp notifier
+	Subject string
+	Body    string
+}
+
+// Delivery channel of notifications
+type INotifier interface {
+	Send(n Notification) error // Deliver a notification
+}
+
+// Global notifier
+var Notifier INotifier
+
+// Initialize the notifier
+func InitNotifier() {
+	conf := config.Conf.Notifier
+	switch conf.Driver {
+	case "", "log":
+		Notifier = LogNotifier{}
+	case "smtp":
+		Notifier = SmtpNotifier{
+			Host:     conf.SmtpHost,
+			Port:     conf.SmtpPort,
+			Username: conf.SmtpUsername,
+			Password: conf.SmtpPassword,
+			From:     conf.From,
+		}
+	default:
+		Log.Panicf("Unknown notifier driver: %s", conf.Driver)
+	}
+	Log.Info("Initialization of notifier completed!")
+}
+
+// Write notifications to the log instead of delivering them, for development
+type LogNotifier struct {
+}
+
+func (n LogNotifier) Send(notification Notification) error {
+	Log.Infof("Notification to %s: %s\n%s", notification.To, notification.Subject, notification.Body)
+	return nil
+}
+
+// Deliver notifications as plain text emails
+type SmtpNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (n SmtpNotifier) Send(notification Notification) error {
+	// Header values must not contain line breaks, otherwise headers could be injected
+	for _, v := range []string{notification.To, notification.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("Invalid notification header: %q", v)
+		}
+	}
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	msg := "From: " + n.From + "\r\n" +
+		"To: " + notification.To + "\r\n" +
+		"Subject: " + notification.Subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(notification.Body, "\n", "\r\n")
+	return smtp.SendMail(fmt.Sprintf("%s:%d", n.Host, n.Port), auth, n.From, []string{notification.To}, []byte(msg))
+}
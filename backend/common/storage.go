@@ -0,0 +1,83 @@
+package common
+
+import (
+	"github.com/esyede/goadmin/backend/config"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage backend of uploaded files
+type IStorage interface {
+	Save(name string, r io.Reader) (string, error) // Save the file under name and return its access url
+	Delete(url string) error                       // Delete the file behind an url returned by Save, urls of other backends are ignored
+}
+
+// Global storage backend
+var Storage IStorage
+
+// Initialize the storage backend
+func InitStorage() {
+	switch config.Conf.Upload.Driver {
+	case "", "local":
+		Storage = NewLocalStorage(config.Conf.Upload.Path, config.Conf.Upload.UrlPrefix)
+	default:
+		Log.Panicf("Unknown upload driver: %s", config.Conf.Upload.Driver)
+	}
+	// Avatars are scaled to this size, without it every upload would fail
+	if config.Conf.Upload.AvatarSize <= 0 {
+		config.Conf.Upload.AvatarSize = 256
+	}
+	Log.Info("Initialization of storage completed!")
+}
+
+// Store files on the local disk, they are served by the static route registered for UrlPrefix
+type LocalStorage struct {
+	Dir       string
+	UrlPrefix string
+}
+
+func NewLocalStorage(dir string, urlPrefix string) LocalStorage {
+	return LocalStorage{Dir: dir, UrlPrefix: "/" + strings.Trim(urlPrefix, "/")}
+}
+
+func (s LocalStorage) Save(name string, r io.Reader) (string, error) {
+	name = path.Clean("/" + name)
+	filename := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", err
+	}
+	// Write to a temporary file first so that a failed upload never leaves a partial file behind
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return s.UrlPrefix + name, nil
+}
+
+func (s LocalStorage) Delete(url string) error {
+	if !strings.HasPrefix(url, s.UrlPrefix+"/") {
+		return nil
+	}
+	name := path.Clean("/" + strings.TrimPrefix(url, s.UrlPrefix))
+	err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
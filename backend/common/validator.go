@@ -1,34 +1,116 @@
 package common
 
 import (
-	"regexp"
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/util"
+	"strings"
 
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
 	"github.com/go-playground/locales/id"
+	"github.com/go-playground/locales/zh"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
 	id_translations "github.com/go-playground/validator/v10/translations/id"
+	zh_translations "github.com/go-playground/validator/v10/translations/zh"
 )
 
 // Global Validate data verification column
 var Validate *validator.Validate
 
-// Global translator
+// Global translator of the default locale
 var Trans ut.Translator
 
+// Validator translators by locale
+var translators = make(map[string]ut.Translator)
+
+// Locales the validator has built-in translations for
+var validatorLocales = map[string]struct {
+	translator locales.Translator
+	register   func(v *validator.Validate, trans ut.Translator) error
+}{
+	"en": {en.New(), en_translations.RegisterDefaultTranslations},
+	"id": {id.New(), id_translations.RegisterDefaultTranslations},
+	"zh": {zh.New(), zh_translations.RegisterDefaultTranslations},
+}
+
+// Messages of the custom validations, translated through the message catalogs
+var customValidationMessages = map[string]string{
+	"checkMobile":     "{0} must be a valid mobile number",
+	"checkLocale":     "{0} must be a supported locale",
+	"checkUnreserved": "{0} must not start with ~",
+}
+
 // Initialize Validator data verification
 func InitValidate() {
-	indonesian := id.New()
-	uni := ut.New(indonesian, indonesian)
-	trans, _ := uni.GetTranslator("id")
-	Trans = trans
+	if !util.IsPhoneRegion(config.Conf.System.PhoneRegion) {
+		Log.Panicf("Unknown phone region: %s", config.Conf.System.PhoneRegion)
+	}
 	Validate = validator.New()
-	_ = id_translations.RegisterDefaultTranslations(Validate, Trans)
 	_ = Validate.RegisterValidation("checkMobile", checkMobile)
+	_ = Validate.RegisterValidation("checkLocale", checkLocale)
+	_ = Validate.RegisterValidation("checkUnreserved", checkUnreserved)
+
+	fallback := validatorLocales[SourceLocale].translator
+	uni := ut.New(fallback, fallback)
+	for locale, vl := range validatorLocales {
+		_ = uni.AddTranslator(vl.translator, true)
+		trans, _ := uni.GetTranslator(locale)
+		_ = vl.register(Validate, trans)
+		for tag, message := range customValidationMessages {
+			registerValidationMessage(trans, tag, T(locale, message))
+		}
+		translators[locale] = trans
+	}
+	Trans = GetTranslator(DefaultLocale())
 	Log.Infof("Initialization of validator.v10 data validator completed")
 }
 
+func registerValidationMessage(trans ut.Translator, tag string, message string) {
+	_ = Validate.RegisterTranslation(tag, trans, func(ut ut.Translator) error {
+		return ut.Add(tag, message, true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T(tag, fe.Field())
+		return t
+	})
+}
+
+// Get the validator translator of a locale, locales without built-in translations use the source locale
+func GetTranslator(locale string) ut.Translator {
+	if trans, ok := translators[locale]; ok {
+		return trans
+	}
+	return translators[SourceLocale]
+}
+
+// Get the validator translator of the current request
+func GetTrans(c *gin.Context) ut.Translator {
+	return GetTranslator(Locale(c))
+}
+
+// Mobile numbers are accepted in E.164 form or as national numbers of the configured region
 func checkMobile(fl validator.FieldLevel) bool {
-	reg := `^1([38][0-9]|14[579]|5[^4]|16[6]|7[1-35-8]|9[189])\d{8}$`
-	rgx := regexp.MustCompile(reg)
-	return rgx.MatchString(fl.Field().String())
+	_, err := util.NormalizePhone(fl.Field().String(), config.Conf.System.PhoneRegion)
+	return err == nil
+}
+
+// Locales must have a message catalog
+func checkLocale(fl validator.FieldLevel) bool {
+	return IsSupportedLocale(fl.Field().String())
+}
+
+// Values starting with "~" are reserved for the released unique values of records in the recycle bin
+func checkUnreserved(fl validator.FieldLevel) bool {
+	return !strings.HasPrefix(fl.Field().String(), "~")
+}
+
+// Normalize a mobile number to E.164 for storage and lookup, invalid numbers are returned unchanged
+func NormalizeMobile(mobile string) string {
+	normalized, err := util.NormalizePhone(mobile, config.Conf.System.PhoneRegion)
+	if err != nil {
+		return mobile
+	}
+	return normalized
 }
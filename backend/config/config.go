@@ -17,12 +17,21 @@ import (
 var Conf = new(config)
 
 type config struct {
-	System    *SystemConfig    `mapstructure:"system" json:"system"`
-	Logs      *LogsConfig      `mapstructure:"logs" json:"logs"`
-	Mysql     *MysqlConfig     `mapstructure:"mysql" json:"mysql"`
-	Casbin    *CasbinConfig    `mapstructure:"casbin" json:"casbin"`
-	Jwt       *JwtConfig       `mapstructure:"jwt" json:"jwt"`
-	RateLimit *RateLimitConfig `mapstructure:"rate-limit" json:"rateLimit"`
+	System       *SystemConfig       `mapstructure:"system" json:"system"`
+	Logs         *LogsConfig         `mapstructure:"logs" json:"logs"`
+	Mysql        *MysqlConfig        `mapstructure:"mysql" json:"mysql"`
+	Casbin       *CasbinConfig       `mapstructure:"casbin" json:"casbin"`
+	Jwt          *JwtConfig          `mapstructure:"jwt" json:"jwt"`
+	RateLimit    *RateLimitConfig    `mapstructure:"rate-limit" json:"rateLimit"`
+	Upload       *UploadConfig       `mapstructure:"upload" json:"upload"`
+	RecycleBin   *RecycleBinConfig   `mapstructure:"recycle-bin" json:"recycleBin"`
+	Notifier     *NotifierConfig     `mapstructure:"notifier" json:"notifier"`
+	Invitation   *InvitationConfig   `mapstructure:"invitation" json:"invitation"`
+	Menu         *MenuConfig         `mapstructure:"menu" json:"menu"`
+	I18n         *I18nConfig         `mapstructure:"i18n" json:"i18n"`
+	OperationLog *OperationLogConfig `mapstructure:"operation-log" json:"operationLog"`
+	IpLocation   *IpLocationConfig   `mapstructure:"ip-location" json:"ipLocation"`
+	Security     *SecurityConfig     `mapstructure:"security" json:"security"`
 }
 
 // Set up to read configuration information
@@ -70,6 +79,7 @@ type SystemConfig struct {
 	InitData        bool   `mapstructure:"init-data" json:"initData"`
 	RSAPublicKey    string `mapstructure:"rsa-public-key" json:"rsaPublicKey"`
 	RSAPrivateKey   string `mapstructure:"rsa-private-key" json:"rsaPrivateKey"`
+	PhoneRegion     string `mapstructure:"phone-region" json:"phoneRegion"`
 	RSAPublicBytes  []byte `mapstructure:"-" json:"-"`
 	RSAPrivateBytes []byte `mapstructure:"-" json:"-"`
 }
@@ -101,13 +111,105 @@ type CasbinConfig struct {
 }
 
 type JwtConfig struct {
-	Realm      string `mapstructure:"realm" json:"realm"`
-	Key        string `mapstructure:"key" json:"key"`
-	Timeout    int    `mapstructure:"timeout" json:"timeout"`
-	MaxRefresh int    `mapstructure:"max-refresh" json:"maxRefresh"`
+	Realm                string `mapstructure:"realm" json:"realm"`
+	Key                  string `mapstructure:"key" json:"key"`
+	Timeout              int    `mapstructure:"timeout" json:"timeout"`
+	MaxRefresh           int    `mapstructure:"max-refresh" json:"maxRefresh"`
+	ImpersonationTimeout int    `mapstructure:"impersonation-timeout" json:"impersonationTimeout"`
 }
 
 type RateLimitConfig struct {
 	FillInterval int64 `mapstructure:"fill-interval" json:"fillInterval"`
 	Capacity     int64 `mapstructure:"capacity" json:"capacity"`
 }
+
+type UploadConfig struct {
+	Driver        string `mapstructure:"driver" json:"driver"`
+	Path          string `mapstructure:"path" json:"path"`
+	UrlPrefix     string `mapstructure:"url-prefix" json:"urlPrefix"`
+	AvatarSize    int    `mapstructure:"avatar-size" json:"avatarSize"`
+	AvatarMaxSize int64  `mapstructure:"avatar-max-size" json:"avatarMaxSize"`
+}
+
+type RecycleBinConfig struct {
+	RetentionDays int `mapstructure:"retention-days" json:"retentionDays"`
+	PurgeInterval int `mapstructure:"purge-interval" json:"purgeInterval"`
+}
+
+type NotifierConfig struct {
+	Driver       string `mapstructure:"driver" json:"driver"`
+	SmtpHost     string `mapstructure:"smtp-host" json:"smtpHost"`
+	SmtpPort     int    `mapstructure:"smtp-port" json:"smtpPort"`
+	SmtpUsername string `mapstructure:"smtp-username" json:"smtpUsername"`
+	SmtpPassword string `mapstructure:"smtp-password" json:"smtpPassword"`
+	From         string `mapstructure:"from" json:"from"`
+}
+
+type InvitationConfig struct {
+	AcceptUrl string `mapstructure:"accept-url" json:"acceptUrl"`
+	Timeout   int    `mapstructure:"timeout" json:"timeout"`
+}
+
+type MenuConfig struct {
+	DeleteMode string `mapstructure:"delete-mode" json:"deleteMode"`
+	SeedFile   string `mapstructure:"seed-file" json:"seedFile"`
+}
+
+type OperationLogConfig struct {
+	CaptureBody   bool                         `mapstructure:"capture-body" json:"captureBody"`
+	MaxBodySize   int                          `mapstructure:"max-body-size" json:"maxBodySize"`
+	RedactFields  []string                     `mapstructure:"redact-fields" json:"redactFields"`
+	QueueSize     int                          `mapstructure:"queue-size" json:"queueSize"`
+	Overflow      string                       `mapstructure:"overflow" json:"overflow"`
+	Workers       int                          `mapstructure:"workers" json:"workers"`
+	BatchSize     int                          `mapstructure:"batch-size" json:"batchSize"`
+	FlushInterval int                          `mapstructure:"flush-interval" json:"flushInterval"`
+	MaxRetries    int                          `mapstructure:"max-retries" json:"maxRetries"`
+	SpoolPath     string                       `mapstructure:"spool-path" json:"spoolPath"`
+	Retention     *OperationLogRetentionConfig `mapstructure:"retention" json:"retention"`
+	Audit         bool                         `mapstructure:"audit" json:"audit"`
+	AuditKey      string                       `mapstructure:"audit-key" json:"-"`
+	Rollup        *OperationLogRollupConfig    `mapstructure:"rollup" json:"rollup"`
+	Tail          *OperationLogTailConfig      `mapstructure:"tail" json:"tail"`
+}
+
+type OperationLogRetentionConfig struct {
+	Interval    int                         `mapstructure:"interval" json:"interval"`
+	MaxAge      int                         `mapstructure:"max-age" json:"maxAge"`
+	MaxRows     int                         `mapstructure:"max-rows" json:"maxRows"`
+	Rules       []OperationLogRetentionRule `mapstructure:"rules" json:"rules"`
+	Archive     bool                        `mapstructure:"archive" json:"archive"`
+	ArchivePath string                      `mapstructure:"archive-path" json:"archivePath"`
+}
+
+type OperationLogRollupConfig struct {
+	Enabled  bool `mapstructure:"enabled" json:"enabled"`
+	Interval int  `mapstructure:"interval" json:"interval"`
+}
+
+type OperationLogTailConfig struct {
+	MaxSubscribers int `mapstructure:"max-subscribers" json:"maxSubscribers"`
+	Buffer         int `mapstructure:"buffer" json:"buffer"`
+}
+
+type OperationLogRetentionRule struct {
+	Status string `mapstructure:"status" json:"status"`
+	MaxAge int    `mapstructure:"max-age" json:"maxAge"`
+}
+
+type IpLocationConfig struct {
+	Database  string `mapstructure:"database" json:"database"`
+	CacheSize int    `mapstructure:"cache-size" json:"cacheSize"`
+}
+
+type I18nConfig struct {
+	DefaultLocale string `mapstructure:"default-locale" json:"defaultLocale"`
+	Path          string `mapstructure:"path" json:"path"`
+}
+
+type SecurityConfig struct {
+	MaxLoginFailures   int `mapstructure:"max-login-failures" json:"maxLoginFailures"`
+	MaxIpLoginFailures int `mapstructure:"max-ip-login-failures" json:"maxIpLoginFailures"`
+	LoginFailureWindow int `mapstructure:"login-failure-window" json:"loginFailureWindow"`
+	LockoutDuration    int `mapstructure:"lockout-duration" json:"lockoutDuration"`
+}
@@ -40,7 +40,7 @@ func (ac ApiController) GetApis(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -62,6 +62,17 @@ func (ac ApiController) GetApiTree(c *gin.Context) {
 		response.Fail(c, nil, "Failed to obtain interface tree")
 		return
 	}
+	// The tree is only read when granting interfaces, so the descriptions are shown in the locale of the request
+	locale := common.Locale(c)
+	for _, category := range tree {
+		for _, api := range category.Children {
+			if desc := api.Descs[locale]; desc != "" {
+				api.Desc = desc
+			} else {
+				api.Desc = common.T(locale, api.Desc)
+			}
+		}
+	}
 	response.Success(c, gin.H{
 		"apiTree": tree,
 	}, "Obtaining the interface tree successfully")
@@ -77,7 +88,7 @@ func (ac ApiController) CreateApi(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -95,11 +106,12 @@ func (ac ApiController) CreateApi(c *gin.Context) {
 		Path:     req.Path,
 		Category: req.Category,
 		Desc:     req.Desc,
+		Descs:    model.LocaleTexts(req.Descs),
 		Creator:  ctxUser.Username,
 	}
 
 	// Create interface
-	err = ac.ApiRepository.CreateApi(&api)
+	err = ac.ApiRepository.WithContext(c).CreateApi(&api)
 	if err != nil {
 		response.Fail(c, nil, "Failed to create interface: "+err.Error())
 		return
@@ -119,7 +131,7 @@ func (ac ApiController) UpdateApiById(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -144,10 +156,11 @@ func (ac ApiController) UpdateApiById(c *gin.Context) {
 		Path:     req.Path,
 		Category: req.Category,
 		Desc:     req.Desc,
+		Descs:    model.LocaleTexts(req.Descs),
 		Creator:  ctxUser.Username,
 	}
 
-	err = ac.ApiRepository.UpdateApiById(uint(apiId), &api)
+	err = ac.ApiRepository.WithContext(c).UpdateApiById(uint(apiId), &api)
 	if err != nil {
 		response.Fail(c, nil, "Update interface failed: "+err.Error())
 		return
@@ -166,13 +179,13 @@ func (ac ApiController) BatchDeleteApiByIds(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
 
 	// Delete interface
-	err := ac.ApiRepository.BatchDeleteApiByIds(req.ApiIds)
+	err := ac.ApiRepository.WithContext(c).BatchDeleteApiByIds(req.ApiIds)
 	if err != nil {
 		response.Fail(c, nil, "Failed to delete interface: "+err.Error())
 		return
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/dto"
+	"github.com/esyede/goadmin/backend/repository"
+	"github.com/esyede/goadmin/backend/response"
+	"github.com/esyede/goadmin/backend/vo"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type IChangeLogController interface {
+	GetChangeHistory(c *gin.Context) // Get the changes of a user, role, menu or api with the fields before and after
+}
+
+type ChangeLogController struct {
+	ChangeLogRepository repository.IChangeLogRepository
+}
+
+func NewChangeLogController() IChangeLogController {
+	changeLogRepository := repository.NewChangeLogRepository()
+	changeLogController := ChangeLogController{ChangeLogRepository: changeLogRepository}
+	return changeLogController
+}
+
+// Get the changes of a user, role, menu or api with the fields before and after
+func (cc ChangeLogController) GetChangeHistory(c *gin.Context) {
+	var req vo.ChangeHistoryRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	req.EntityType = c.Param("entityType")
+	entityId, _ := strconv.Atoi(c.Param("entityId"))
+	if entityId > 0 {
+		req.EntityId = uint(entityId)
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	logs, total, err := cc.ChangeLogRepository.GetChangeHistory(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get change history: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"changes": dto.ToChangeLogsDto(logs), "total": total}, "Obtaining change history successfully")
+}
@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/repository"
+	"github.com/esyede/goadmin/backend/response"
+	"github.com/esyede/goadmin/backend/vo"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/thoas/go-funk"
+)
+
+type IDepartmentController interface {
+	GetDepartments(c *gin.Context)             // Get department list
+	GetDepartmentTree(c *gin.Context)          // Get department tree
+	CreateDepartment(c *gin.Context)           // Create department
+	UpdateDepartmentById(c *gin.Context)       // Update department
+	BatchDeleteDepartmentByIds(c *gin.Context) // Batch delete department
+	GetDepartmentUsersById(c *gin.Context)     // Get department members
+	UpdateDepartmentUsersById(c *gin.Context)  // Update department members
+}
+
+type DepartmentController struct {
+	DepartmentRepository repository.IDepartmentRepository
+}
+
+func NewDepartmentController() IDepartmentController {
+	departmentRepository := repository.NewDepartmentRepository()
+	departmentController := DepartmentController{DepartmentRepository: departmentRepository}
+	return departmentController
+}
+
+// Get department list
+func (dc DepartmentController) GetDepartments(c *gin.Context) {
+	var req vo.DepartmentListRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	departments, total, err := dc.DepartmentRepository.GetDepartments(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get department list: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"departments": departments, "total": total}, "Get department list successfully")
+}
+
+// Get department tree
+func (dc DepartmentController) GetDepartmentTree(c *gin.Context) {
+	departmentTree, err := dc.DepartmentRepository.GetDepartmentTree()
+	if err != nil {
+		response.Fail(c, nil, "Failed to get department tree: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"departmentTree": departmentTree}, "Get department tree successfully")
+}
+
+// Create department
+func (dc DepartmentController) CreateDepartment(c *gin.Context) {
+	var req vo.CreateDepartmentRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// The parent department must exist
+	if req.ParentId != 0 {
+		parents, err := dc.DepartmentRepository.GetDepartmentsByIds([]uint{req.ParentId})
+		if err != nil || len(parents) == 0 {
+			response.Fail(c, nil, "Parent department does not exist")
+			return
+		}
+	}
+
+	// Get department leaders
+	leaders, err := getDepartmentUsers(req.LeaderIds)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// Get current user
+	ur := repository.NewUserRepository()
+	ctxUser, err := ur.GetCurrentUser(c)
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain current user information")
+		return
+	}
+
+	department := model.Department{
+		Name:     req.Name,
+		Code:     req.Code,
+		Desc:     &req.Desc,
+		Sort:     req.Sort,
+		Status:   req.Status,
+		ParentId: &req.ParentId,
+		Creator:  ctxUser.Username,
+		Leaders:  leaders,
+	}
+
+	err = dc.DepartmentRepository.CreateDepartment(&department)
+	if err != nil {
+		response.Fail(c, nil, "Failed to create department: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Department created successfully")
+}
+
+// Update department
+func (dc DepartmentController) UpdateDepartmentById(c *gin.Context) {
+	var req vo.CreateDepartmentRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Get departmentId in path
+	departmentId, _ := strconv.Atoi(c.Param("departmentId"))
+	if departmentId <= 0 {
+		response.Fail(c, nil, "Department ID is incorrect")
+		return
+	}
+
+	// A department cannot be moved under itself or one of its sub-departments
+	if req.ParentId != 0 {
+		childIds, err := dc.DepartmentRepository.GetDepartmentChildIds(uint(departmentId))
+		if err != nil {
+			response.Fail(c, nil, "Failed to get sub-departments: "+err.Error())
+			return
+		}
+		if funk.Contains(childIds, req.ParentId) {
+			response.Fail(c, nil, "A department cannot be moved under itself or its sub-departments")
+			return
+		}
+		parents, err := dc.DepartmentRepository.GetDepartmentsByIds([]uint{req.ParentId})
+		if err != nil || len(parents) == 0 {
+			response.Fail(c, nil, "Parent department does not exist")
+			return
+		}
+	}
+
+	// Get department leaders
+	leaders, err := getDepartmentUsers(req.LeaderIds)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// Get current user
+	ur := repository.NewUserRepository()
+	ctxUser, err := ur.GetCurrentUser(c)
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain current user information")
+		return
+	}
+
+	department := model.Department{
+		Name:     req.Name,
+		Code:     req.Code,
+		Desc:     &req.Desc,
+		Sort:     req.Sort,
+		Status:   req.Status,
+		ParentId: &req.ParentId,
+		Creator:  ctxUser.Username,
+		Leaders:  leaders,
+	}
+
+	err = dc.DepartmentRepository.UpdateDepartmentById(uint(departmentId), &department)
+	if err != nil {
+		response.Fail(c, nil, "Update department failed: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Update department successfully")
+}
+
+// Batch delete department
+func (dc DepartmentController) BatchDeleteDepartmentByIds(c *gin.Context) {
+	var req vo.DeleteDepartmentRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	err := dc.DepartmentRepository.BatchDeleteDepartmentByIds(req.DepartmentIds)
+	if err != nil {
+		response.Fail(c, nil, "Failed to delete department: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Delete department successfully")
+}
+
+// Get department members
+func (dc DepartmentController) GetDepartmentUsersById(c *gin.Context) {
+	// Get departmentId in path
+	departmentId, _ := strconv.Atoi(c.Param("departmentId"))
+	if departmentId <= 0 {
+		response.Fail(c, nil, "Department ID is incorrect")
+		return
+	}
+
+	users, err := dc.DepartmentRepository.GetDepartmentUsersById(uint(departmentId))
+	if err != nil {
+		response.Fail(c, nil, "Failed to get department members: "+err.Error())
+		return
+	}
+	userIds := make([]uint, 0)
+	for _, user := range users {
+		userIds = append(userIds, user.ID)
+	}
+	response.Success(c, gin.H{"userIds": userIds}, "Get department members successfully")
+}
+
+// Update department members
+func (dc DepartmentController) UpdateDepartmentUsersById(c *gin.Context) {
+	var req vo.UpdateDepartmentUsersRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Get departmentId in path
+	departmentId, _ := strconv.Atoi(c.Param("departmentId"))
+	if departmentId <= 0 {
+		response.Fail(c, nil, "Department ID is incorrect")
+		return
+	}
+	departments, err := dc.DepartmentRepository.GetDepartmentsByIds([]uint{uint(departmentId)})
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	if len(departments) == 0 {
+		response.Fail(c, nil, "No department information was obtained")
+		return
+	}
+
+	users, err := getDepartmentUsers(req.UserIds)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	departments[0].Users = users
+
+	err = dc.DepartmentRepository.UpdateDepartmentUsers(departments[0])
+	if err != nil {
+		response.Fail(c, nil, "Failed to update department members: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Update department members successfully")
+}
+
+// Get users based on the user ID, all of them must exist
+func getDepartmentUsers(userIds []uint) ([]*model.User, error) {
+	users := make([]*model.User, 0)
+	if len(userIds) == 0 {
+		return users, nil
+	}
+	ur := repository.NewUserRepository()
+	users, err := ur.GetUsersByIds(userIds)
+	if err != nil {
+		return nil, errors.New("Failed to obtain user information based on user ID: " + err.Error())
+	}
+	if len(users) != len(funk.Uniq(userIds).([]uint)) {
+		return nil, errors.New("Some users do not exist")
+	}
+	return users, nil
+}
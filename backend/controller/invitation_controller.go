@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/repository"
+	"github.com/esyede/goadmin/backend/response"
+	"github.com/esyede/goadmin/backend/util"
+	"github.com/esyede/goadmin/backend/vo"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/thoas/go-funk"
+)
+
+type IInvitationController interface {
+	InviteUser(c *gin.Context)       // Create a pending user and send it an invitation
+	GetInvitations(c *gin.Context)   // Get pending invitations
+	ResendInvitation(c *gin.Context) // Send a new invitation, the old one stops working
+	RevokeInvitation(c *gin.Context) // Revoke a pending invitation
+	CheckInvitation(c *gin.Context)  // Get the invited user of a token, no login required
+	AcceptInvitation(c *gin.Context) // Set the password and activate the invited user, no login required
+}
+
+type InvitationController struct {
+	InvitationRepository repository.IInvitationRepository
+}
+
+func NewInvitationController() IInvitationController {
+	invitationRepository := repository.NewInvitationRepository()
+	invitationController := InvitationController{InvitationRepository: invitationRepository}
+	return invitationController
+}
+
+// Create a pending user and send it an invitation
+func (ic InvitationController) InviteUser(c *gin.Context) {
+	var req vo.InviteUserRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// The current user role sorting minimum value (the highest level role) and the current user
+	ur := repository.NewUserRepository()
+	currentRoleSortMin, ctxUser, err := ur.GetCurrentUserMinRoleSort(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// Get role based on the role id
+	rr := repository.NewRoleRepository()
+	roles, err := rr.GetRolesByIds(req.RoleIds)
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain role information based on role ID: "+err.Error())
+		return
+	}
+	if len(roles) == 0 {
+		response.Fail(c, nil, "No role information was obtained")
+		return
+	}
+	var reqRoleSorts []int
+	for _, role := range roles {
+		reqRoleSorts = append(reqRoleSorts, int(role.Sort))
+	}
+	// Users cannot invite users with a higher level than themselves or with the same level
+	if currentRoleSortMin >= uint(funk.MinInt(reqRoleSorts).(int)) {
+		response.Fail(c, nil, "Users cannot invite users with a higher level than themselves or with the same level.")
+		return
+	}
+
+	// Departments and posts are checked the same way as when creating a user
+	userReq := vo.CreateUserRequest{
+		DepartmentIds: req.DepartmentIds,
+		DepartmentId:  req.DepartmentId,
+		PostIds:       req.PostIds,
+	}
+	departments, departmentId, err := getReqDepartments(&userReq)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	posts, err := getReqPosts(&userReq)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	attributeValues, err := getUserAttributeValues(req.Attributes, nil)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// Nobody knows the password of a pending user, the invitee sets its own on acceptance
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	user := model.User{
+		Username:        req.Username,
+		Password:        util.GenPasswd(hex.EncodeToString(b)),
+		Mobile:          common.NormalizeMobile(req.Mobile),
+		Email:           reqEmail(req.Email),
+		Nickname:        &req.Nickname,
+		Introduction:    &req.Introduction,
+		Status:          3,
+		Creator:         ctxUser.Username,
+		Roles:           roles,
+		DepartmentId:    departmentId,
+		Departments:     departments,
+		Posts:           posts,
+		AttributeValues: attributeValues,
+	}
+	token, err := ic.InvitationRepository.WithContext(c).InviteUser(&user, ctxUser.Username)
+	if err != nil {
+		response.Fail(c, nil, "Failed to invite user: "+err.Error())
+		return
+	}
+
+	err = sendInvitation(&user, token)
+	if err != nil {
+		response.Fail(c, nil, "The user was created, but sending the invitation failed, please resend it: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "User invited successfully")
+}
+
+// Get pending invitations
+func (ic InvitationController) GetInvitations(c *gin.Context) {
+	var req vo.InvitationListRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	invitations, total, err := ic.InvitationRepository.GetInvitations(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get invitation list: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"invitations": invitations, "total": total}, "Obtaining invitation list successfully")
+}
+
+// Send a new invitation, the old one stops working
+func (ic InvitationController) ResendInvitation(c *gin.Context) {
+	invitation, ctxUser, err := ic.getManagedInvitation(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	token, err := ic.InvitationRepository.WithContext(c).ResendInvitation(&invitation, ctxUser.Username)
+	if err != nil {
+		response.Fail(c, nil, "Failed to resend invitation: "+err.Error())
+		return
+	}
+	err = sendInvitation(invitation.User, token)
+	if err != nil {
+		response.Fail(c, nil, "Failed to send invitation: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Invitation resent successfully")
+}
+
+// Revoke a pending invitation
+func (ic InvitationController) RevokeInvitation(c *gin.Context) {
+	invitation, _, err := ic.getManagedInvitation(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	err = ic.InvitationRepository.WithContext(c).RevokeInvitation(invitation.ID)
+	if err != nil {
+		response.Fail(c, nil, "Failed to revoke invitation: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Invitation revoked successfully")
+}
+
+// Get the invited user of a token, no login required
+func (ic InvitationController) CheckInvitation(c *gin.Context) {
+	var req vo.CheckInvitationRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	invitation, err := ic.InvitationRepository.GetInvitationByToken(req.Token)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Only what the invitee needs to recognize the invitation
+	response.Success(c, gin.H{
+		"username":  invitation.User.Username,
+		"email":     invitation.User.Email,
+		"expiresAt": invitation.ExpiresAt,
+	}, "The invitation is valid")
+}
+
+// Set the password and activate the invited user, no login required
+func (ic InvitationController) AcceptInvitation(c *gin.Context) {
+	var req vo.AcceptInvitationRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Password decrypted via RSA
+	decodeData, err := util.RSADecrypt([]byte(req.Password), config.Conf.System.RSAPrivateBytes)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	req.Password = string(decodeData)
+	if len(req.Password) < 6 {
+		response.Fail(c, nil, "Password length must be at least 6 characters")
+		return
+	}
+
+	invitation, err := ic.InvitationRepository.GetInvitationByToken(req.Token)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	err = ic.InvitationRepository.WithContext(c).AcceptInvitation(&invitation, util.GenPasswd(req.Password))
+	if err != nil {
+		response.Fail(c, nil, "Failed to accept invitation: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Invitation accepted successfully, please log in")
+}
+
+// Get the pending invitation in path, the current user must have a higher level than the invited user
+func (ic InvitationController) getManagedInvitation(c *gin.Context) (model.UserInvitation, model.User, error) {
+	var invitation model.UserInvitation
+	var ctxUser model.User
+	// Get invitationId in path
+	invitationId, _ := strconv.Atoi(c.Param("invitationId"))
+	if invitationId <= 0 {
+		return invitation, ctxUser, fmt.Errorf("Incorrect invitation ID")
+	}
+	invitation, err := ic.InvitationRepository.GetInvitationById(uint(invitationId))
+	if err != nil {
+		return invitation, ctxUser, err
+	}
+
+	ur := repository.NewUserRepository()
+	minSort, ctxUser, err := ur.GetCurrentUserMinRoleSort(c)
+	if err != nil {
+		return invitation, ctxUser, err
+	}
+	roleMinSortList, err := ur.GetUserMinRoleSortsByIds([]uint{invitation.UserId})
+	if err != nil || len(roleMinSortList) == 0 {
+		return invitation, ctxUser, fmt.Errorf("Failed to obtain user role sorting minimum value based on user ID")
+	}
+	if int(minSort) >= roleMinSortList[0] {
+		return invitation, ctxUser, fmt.Errorf("Users cannot manage invitations of users whose role level is higher than or equal to their own")
+	}
+	return invitation, ctxUser, nil
+}
+
+// Deliver an invitation token to the invited user through the notifier
+func sendInvitation(user *model.User, token string) error {
+	if user.Email == nil {
+		return fmt.Errorf("User %s has no email", user.Username)
+	}
+	acceptUrl := config.Conf.Invitation.AcceptUrl
+	separator := "?"
+	if strings.Contains(acceptUrl, "?") {
+		separator = "&"
+	}
+	link := acceptUrl + separator + "token=" + url.QueryEscape(token)
+	return common.Notifier.Send(common.Notification{
+		To:      *user.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("Hello %s,\n\nAn account has been created for you. Open the link below to set your password:\n\n%s\n\nThe link can only be used once and expires in %d hours.\n",
+			user.Username, link, repository.InvitationTimeout()),
+	})
+}
@@ -2,14 +2,21 @@ package controller
 
 import (
 	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/dto"
 	"github.com/esyede/goadmin/backend/model"
 	"github.com/esyede/goadmin/backend/repository"
 	"github.com/esyede/goadmin/backend/response"
 	"github.com/esyede/goadmin/backend/vo"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/thoas/go-funk"
+	"gopkg.in/yaml.v2"
+	"gorm.io/gorm"
 )
 
 type IMenuController interface {
@@ -18,10 +25,16 @@ type IMenuController interface {
 	CreateMenu(c *gin.Context)              // Create menu
 	UpdateMenuById(c *gin.Context)          // Update menu
 	BatchDeleteMenuByIds(c *gin.Context)    // Batch delete menu
+	MoveMenus(c *gin.Context)               // Move and reorder menus in batches
 	GetUserMenusByUserId(c *gin.Context)    // Get user's accessible menu list
 	GetUserMenuTreeByUserId(c *gin.Context) // Get user's accessible menu tree
+	ExportMenus(c *gin.Context)             // Export the menus and their roles as a yaml menu file
+	DiffMenus(c *gin.Context)               // Get the changes importing a menu file would make
+	ImportMenus(c *gin.Context)             // Create and update menus to match a menu file
 }
 
+const menuFileMaxSize = 1 << 20 // Maximum size of an imported menu file
+
 type MenuController struct {
 	MenuRepository repository.IMenuRepository
 }
@@ -62,11 +75,25 @@ func (mc MenuController) CreateMenu(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
 
+	// The parent menu must exist
+	if req.ParentId != 0 {
+		parents, err := mc.MenuRepository.GetMenusByIds([]uint{req.ParentId})
+		if err != nil || len(parents) == 0 {
+			response.Fail(c, nil, "Parent menu does not exist")
+			return
+		}
+	}
+	// Menu files identify menus by their names
+	if err := mc.MenuRepository.CheckMenuName(req.Name, 0); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
 	// Get current user
 	ur := repository.NewUserRepository()
 	ctxUser, err := ur.GetCurrentUser(c)
@@ -78,6 +105,7 @@ func (mc MenuController) CreateMenu(c *gin.Context) {
 	menu := model.Menu{
 		Name:       req.Name,
 		Title:      req.Title,
+		Titles:     model.LocaleTexts(req.Titles),
 		Icon:       &req.Icon,
 		Path:       req.Path,
 		Redirect:   &req.Redirect,
@@ -93,7 +121,7 @@ func (mc MenuController) CreateMenu(c *gin.Context) {
 		Creator:    ctxUser.Username,
 	}
 
-	err = mc.MenuRepository.CreateMenu(&menu)
+	err = mc.MenuRepository.WithContext(c).CreateMenu(&menu)
 	if err != nil {
 		response.Fail(c, nil, "Failed to create menu: "+err.Error())
 		return
@@ -111,7 +139,7 @@ func (mc MenuController) UpdateMenuById(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -123,6 +151,19 @@ func (mc MenuController) UpdateMenuById(c *gin.Context) {
 		return
 	}
 
+	// A menu cannot be moved under itself or one of its sub-menus, and the parent menu must exist
+	err := mc.MenuRepository.CheckMenuParents(map[uint]uint{uint(menuId): req.ParentId})
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Menu files identify menus by their names
+	err = mc.MenuRepository.CheckMenuName(req.Name, uint(menuId))
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
 	// Get the current user
 	ur := repository.NewUserRepository()
 	ctxUser, err := ur.GetCurrentUser(c)
@@ -134,6 +175,7 @@ func (mc MenuController) UpdateMenuById(c *gin.Context) {
 	menu := model.Menu{
 		Name:       req.Name,
 		Title:      req.Title,
+		Titles:     model.LocaleTexts(req.Titles),
 		Icon:       &req.Icon,
 		Path:       req.Path,
 		Redirect:   &req.Redirect,
@@ -149,7 +191,7 @@ func (mc MenuController) UpdateMenuById(c *gin.Context) {
 		Creator:    ctxUser.Username,
 	}
 
-	err = mc.MenuRepository.UpdateMenuById(uint(menuId), &menu)
+	err = mc.MenuRepository.WithContext(c).UpdateMenuById(uint(menuId), &menu)
 	if err != nil {
 		response.Fail(c, nil, "Update menu failed: "+err.Error())
 		return
@@ -169,11 +211,11 @@ func (mc MenuController) BatchDeleteMenuByIds(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
-	err := mc.MenuRepository.BatchDeleteMenuByIds(req.MenuIds)
+	err := mc.MenuRepository.WithContext(c).BatchDeleteMenuByIds(req.MenuIds)
 	if err != nil {
 		response.Fail(c, nil, "Failed to delete menu: "+err.Error())
 		return
@@ -182,6 +224,47 @@ func (mc MenuController) BatchDeleteMenuByIds(c *gin.Context) {
 	response.Success(c, nil, "Delete menu successfully")
 }
 
+// Move and reorder menus in batches, e.g. after dragging them around in the menu tree
+func (mc MenuController) MoveMenus(c *gin.Context) {
+	var req vo.MoveMenusRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	parents := make(map[uint]uint)
+	menus := make([]*model.Menu, 0, len(req.Menus))
+	for _, item := range req.Menus {
+		if _, ok := parents[item.ID]; ok {
+			response.Fail(c, nil, fmt.Sprintf("Menu %d is moved more than once", item.ID))
+			return
+		}
+		parents[item.ID] = item.ParentId
+		parentId := item.ParentId
+		menus = append(menus, &model.Menu{Model: gorm.Model{ID: item.ID}, ParentId: &parentId, Sort: item.Sort})
+	}
+	// The menus are checked as a whole, a move may only be valid together with the others
+	err := mc.MenuRepository.CheckMenuParents(parents)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	err = mc.MenuRepository.WithContext(c).MoveMenus(menus)
+	if err != nil {
+		response.Fail(c, nil, "Failed to move menus: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Move menus successfully")
+}
+
 // Get the user's accessible menu list based on the user ID
 func (mc MenuController) GetUserMenusByUserId(c *gin.Context) {
 	// Get the userId in the path
@@ -196,6 +279,7 @@ func (mc MenuController) GetUserMenusByUserId(c *gin.Context) {
 		response.Fail(c, nil, "Failed to get list of user's accessible menus: "+err.Error())
 		return
 	}
+	localizeMenus(common.Locale(c), menus)
 	response.Success(c, gin.H{"menus": menus}, "Obtaining the user's accessible menu list successfully")
 }
 
@@ -213,5 +297,137 @@ func (mc MenuController) GetUserMenuTreeByUserId(c *gin.Context) {
 		response.Fail(c, nil, "Failed to get user's accessible menu tree: "+err.Error())
 		return
 	}
+	localizeMenus(common.Locale(c), menuTree)
 	response.Success(c, gin.H{"menuTree": menuTree}, "Obtaining the user's accessible menu tree successfully")
 }
+
+// Export the menus and their roles as a yaml menu file, menus are identified by their names so the file can be imported into another instance
+func (mc MenuController) ExportMenus(c *gin.Context) {
+	menus, err := mc.MenuRepository.ExportMenus()
+	if err != nil {
+		response.Fail(c, nil, "Failed to export menus: "+err.Error())
+		return
+	}
+	data, err := yaml.Marshal(dto.MenuFileDto{Menus: menus})
+	if err != nil {
+		response.Fail(c, nil, "Failed to export menus: "+err.Error())
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=menus.yml")
+	c.Data(http.StatusOK, "application/x-yaml; charset=utf-8", data)
+}
+
+// Get the changes importing a menu file would make, without making them
+func (mc MenuController) DiffMenus(c *gin.Context) {
+	req, menus, err := readMenuFile(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	changes, err := mc.MenuRepository.DiffMenus(menus, req.Prune)
+	if err != nil {
+		response.Fail(c, nil, "Failed to compare menus: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"changes": changes}, "Compare menus successfully")
+}
+
+// Create and update menus to match a menu file, importing the same file again changes nothing
+func (mc MenuController) ImportMenus(c *gin.Context) {
+	req, menus, err := readMenuFile(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// The current user role sorting minimum value (the highest level role) and the current user
+	ur := repository.NewUserRepository()
+	minSort, ctxUser, err := ur.GetCurrentUserMinRoleSort(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// A menu file may bind menus to roles of any level, so non-administrators can only import files that leave the roles as they are
+	if minSort != 1 {
+		changes, err := mc.MenuRepository.DiffMenus(menus, req.Prune)
+		if err != nil {
+			response.Fail(c, nil, "Failed to compare menus: "+err.Error())
+			return
+		}
+		if changesMenuRoles(changes, menus) {
+			response.Fail(c, nil, "Only administrators can change the roles of menus")
+			return
+		}
+	}
+
+	changes, err := mc.MenuRepository.WithContext(c).ImportMenus(menus, req.Prune, ctxUser.Username)
+	if err != nil {
+		response.Fail(c, nil, "Failed to import menus: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"changes": changes}, "Import menus successfully")
+}
+
+// Read and parse the uploaded menu file
+func readMenuFile(c *gin.Context) (vo.ImportMenusRequest, []*dto.MenuYamlDto, error) {
+	var req vo.ImportMenusRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		return req, nil, err
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return req, nil, fmt.Errorf("Please upload a menu file")
+	}
+	if fileHeader.Size > menuFileMaxSize {
+		return req, nil, fmt.Errorf("The file cannot be larger than %d MB", menuFileMaxSize>>20)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return req, nil, fmt.Errorf("Failed to open the uploaded file: %v", err)
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return req, nil, fmt.Errorf("Failed to open the uploaded file: %v", err)
+	}
+
+	menus, err := dto.ParseMenuYaml(data, common.GetTrans(c))
+	return req, menus, err
+}
+
+// Whether the changes of an import bind menus to roles or unbind them
+func changesMenuRoles(changes []*dto.MenuDiffDto, menus []*dto.MenuYamlDto) bool {
+	withRoles := make(map[string]bool)
+	var collect func(menus []*dto.MenuYamlDto)
+	collect = func(menus []*dto.MenuYamlDto) {
+		for _, menu := range menus {
+			withRoles[menu.Name] = len(menu.Roles) > 0
+			collect(menu.Children)
+		}
+	}
+	collect(menus)
+
+	for _, change := range changes {
+		if change.Action == "create" && withRoles[change.Name] || funk.ContainsString(change.Fields, "roles") {
+			return true
+		}
+	}
+	return false
+}
+
+// Show the titles of menus in a locale, a title of the locale set on the menu wins over the message catalog.
+// Only the menus users navigate with are localized, the ones that are edited keep their original titles.
+func localizeMenus(locale string, menus []*model.Menu) {
+	for _, menu := range menus {
+		if title := menu.Titles[locale]; title != "" {
+			menu.Title = title
+		} else {
+			menu.Title = common.T(locale, menu.Title)
+		}
+		localizeMenus(locale, menu.Children)
+	}
+}
@@ -2,9 +2,17 @@ package controller
 
 import (
 	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
 	"github.com/esyede/goadmin/backend/repository"
 	"github.com/esyede/goadmin/backend/response"
+	"github.com/esyede/goadmin/backend/util"
 	"github.com/esyede/goadmin/backend/vo"
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -12,16 +20,32 @@ import (
 
 type IOperationLogController interface {
 	GetOperationLogs(c *gin.Context)             // Get the operation log list
+	GetOperationLogById(c *gin.Context)          // Get an operation log with its request parameters and response body
+	ExportOperationLogs(c *gin.Context)          // Export the filtered operation logs as csv or ndjson
+	TailOperationLogs(c *gin.Context)            // Stream new operation logs as server-sent events
+	VerifyOperationLogs(c *gin.Context)          // Verify the hash chain of the operation logs in audit mode
 	BatchDeleteOperationLogByIds(c *gin.Context) // Batch delete operation logs
+	ReloadIpLocation(c *gin.Context)             // Load the ip location database again after it was updated
+	GetTrafficStats(c *gin.Context)              // Get the number of requests and errors per hour or day
+	GetTopUserStats(c *gin.Context)              // Get the users with the most requests
+	GetTopPathStats(c *gin.Context)              // Get the endpoints with the most requests and their time costs
+	GetStatusStats(c *gin.Context)               // Get the number of responses per status code
+	GetLoginFailureStats(c *gin.Context)         // Get the failed logins per hour or day and where they came from
+	GetClientStats(c *gin.Context)               // Get the most used browsers, operating systems and device types
 }
 
 type OperationLogController struct {
-	operationLogRepository repository.IOperationLogRepository
+	operationLogRepository      repository.IOperationLogRepository
+	operationLogStatsRepository repository.IOperationLogStatsRepository
 }
 
 func NewOperationLogController() IOperationLogController {
 	operationLogRepository := repository.NewOperationLogRepository()
-	operationLogController := OperationLogController{operationLogRepository: operationLogRepository}
+	operationLogStatsRepository := repository.NewOperationLogStatsRepository()
+	operationLogController := OperationLogController{
+		operationLogRepository:      operationLogRepository,
+		operationLogStatsRepository: operationLogStatsRepository,
+	}
 	return operationLogController
 }
 
@@ -35,19 +59,179 @@ func (oc OperationLogController) GetOperationLogs(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
 	// Obtain
-	logs, total, err := oc.operationLogRepository.GetOperationLogs(&req)
+	logs, total, nextCursor, err := oc.operationLogRepository.GetOperationLogs(&req)
 	if err != nil {
 		response.Fail(c, nil, "Failed to obtain operation log list: "+err.Error())
 		return
 	}
+	// Keyset paging does not count the logs, the next cursor is empty on the last page
+	if req.Keyset {
+		response.Success(c, gin.H{"logs": logs, "nextCursor": nextCursor}, "Obtaining operation log list successfully")
+		return
+	}
 	response.Success(c, gin.H{"logs": logs, "total": total}, "Obtaining operation log list successfully")
 }
 
+// Get an operation log with its request parameters and response body
+func (oc OperationLogController) GetOperationLogById(c *gin.Context) {
+	// Get operationLogId in path
+	operationLogId, _ := strconv.Atoi(c.Param("operationLogId"))
+	if operationLogId <= 0 {
+		response.Fail(c, nil, "Operation log ID is incorrect")
+		return
+	}
+
+	log, err := oc.operationLogRepository.GetOperationLogById(uint(operationLogId))
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain operation log: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"log": log}, "Obtaining operation log successfully")
+}
+
+// Export the filtered operation logs as csv or ndjson, both are streamed batch by batch
+func (oc OperationLogController) ExportOperationLogs(c *gin.Context) {
+	var req vo.ExportOperationLogsRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	filename := fmt.Sprintf("operation-logs-%s", time.Now().Format("20060102150405"))
+	var err error
+	if req.Format == "ndjson" {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.ndjson", filename))
+		w := bufio.NewWriter(c.Writer)
+		err = oc.operationLogRepository.ExportOperationLogs(&req.OperationLogListRequest, func(logs []*model.OperationLog) error {
+			for _, log := range logs {
+				line, err := util.MarshalJson(log)
+				if err != nil {
+					return err
+				}
+				if _, err := w.WriteString(line + "\n"); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		})
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		w := csv.NewWriter(c.Writer)
+		_ = w.Write([]string{"id", "username", "impersonator", "ip", "ipLocation", "method", "path", "desc", "status", "startTime", "timeCost", "userAgent", "browser", "os", "deviceType", "params", "response"})
+		err = oc.operationLogRepository.ExportOperationLogs(&req.OperationLogListRequest, func(logs []*model.OperationLog) error {
+			for _, log := range logs {
+				row := []string{
+					strconv.Itoa(int(log.ID)),
+					log.Username,
+					log.Impersonator,
+					log.Ip,
+					log.IpLocation,
+					log.Method,
+					log.Path,
+					log.Desc,
+					strconv.Itoa(log.Status),
+					log.StartTime.Format("2006-01-02 15:04:05.000"),
+					strconv.FormatInt(log.TimeCost, 10),
+					log.UserAgent,
+					log.Browser,
+					log.Os,
+					log.DeviceType,
+					log.Params,
+					log.Response,
+				}
+				if err := w.Write(row); err != nil {
+					return err
+				}
+			}
+			w.Flush()
+			return w.Error()
+		})
+		w.Flush()
+	}
+	if err != nil {
+		// The header has already been sent, the error can only be logged
+		common.Log.Errorf("Failed to export operation logs: %v", err)
+	}
+}
+
+// Stream the operation logs as server-sent events once they are written, until the client goes away.
+// "log" events carry the logs, "dropped" events the number of logs missed because the client did not keep up.
+func (oc OperationLogController) TailOperationLogs(c *gin.Context) {
+	var req vo.OperationLogTailRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	sub, err := oc.operationLogRepository.SubscribeOperationLogs(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to tail operation logs: "+err.Error())
+		return
+	}
+	defer oc.operationLogRepository.UnsubscribeOperationLogs(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Proxies like nginx would otherwise hold the events back
+	c.Header("X-Accel-Buffering", "no")
+	// Comments keep idle connections from being closed by proxies
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	var dropped uint64
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case log, ok := <-sub.Logs:
+			if !ok {
+				return false
+			}
+			c.SSEvent("log", log)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-c.Request.Context().Done():
+			return false
+		}
+		if n := sub.Dropped(); n != dropped {
+			dropped = n
+			c.SSEvent("dropped", gin.H{"dropped": n})
+		}
+		return true
+	})
+}
+
+// Verify the hash chain of the operation logs in audit mode, the report names the first log whose link is broken
+func (oc OperationLogController) VerifyOperationLogs(c *gin.Context) {
+	report, err := oc.operationLogRepository.VerifyOperationLogs()
+	if err != nil {
+		response.Fail(c, nil, "Failed to verify operation logs: "+err.Error())
+		return
+	}
+	if report.Reason != "" {
+		report.Reason = common.T(common.Locale(c), report.Reason)
+	}
+	response.Success(c, gin.H{"report": report}, "Verifying operation logs successfully")
+}
+
 // Batch delete operation logs
 func (oc OperationLogController) BatchDeleteOperationLogByIds(c *gin.Context) {
 	var req vo.DeleteOperationLogRequest
@@ -58,7 +242,7 @@ func (oc OperationLogController) BatchDeleteOperationLogByIds(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -72,3 +256,117 @@ func (oc OperationLogController) BatchDeleteOperationLogByIds(c *gin.Context) {
 
 	response.Success(c, nil, "Log deleted successfully")
 }
+
+// Load the ip location database again after the file was updated, without restarting
+func (oc OperationLogController) ReloadIpLocation(c *gin.Context) {
+	err := common.ReloadIpLocation()
+	if err != nil {
+		response.Fail(c, nil, "Failed to reload ip location database: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Reload ip location database successfully")
+}
+
+// Get the number of requests and errors per hour or day, with the logs lost by the queue since the start
+func (oc OperationLogController) GetTrafficStats(c *gin.Context) {
+	req, ok := bindOperationLogStatsRequest(c)
+	if !ok {
+		return
+	}
+	traffic, err := oc.operationLogStatsRepository.GetTraffic(req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get operation log statistics: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{
+		"traffic": traffic,
+		"dropped": oc.operationLogRepository.DroppedOperationLogs(),
+	}, "Get operation log statistics successfully")
+}
+
+// Get the users with the most requests
+func (oc OperationLogController) GetTopUserStats(c *gin.Context) {
+	req, ok := bindOperationLogStatsRequest(c)
+	if !ok {
+		return
+	}
+	users, err := oc.operationLogStatsRepository.GetTopUsers(req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get operation log statistics: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"users": users}, "Get operation log statistics successfully")
+}
+
+// Get the endpoints with the most requests and their time costs
+func (oc OperationLogController) GetTopPathStats(c *gin.Context) {
+	req, ok := bindOperationLogStatsRequest(c)
+	if !ok {
+		return
+	}
+	paths, err := oc.operationLogStatsRepository.GetTopPaths(req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get operation log statistics: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"paths": paths}, "Get operation log statistics successfully")
+}
+
+// Get the number of responses per status code
+func (oc OperationLogController) GetStatusStats(c *gin.Context) {
+	req, ok := bindOperationLogStatsRequest(c)
+	if !ok {
+		return
+	}
+	statuses, err := oc.operationLogStatsRepository.GetStatuses(req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get operation log statistics: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"statuses": statuses}, "Get operation log statistics successfully")
+}
+
+// Get the failed logins per hour or day and the addresses they came from most
+func (oc OperationLogController) GetLoginFailureStats(c *gin.Context) {
+	req, ok := bindOperationLogStatsRequest(c)
+	if !ok {
+		return
+	}
+	failures, err := oc.operationLogStatsRepository.GetLoginFailures(req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get operation log statistics: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"logins": failures}, "Get operation log statistics successfully")
+}
+
+// Get the most used browsers, operating systems and device types
+func (oc OperationLogController) GetClientStats(c *gin.Context) {
+	req, ok := bindOperationLogStatsRequest(c)
+	if !ok {
+		return
+	}
+	clients, err := oc.operationLogStatsRepository.GetClients(req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get operation log statistics: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"clients": clients}, "Get operation log statistics successfully")
+}
+
+// Bind and verify the time range and options of a statistics request, the failure is already answered
+func bindOperationLogStatsRequest(c *gin.Context) (*vo.OperationLogStatsRequest, bool) {
+	var req vo.OperationLogStatsRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return nil, false
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return nil, false
+	}
+	return &req, true
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/repository"
+	"github.com/esyede/goadmin/backend/response"
+	"github.com/esyede/goadmin/backend/vo"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type IPostController interface {
+	GetPosts(c *gin.Context)             // Get post list
+	CreatePost(c *gin.Context)           // Create post
+	UpdatePostById(c *gin.Context)       // Update post
+	BatchDeletePostByIds(c *gin.Context) // Delete posts in batches
+}
+
+type PostController struct {
+	PostRepository repository.IPostRepository
+}
+
+func NewPostController() IPostController {
+	postRepository := repository.NewPostRepository()
+	postController := PostController{PostRepository: postRepository}
+	return postController
+}
+
+// Get post list
+func (pc PostController) GetPosts(c *gin.Context) {
+	var req vo.PostListRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Get post list
+	posts, total, err := pc.PostRepository.GetPosts(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get post list: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"posts": posts, "total": total}, "Obtaining post list successfully")
+}
+
+// Create post
+func (pc PostController) CreatePost(c *gin.Context) {
+	var req vo.CreatePostRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Get current user
+	ur := repository.NewUserRepository()
+	ctxUser, err := ur.GetCurrentUser(c)
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain current user information")
+		return
+	}
+
+	post := model.Post{
+		Code:    req.Code,
+		Name:    req.Name,
+		Desc:    &req.Desc,
+		Sort:    req.Sort,
+		Status:  req.Status,
+		Creator: ctxUser.Username,
+	}
+
+	// Create post
+	err = pc.PostRepository.CreatePost(&post)
+	if err != nil {
+		response.Fail(c, nil, "Failed to create post: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Post created successfully")
+}
+
+// Update post
+func (pc PostController) UpdatePostById(c *gin.Context) {
+	var req vo.CreatePostRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+	// Get postId in path
+	postId, _ := strconv.Atoi(c.Param("postId"))
+	if postId <= 0 {
+		response.Fail(c, nil, "Incorrect post ID")
+		return
+	}
+
+	// Get post information based on the post ID in path
+	posts, err := pc.PostRepository.GetPostsByIds([]uint{uint(postId)})
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	if len(posts) == 0 {
+		response.Fail(c, nil, "No post information was obtained")
+		return
+	}
+
+	// Get current user
+	ur := repository.NewUserRepository()
+	ctxUser, err := ur.GetCurrentUser(c)
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain current user information")
+		return
+	}
+
+	post := model.Post{
+		Code:    req.Code,
+		Name:    req.Name,
+		Desc:    &req.Desc,
+		Sort:    req.Sort,
+		Status:  req.Status,
+		Creator: ctxUser.Username,
+	}
+
+	// Update post
+	err = pc.PostRepository.UpdatePostById(uint(postId), &post)
+	if err != nil {
+		response.Fail(c, nil, "Failed to update post: "+err.Error())
+		return
+	}
+
+	// Cached users may carry the old post information, let active users re-cache it
+	ur.ClearUserInfoCache()
+	response.Success(c, nil, "Update post successfully")
+}
+
+// Delete posts in batches
+func (pc PostController) BatchDeletePostByIds(c *gin.Context) {
+	var req vo.DeletePostRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Get post information
+	posts, err := pc.PostRepository.GetPostsByIds(req.PostIds)
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain post information: "+err.Error())
+		return
+	}
+	if len(posts) == 0 {
+		response.Fail(c, nil, "No post information was obtained")
+		return
+	}
+
+	// Delete post
+	err = pc.PostRepository.BatchDeletePostByIds(req.PostIds)
+	if err != nil {
+		response.Fail(c, nil, "Failed to delete post")
+		return
+	}
+
+	// If the post is successfully deleted, the cache will be cleared directly, allowing active users to re-cache the latest user information.
+	ur := repository.NewUserRepository()
+	ur.ClearUserInfoCache()
+	response.Success(c, nil, "Post deleted successfully")
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/repository"
+	"github.com/esyede/goadmin/backend/response"
+	"github.com/esyede/goadmin/backend/vo"
+	"encoding/json"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type IRecycleBinController interface {
+	GetRecycleBin(c *gin.Context) // Get soft-deleted records of an entity type
+	RestoreByIds(c *gin.Context)  // Restore soft-deleted records in batches
+	PurgeByIds(c *gin.Context)    // Permanently delete soft-deleted records in batches
+}
+
+type RecycleBinController struct {
+	RecycleBinRepository repository.IRecycleBinRepository
+}
+
+func NewRecycleBinController() IRecycleBinController {
+	recycleBinRepository := repository.NewRecycleBinRepository()
+	recycleBinController := RecycleBinController{RecycleBinRepository: recycleBinRepository}
+	return recycleBinController
+}
+
+// Get soft-deleted records of an entity type
+func (rc RecycleBinController) GetRecycleBin(c *gin.Context) {
+	var req vo.RecycleBinListRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	req.EntityType = c.Param("entityType")
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Get recycle bin list
+	list, total, err := rc.RecycleBinRepository.GetRecycleBin(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get recycle bin list: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"list": list, "total": total}, "Obtaining recycle bin list successfully")
+}
+
+// Restore soft-deleted records in batches
+func (rc RecycleBinController) RestoreByIds(c *gin.Context) {
+	var req vo.RecycleBinIdsRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	req.EntityType = c.Param("entityType")
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Users and roles of a higher level than the current user cannot be restored
+	if err := rc.checkRoleLevel(c, &req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	err := rc.RecycleBinRepository.WithContext(c).Restore(req.EntityType, req.Ids)
+	if err != nil {
+		response.Fail(c, nil, "Failed to restore records: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Records restored successfully")
+}
+
+// Permanently delete soft-deleted records in batches
+func (rc RecycleBinController) PurgeByIds(c *gin.Context) {
+	var req vo.RecycleBinIdsRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	req.EntityType = c.Param("entityType")
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Users and roles of a higher level than the current user cannot be purged
+	if err := rc.checkRoleLevel(c, &req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	err := rc.RecycleBinRepository.WithContext(c).Purge(req.EntityType, req.Ids)
+	if err != nil {
+		response.Fail(c, nil, "Failed to permanently delete records: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Records permanently deleted successfully")
+}
+
+// Check that the current user's role level is higher than the level of the recycled users or roles
+func (rc RecycleBinController) checkRoleLevel(c *gin.Context, req *vo.RecycleBinIdsRequest) error {
+	if req.EntityType != "user" && req.EntityType != "role" {
+		return nil
+	}
+
+	ur := repository.NewUserRepository()
+	minSort, _, err := ur.GetCurrentUserMinRoleSort(c)
+	if err != nil {
+		return err
+	}
+
+	var sorts []uint
+	if req.EntityType == "role" {
+		roles, err := rc.RecycleBinRepository.GetDeletedRoles(req.Ids)
+		if err != nil {
+			return errors.New("Failed to obtain role information: " + err.Error())
+		}
+		for _, role := range roles {
+			sorts = append(sorts, role.Sort)
+		}
+	} else {
+		// The roles of recycled users are only kept in their snapshots
+		records, err := rc.RecycleBinRepository.GetRecycleRecords(req.EntityType, req.Ids)
+		if err != nil {
+			return errors.New("Failed to obtain user information: " + err.Error())
+		}
+		roleIds := make([]uint, 0)
+		for _, record := range records {
+			if record.Associations == "" {
+				continue
+			}
+			var associations map[string][]uint
+			if err := json.Unmarshal([]byte(record.Associations), &associations); err != nil {
+				return err
+			}
+			roleIds = append(roleIds, associations["user_roles"]...)
+		}
+		if len(roleIds) > 0 {
+			rr := repository.NewRoleRepository()
+			roles, err := rr.GetRolesByIds(roleIds)
+			if err != nil {
+				return errors.New("Failed to obtain role information: " + err.Error())
+			}
+			for _, role := range roles {
+				sorts = append(sorts, role.Sort)
+			}
+		}
+	}
+
+	for _, sort := range sorts {
+		if minSort >= sort {
+			return errors.New("Users cannot operate on users or roles whose level is higher than or equal to their own")
+		}
+	}
+	return nil
+}
@@ -45,7 +45,7 @@ func (rc RoleController) GetRoles(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -69,7 +69,7 @@ func (rc RoleController) CreateRole(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -98,7 +98,7 @@ func (rc RoleController) CreateRole(c *gin.Context) {
 	}
 
 	// Creating a Role
-	err = rc.RoleRepository.CreateRole(&role)
+	err = rc.RoleRepository.WithContext(c).CreateRole(&role)
 	if err != nil {
 		response.Fail(c, nil, "Failed to create role: "+err.Error())
 		return
@@ -117,7 +117,7 @@ func (rc RoleController) UpdateRoleById(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -168,7 +168,7 @@ func (rc RoleController) UpdateRoleById(c *gin.Context) {
 	}
 
 	// Update role
-	err = rc.RoleRepository.UpdateRoleById(uint(roleId), &role)
+	err = rc.RoleRepository.WithContext(c).UpdateRoleById(uint(roleId), &role)
 	if err != nil {
 		response.Fail(c, nil, "Failed to update role: "+err.Error())
 		return
@@ -252,7 +252,7 @@ func (rc RoleController) UpdateRoleMenusById(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -345,7 +345,7 @@ func (rc RoleController) UpdateRoleMenusById(c *gin.Context) {
 
 	roles[0].Menus = reqMenus
 
-	err = rc.RoleRepository.UpdateRoleMenus(roles[0])
+	err = rc.RoleRepository.WithContext(c).UpdateRoleMenus(roles[0])
 	if err != nil {
 		response.Fail(c, nil, "Failed to update role's permissions menu: "+err.Error())
 		return
@@ -393,7 +393,7 @@ func (rc RoleController) UpdateRoleApisById(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -471,7 +471,7 @@ func (rc RoleController) UpdateRoleApisById(c *gin.Context) {
 	}
 
 	// Update the permission interface of the role
-	err = rc.RoleRepository.UpdateRoleApis(roles[0].Keyword, reqRolePolicies)
+	err = rc.RoleRepository.WithContext(c).UpdateRoleApis(roles[0].Keyword, reqRolePolicies)
 	if err != nil {
 		response.Fail(c, nil, err.Error())
 		return
@@ -491,7 +491,7 @@ func (rc RoleController) BatchDeleteRoleByIds(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -526,7 +526,7 @@ func (rc RoleController) BatchDeleteRoleByIds(c *gin.Context) {
 	}
 
 	// Delete role
-	err = rc.RoleRepository.BatchDeleteRoleByIds(roleIds)
+	err = rc.RoleRepository.WithContext(c).BatchDeleteRoleByIds(roleIds)
 	if err != nil {
 		response.Fail(c, nil, "Failed to delete role")
 		return
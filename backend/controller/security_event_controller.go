@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/repository"
+	"github.com/esyede/goadmin/backend/response"
+	"github.com/esyede/goadmin/backend/vo"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type ISecurityEventController interface {
+	GetSecurityEvents(c *gin.Context)      // Get the security event list
+	GetSecurityEventCounts(c *gin.Context) // Get the number of security events per type
+}
+
+type SecurityEventController struct {
+	SecurityEventRepository repository.ISecurityEventRepository
+}
+
+func NewSecurityEventController() ISecurityEventController {
+	securityEventRepository := repository.NewSecurityEventRepository()
+	securityEventController := SecurityEventController{SecurityEventRepository: securityEventRepository}
+	return securityEventController
+}
+
+// Get the security event list, newest first
+func (sc SecurityEventController) GetSecurityEvents(c *gin.Context) {
+	var req vo.SecurityEventListRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	events, total, err := sc.SecurityEventRepository.GetSecurityEvents(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get security events: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"events": events, "total": total}, "Get security events successfully")
+}
+
+// Get the number of security events per type, with the same filters as the list
+func (sc SecurityEventController) GetSecurityEventCounts(c *gin.Context) {
+	var req vo.SecurityEventListRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	counts, err := sc.SecurityEventRepository.GetSecurityEventCounts(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get security events: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"counts": counts}, "Get security events successfully")
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/repository"
+	"github.com/esyede/goadmin/backend/response"
+	"github.com/esyede/goadmin/backend/vo"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/thoas/go-funk"
+)
+
+type IUserAttributeController interface {
+	GetUserAttributes(c *gin.Context)             // Get user attribute list
+	CreateUserAttribute(c *gin.Context)           // Create user attribute
+	UpdateUserAttributeById(c *gin.Context)       // Update user attribute
+	BatchDeleteUserAttributeByIds(c *gin.Context) // Delete user attributes in batches
+}
+
+type UserAttributeController struct {
+	UserAttributeRepository repository.IUserAttributeRepository
+}
+
+func NewUserAttributeController() IUserAttributeController {
+	userAttributeRepository := repository.NewUserAttributeRepository()
+	userAttributeController := UserAttributeController{UserAttributeRepository: userAttributeRepository}
+	return userAttributeController
+}
+
+// Get user attribute list
+func (ac UserAttributeController) GetUserAttributes(c *gin.Context) {
+	var req vo.UserAttributeListRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	attributes, total, err := ac.UserAttributeRepository.GetUserAttributes(&req)
+	if err != nil {
+		response.Fail(c, nil, "Failed to get user attribute list: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"attributes": attributes, "total": total}, "Obtaining user attribute list successfully")
+}
+
+// Create user attribute
+func (ac UserAttributeController) CreateUserAttribute(c *gin.Context) {
+	attribute, ok := ac.getReqAttribute(c)
+	if !ok {
+		return
+	}
+
+	err := ac.UserAttributeRepository.CreateUserAttribute(&attribute)
+	if err != nil {
+		response.Fail(c, nil, "Failed to create user attribute: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "User attribute created successfully")
+}
+
+// Update user attribute
+func (ac UserAttributeController) UpdateUserAttributeById(c *gin.Context) {
+	// Get attributeId in path
+	attributeId, _ := strconv.Atoi(c.Param("attributeId"))
+	if attributeId <= 0 {
+		response.Fail(c, nil, "Incorrect user attribute ID")
+		return
+	}
+	attributes, err := ac.UserAttributeRepository.GetUserAttributesByIds([]uint{uint(attributeId)})
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	if len(attributes) == 0 {
+		response.Fail(c, nil, "No user attribute information was obtained")
+		return
+	}
+
+	attribute, ok := ac.getReqAttribute(c)
+	if !ok {
+		return
+	}
+
+	err = ac.UserAttributeRepository.UpdateUserAttributeById(uint(attributeId), &attribute)
+	if err != nil {
+		response.Fail(c, nil, "Failed to update user attribute: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Update user attribute successfully")
+}
+
+// Delete user attributes in batches
+func (ac UserAttributeController) BatchDeleteUserAttributeByIds(c *gin.Context) {
+	var req vo.DeleteUserAttributeRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	attributes, err := ac.UserAttributeRepository.GetUserAttributesByIds(req.AttributeIds)
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain user attribute information: "+err.Error())
+		return
+	}
+	if len(attributes) == 0 {
+		response.Fail(c, nil, "No user attribute information was obtained")
+		return
+	}
+
+	err = ac.UserAttributeRepository.BatchDeleteUserAttributeByIds(req.AttributeIds)
+	if err != nil {
+		response.Fail(c, nil, "Failed to delete user attribute")
+		return
+	}
+	response.Success(c, nil, "User attribute deleted successfully")
+}
+
+// Bind and check an attribute definition, the response is written when it is not valid
+func (ac UserAttributeController) getReqAttribute(c *gin.Context) (model.UserAttribute, bool) {
+	var req vo.CreateUserAttributeRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return model.UserAttribute{}, false
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return model.UserAttribute{}, false
+	}
+	if req.Pattern != "" {
+		if _, err := regexp.Compile(req.Pattern); err != nil {
+			response.Fail(c, nil, "Invalid validation pattern: "+err.Error())
+			return model.UserAttribute{}, false
+		}
+	}
+	if req.Type == "enum" && len(req.Options) == 0 {
+		response.Fail(c, nil, "Enum attributes need at least one option")
+		return model.UserAttribute{}, false
+	}
+	if req.Type != "enum" {
+		req.Options = nil
+	}
+
+	// Get current user
+	ur := repository.NewUserRepository()
+	ctxUser, err := ur.GetCurrentUser(c)
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain current user information")
+		return model.UserAttribute{}, false
+	}
+
+	return model.UserAttribute{
+		Key:      req.Key,
+		Name:     req.Name,
+		Type:     req.Type,
+		Required: req.Required,
+		Pattern:  req.Pattern,
+		Options:  req.Options,
+		Sort:     req.Sort,
+		Status:   req.Status,
+		Creator:  ctxUser.Username,
+	}, true
+}
+
+// Validation tags of the attribute types, enum options are checked separately
+var userAttributeTypeTags = map[string]string{
+	"number":  "numeric",
+	"boolean": "oneof=true false",
+	"date":    "datetime=2006-01-02",
+}
+
+// Check a custom attribute value against its definition
+func checkAttributeValue(attribute *model.UserAttribute, value string) error {
+	if value == "" {
+		if attribute.Required {
+			return fmt.Errorf("%s is required", attribute.Name)
+		}
+		return nil
+	}
+	// Values of every type are stored in a varchar(255) column
+	if err := common.Validate.Var(value, "max=255"); err != nil {
+		return fmt.Errorf("%s must be at most 255 characters", attribute.Name)
+	}
+	if tag, ok := userAttributeTypeTags[attribute.Type]; ok {
+		if err := common.Validate.Var(value, tag); err != nil {
+			return fmt.Errorf("%s is not a valid %s value", attribute.Name, attribute.Type)
+		}
+	}
+	if attribute.Type == "enum" && !funk.ContainsString(attribute.Options, value) {
+		return fmt.Errorf("%s must be one of %s", attribute.Name, strings.Join(attribute.Options, ", "))
+	}
+	if attribute.Pattern != "" {
+		matched, err := regexp.MatchString(attribute.Pattern, value)
+		if err != nil || !matched {
+			return fmt.Errorf("%s has an invalid format", attribute.Name)
+		}
+	}
+	return nil
+}
+
+// Get the custom attribute values sent from the front end
+// Every enabled attribute is checked, so that required attributes cannot be left out; values of disabled attributes are ignored.
+// The returned errors are empty when all values are valid
+func getReqAttributeValues(reqAttributes map[string]string, definitions []*model.UserAttribute) ([]*model.UserAttributeValue, []string) {
+	values := make([]*model.UserAttributeValue, 0)
+	errs := make([]string, 0)
+	known := make(map[string]bool)
+	for _, attribute := range definitions {
+		known[attribute.Key] = true
+		if attribute.Status != 1 {
+			continue
+		}
+		value := strings.TrimSpace(reqAttributes[attribute.Key])
+		if err := checkAttributeValue(attribute, value); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if value != "" {
+			values = append(values, &model.UserAttributeValue{AttributeId: attribute.ID, Attribute: attribute, Value: value})
+		}
+	}
+	for key := range reqAttributes {
+		if !known[key] {
+			errs = append(errs, fmt.Sprintf("Unknown user attribute %s", key))
+		}
+	}
+	return values, errs
+}
+
+// Get the custom attribute values of a user to be saved, the values of disabled attributes in oldValues are kept
+func getUserAttributeValues(reqAttributes map[string]string, oldValues []*model.UserAttributeValue) ([]*model.UserAttributeValue, error) {
+	ar := repository.NewUserAttributeRepository()
+	definitions, err := ar.GetAllUserAttributes()
+	if err != nil {
+		return nil, errors.New("Failed to get user attributes: " + err.Error())
+	}
+	values, errs := getReqAttributeValues(reqAttributes, definitions)
+	if len(errs) > 0 {
+		return nil, errors.New(errs[0])
+	}
+	for _, old := range oldValues {
+		if old.Attribute != nil && old.Attribute.Status != 1 {
+			values = append(values, &model.UserAttributeValue{AttributeId: old.AttributeId, Attribute: old.Attribute, Value: old.Value})
+		}
+	}
+	return values, nil
+}
@@ -4,12 +4,29 @@ import (
 	"github.com/esyede/goadmin/backend/common"
 	"github.com/esyede/goadmin/backend/config"
 	"github.com/esyede/goadmin/backend/dto"
+	"github.com/esyede/goadmin/backend/middleware"
 	"github.com/esyede/goadmin/backend/model"
 	"github.com/esyede/goadmin/backend/repository"
 	"github.com/esyede/goadmin/backend/response"
 	"github.com/esyede/goadmin/backend/util"
 	"github.com/esyede/goadmin/backend/vo"
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -17,14 +34,28 @@ import (
 )
 
 type IUserController interface {
-	GetUserInfo(c *gin.Context)          // Get current logged in user information
-	GetUsers(c *gin.Context)             // Get user list
-	ChangePwd(c *gin.Context)            // Update user login password
-	CreateUser(c *gin.Context)           // Create user
-	UpdateUserById(c *gin.Context)       // update user
-	BatchDeleteUserByIds(c *gin.Context) // Delete users in batches
+	GetUserInfo(c *gin.Context)           // Get current logged in user information
+	GetUsers(c *gin.Context)              // Get user list
+	ChangePwd(c *gin.Context)             // Update user login password
+	CreateUser(c *gin.Context)            // Create user
+	UpdateUserById(c *gin.Context)        // update user
+	BatchDeleteUserByIds(c *gin.Context)  // Delete users in batches
+	BatchUpdateUserStatus(c *gin.Context) // Enable or disable users in batches
+	BatchUpdateUserRoles(c *gin.Context)  // Add and remove roles of users in batches
+	BatchResetPwd(c *gin.Context)         // Reset the passwords of users in batches, they have to be changed at the next login
+	ImportUsers(c *gin.Context)           // Import users from a csv or xlsx file
+	ExportUsers(c *gin.Context)           // Export the filtered user list as csv or xlsx
+	UpdateProfile(c *gin.Context)         // Update the current user's own profile
+	UploadAvatar(c *gin.Context)          // Upload the current user's avatar
+	ImpersonateUser(c *gin.Context)       // Issue a short-lived token to act as another user of a lower level
 }
 
+const (
+	userImportMaxFileSize = 5 << 20     // Maximum size of an import file
+	userImportMaxRows     = 5000        // Maximum number of users imported at a time
+	avatarMaxPixels       = 5000 * 5000 // Maximum dimensions of an uploaded avatar
+)
+
 type UserController struct {
 	UserRepository repository.IUserRepository
 }
@@ -44,8 +75,14 @@ func (uc UserController) GetUserInfo(c *gin.Context) {
 		return
 	}
 	userInfoDto := dto.ToUserInfoDto(user)
+	// Let the front end show that the session is an impersonation
+	if actor, ok := c.Get("actor"); ok {
+		actorUser := actor.(model.User)
+		userInfoDto.Impersonator = &dto.ImpersonatorDto{ID: actorUser.ID, Username: actorUser.Username}
+	}
 	response.Success(c, gin.H{
 		"userInfo": userInfoDto,
+		"locales":  common.Locales(),
 	}, "Obtain current user information successfully")
 }
 
@@ -59,11 +96,16 @@ func (uc UserController) GetUsers(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
 
+	// Custom attribute filters, sent as attributes[key]=value
+	if attributes := c.QueryMap("attributes"); len(attributes) > 0 {
+		req.Attributes = attributes
+	}
+
 	// Obtain
 	users, total, err := uc.UserRepository.GetUsers(&req)
 	if err != nil {
@@ -84,11 +126,17 @@ func (uc UserController) ChangePwd(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
 
+	// The password belongs to the impersonated user, not to the one behind the session
+	if _, ok := c.Get("actor"); ok {
+		response.Fail(c, nil, "The password cannot be changed while impersonating a user")
+		return
+	}
+
 	// The password sent from the front end is RSA encrypted, decrypt it first
 	// Password decrypted via RSA
 	decodeOldPassword, err := util.RSADecrypt([]byte(req.OldPassword), config.Conf.System.RSAPrivateBytes)
@@ -119,7 +167,7 @@ func (uc UserController) ChangePwd(c *gin.Context) {
 		return
 	}
 	// Update password
-	err = uc.UserRepository.ChangePwd(user.Username, util.GenPasswd(req.NewPassword))
+	err = uc.UserRepository.WithContext(c).ChangePwd(user.Username, util.GenPasswd(req.NewPassword))
 	if err != nil {
 		response.Fail(c, nil, "Failed to update password: "+err.Error())
 		return
@@ -137,7 +185,7 @@ func (uc UserController) CreateUser(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -194,19 +242,43 @@ func (uc UserController) CreateUser(c *gin.Context) {
 	if req.Password == "" {
 		req.Password = "123456"
 	}
+	// Get the departments of the user
+	departments, departmentId, err := getReqDepartments(&req)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Get the posts of the user
+	posts, err := getReqPosts(&req)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Get the custom attributes of the user
+	attributeValues, err := getUserAttributeValues(req.Attributes, nil)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
 	user := model.User{
-		Username:     req.Username,
-		Password:     util.GenPasswd(req.Password),
-		Mobile:       req.Mobile,
-		Avatar:       req.Avatar,
-		Nickname:     &req.Nickname,
-		Introduction: &req.Introduction,
-		Status:       req.Status,
-		Creator:      ctxUser.Username,
-		Roles:        roles,
+		Username:        req.Username,
+		Password:        util.GenPasswd(req.Password),
+		Mobile:          common.NormalizeMobile(req.Mobile),
+		Email:           reqEmail(req.Email),
+		Avatar:          req.Avatar,
+		Nickname:        &req.Nickname,
+		Introduction:    &req.Introduction,
+		Status:          req.Status,
+		Creator:         ctxUser.Username,
+		Roles:           roles,
+		DepartmentId:    departmentId,
+		Departments:     departments,
+		Posts:           posts,
+		AttributeValues: attributeValues,
 	}
 
-	err = uc.UserRepository.CreateUser(&user)
+	err = uc.UserRepository.WithContext(c).CreateUser(&user)
 	if err != nil {
 		response.Fail(c, nil, "Failed to create user: "+err.Error())
 		return
@@ -225,7 +297,7 @@ func (uc UserController) UpdateUserById(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -283,17 +355,47 @@ func (uc UserController) UpdateUserById(c *gin.Context) {
 	// The front end transmits the minimum value of user role sorting (the highest level role)
 	reqRoleSortMin := funk.MinInt(reqRoleSorts).(int)
 
+	// Get the departments of the user
+	departments, departmentId, err := getReqDepartments(&req)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Get the posts of the user
+	posts, err := getReqPosts(&req)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Get the custom attributes of the user
+	attributeValues, err := getUserAttributeValues(req.Attributes, oldUser.AttributeValues)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
 	user := model.User{
-		Model:        oldUser.Model,
-		Username:     req.Username,
-		Password:     oldUser.Password,
-		Mobile:       req.Mobile,
-		Avatar:       req.Avatar,
-		Nickname:     &req.Nickname,
-		Introduction: &req.Introduction,
-		Status:       req.Status,
-		Creator:      ctxUser.Username,
-		Roles:        roles,
+		Model:           oldUser.Model,
+		Username:        req.Username,
+		Password:        oldUser.Password,
+		Mobile:          common.NormalizeMobile(req.Mobile),
+		Email:           reqEmail(req.Email),
+		Avatar:          req.Avatar,
+		Nickname:        &req.Nickname,
+		Introduction:    &req.Introduction,
+		Status:          req.Status,
+		Locale:          oldUser.Locale,
+		MustChangePwd:   oldUser.MustChangePwd,
+		Creator:         ctxUser.Username,
+		Roles:           roles,
+		DepartmentId:    departmentId,
+		Departments:     departments,
+		Posts:           posts,
+		AttributeValues: attributeValues,
+	}
+	// A changed email has to be verified again
+	if user.Email != nil && oldUser.Email != nil && *user.Email == *oldUser.Email {
+		user.EmailVerifiedAt = oldUser.EmailVerifiedAt
 	}
 	// Determine whether to update yourself or update others
 	if userId == int(ctxUser.ID) {
@@ -354,7 +456,7 @@ func (uc UserController) UpdateUserById(c *gin.Context) {
 	}
 
 	// Update user
-	err = uc.UserRepository.UpdateUser(&user)
+	err = uc.UserRepository.WithContext(c).UpdateUser(&user)
 	if err != nil {
 		response.Fail(c, nil, "Update user failed: "+err.Error())
 		return
@@ -373,7 +475,7 @@ func (uc UserController) BatchDeleteUserByIds(c *gin.Context) {
 	}
 	// Parameter verification
 	if err := common.Validate.Struct(&req); err != nil {
-		errStr := err.(validator.ValidationErrors)[0].Translate(common.Trans)
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
 		response.Fail(c, nil, errStr)
 		return
 	}
@@ -409,7 +511,7 @@ func (uc UserController) BatchDeleteUserByIds(c *gin.Context) {
 		}
 	}
 
-	err = uc.UserRepository.BatchDeleteUserByIds(reqUserIds)
+	err = uc.UserRepository.WithContext(c).BatchDeleteUserByIds(reqUserIds)
 	if err != nil {
 		response.Fail(c, nil, "Failed to delete user: "+err.Error())
 		return
@@ -418,3 +520,877 @@ func (uc UserController) BatchDeleteUserByIds(c *gin.Context) {
 	response.Success(c, nil, "Delete user successfully")
 
 }
+
+// Enable or disable users in batches
+func (uc UserController) BatchUpdateUserStatus(c *gin.Context) {
+	var req vo.BatchUserStatusRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	_, users, results, err := uc.getBatchUsers(c, req.UserIds)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	err = uc.UserRepository.WithContext(c).BatchUpdateUserStatus(users, req.Status)
+	if err != nil {
+		response.Fail(c, nil, "Failed to update user status: "+err.Error())
+		return
+	}
+	setBatchUsersSucceeded(results, users)
+	response.Success(c, gin.H{"results": localizeBatchResults(c, results)}, "Update user status finished")
+}
+
+// Add and remove roles of users in batches
+func (uc UserController) BatchUpdateUserRoles(c *gin.Context) {
+	var req vo.BatchUserRolesRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+	if len(req.AddRoleIds) == 0 && len(req.RemoveRoleIds) == 0 {
+		response.Fail(c, nil, "No roles to add or remove")
+		return
+	}
+	if len(funk.Intersect(req.AddRoleIds, req.RemoveRoleIds).([]uint)) > 0 {
+		response.Fail(c, nil, "A role cannot be added and removed at the same time")
+		return
+	}
+
+	minSort, users, results, err := uc.getBatchUsers(c, req.UserIds)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// Users cannot give other users roles with a higher level than themselves or with the same level
+	addRoles := make([]*model.Role, 0)
+	if len(req.AddRoleIds) > 0 {
+		rr := repository.NewRoleRepository()
+		addRoles, err = rr.GetRolesByIds(req.AddRoleIds)
+		if err != nil {
+			response.Fail(c, nil, "Failed to obtain role information based on role ID: "+err.Error())
+			return
+		}
+		if len(addRoles) != len(funk.Uniq(req.AddRoleIds).([]uint)) {
+			response.Fail(c, nil, "Some roles do not exist")
+			return
+		}
+		for _, role := range addRoles {
+			if minSort >= role.Sort {
+				response.Fail(c, nil, "Users cannot give other users roles with a higher level than themselves or with the same level.")
+				return
+			}
+		}
+	}
+
+	updateUsers := make([]*model.User, 0, len(users))
+	for _, user := range users {
+		roles := make([]*model.Role, 0)
+		for _, role := range user.Roles {
+			if !funk.Contains(req.RemoveRoleIds, role.ID) && !funk.Contains(req.AddRoleIds, role.ID) {
+				roles = append(roles, role)
+			}
+		}
+		roles = append(roles, addRoles...)
+		// Users without roles cannot do anything, not even log in
+		if len(roles) == 0 {
+			setBatchUserFailed(results, user.ID, "Users must keep at least one role")
+			continue
+		}
+		user.Roles = roles
+		updateUsers = append(updateUsers, user)
+	}
+
+	err = uc.UserRepository.WithContext(c).BatchUpdateUserRoles(updateUsers)
+	if err != nil {
+		response.Fail(c, nil, "Failed to update user roles: "+err.Error())
+		return
+	}
+	setBatchUsersSucceeded(results, updateUsers)
+	response.Success(c, gin.H{"results": localizeBatchResults(c, results)}, "Update user roles finished")
+}
+
+// Reset the passwords of users in batches, they have to be changed at the next login
+func (uc UserController) BatchResetPwd(c *gin.Context) {
+	var req vo.BatchResetPwdRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	_, users, results, err := uc.getBatchUsers(c, req.UserIds)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	passwords := make(map[uint]string)
+	usersById := make(map[uint]*model.User)
+	for _, user := range users {
+		usersById[user.ID] = user
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			response.Fail(c, nil, err.Error())
+			return
+		}
+		passwords[user.ID] = hex.EncodeToString(b)
+		user.Password = util.GenPasswd(passwords[user.ID])
+	}
+
+	err = uc.UserRepository.WithContext(c).BatchResetPwd(users)
+	if err != nil {
+		response.Fail(c, nil, "Failed to reset passwords: "+err.Error())
+		return
+	}
+	setBatchUsersSucceeded(results, users)
+
+	// The temporary password is only returned when it cannot be sent to the user
+	for _, result := range results {
+		password, ok := passwords[result.ID]
+		if !ok {
+			continue
+		}
+		user := usersById[result.ID]
+		if user.Email == nil {
+			result.TemporaryPassword = password
+			result.Message = "The user has no email, pass the temporary password on to the user"
+			continue
+		}
+		err := common.Notifier.Send(common.Notification{
+			To:      *user.Email,
+			Subject: "Your password has been reset",
+			Body: fmt.Sprintf("Hello %s,\n\nYour password has been reset by an administrator. Your temporary password is:\n\n%s\n\nYou will be asked to change it after logging in.\n",
+				user.Username, password),
+		})
+		if err != nil {
+			result.TemporaryPassword = password
+			result.Message = "Sending the temporary password failed, pass it on to the user: " + err.Error()
+		}
+	}
+	response.Success(c, gin.H{"results": localizeBatchResults(c, results)}, "Reset passwords finished")
+}
+
+// Get the users of a batch action that the current user may manage, together with the current user's minimum role sorting.
+// Every requested user gets a result, the ones that cannot be managed are already marked as failed.
+func (uc UserController) getBatchUsers(c *gin.Context, ids []uint) (uint, []*model.User, []*dto.BatchUserResultDto, error) {
+	minSort, ctxUser, err := uc.UserRepository.GetCurrentUserMinRoleSort(c)
+	if err != nil {
+		return minSort, nil, nil, err
+	}
+
+	ids = funk.Uniq(ids).([]uint)
+	found, err := uc.UserRepository.GetUsersWithRolesByIds(ids)
+	if err != nil {
+		return minSort, nil, nil, err
+	}
+	usersById := make(map[uint]*model.User, len(found))
+	for _, user := range found {
+		usersById[user.ID] = user
+	}
+
+	users := make([]*model.User, 0, len(ids))
+	results := make([]*dto.BatchUserResultDto, 0, len(ids))
+	for _, id := range ids {
+		result := &dto.BatchUserResultDto{ID: id}
+		results = append(results, result)
+		user, ok := usersById[id]
+		if !ok {
+			result.Message = "The user does not exist"
+			continue
+		}
+		result.Username = user.Username
+		if user.ID == ctxUser.ID {
+			result.Message = "Users cannot apply batch actions to themselves"
+			continue
+		}
+		if user.Status == 3 {
+			result.Message = "The user has not accepted the invitation yet"
+			continue
+		}
+		// Users cannot manage users whose role level is higher than their own or of the same level,
+		// users left without roles have the lowest level
+		for _, role := range user.Roles {
+			if minSort >= role.Sort {
+				result.Message = "Users cannot manage users whose role level is higher than their own or of the same level"
+				break
+			}
+		}
+		if result.Message != "" {
+			continue
+		}
+		users = append(users, user)
+	}
+	return minSort, users, results, nil
+}
+
+// Mark the results of users a batch action was applied to as successful
+func setBatchUsersSucceeded(results []*dto.BatchUserResultDto, users []*model.User) {
+	for _, user := range users {
+		for _, result := range results {
+			if result.ID == user.ID {
+				result.Success = true
+				result.Message = ""
+			}
+		}
+	}
+}
+
+// Translate the messages of batch action results into the locale of the request
+func localizeBatchResults(c *gin.Context, results []*dto.BatchUserResultDto) []*dto.BatchUserResultDto {
+	for _, result := range results {
+		result.Message = common.T(common.Locale(c), result.Message)
+	}
+	return results
+}
+
+// Mark the result of a user as failed
+func setBatchUserFailed(results []*dto.BatchUserResultDto, id uint, message string) {
+	for _, result := range results {
+		if result.ID == id {
+			result.Message = message
+		}
+	}
+}
+
+// Get the departments sent from the front end and check that the primary department is one of them
+func getReqDepartments(req *vo.CreateUserRequest) ([]*model.Department, *uint, error) {
+	departmentId := req.DepartmentId
+	departments := make([]*model.Department, 0)
+	if len(req.DepartmentIds) > 0 {
+		dr := repository.NewDepartmentRepository()
+		list, err := dr.GetDepartmentsByIds(req.DepartmentIds)
+		if err != nil {
+			return nil, nil, errors.New("Failed to obtain department information based on department ID: " + err.Error())
+		}
+		if len(list) != len(funk.Uniq(req.DepartmentIds).([]uint)) {
+			return nil, nil, errors.New("Some departments do not exist")
+		}
+		departments = list
+	}
+	if departmentId != 0 && !funk.Contains(req.DepartmentIds, departmentId) {
+		return nil, nil, errors.New("The primary department must be one of the user's departments")
+	}
+	// Default the primary department to the first one
+	if departmentId == 0 && len(req.DepartmentIds) > 0 {
+		departmentId = req.DepartmentIds[0]
+	}
+	return departments, &departmentId, nil
+}
+
+// Get the posts sent from the front end, all of them must exist
+func getReqPosts(req *vo.CreateUserRequest) ([]*model.Post, error) {
+	posts := make([]*model.Post, 0)
+	if len(req.PostIds) == 0 {
+		return posts, nil
+	}
+	pr := repository.NewPostRepository()
+	posts, err := pr.GetPostsByIds(req.PostIds)
+	if err != nil {
+		return nil, errors.New("Failed to obtain post information based on post ID: " + err.Error())
+	}
+	if len(posts) != len(funk.Uniq(req.PostIds).([]uint)) {
+		return nil, errors.New("Some posts do not exist")
+	}
+	return posts, nil
+}
+
+// Emails are stored in lower case, an empty email is stored as null so that it does not collide with the unique index
+func reqEmail(email string) *string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil
+	}
+	return &email
+}
+
+// Import users from a csv or xlsx file
+func (uc UserController) ImportUsers(c *gin.Context) {
+	var req vo.ImportUsersRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// Read the uploaded file
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		response.Fail(c, nil, "Please upload a csv or xlsx file")
+		return
+	}
+	if fileHeader.Size > userImportMaxFileSize {
+		response.Fail(c, nil, fmt.Sprintf("The file cannot be larger than %d MB", userImportMaxFileSize>>20))
+		return
+	}
+	rows, err := readImportRows(fileHeader)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	if len(rows) < 2 {
+		response.Fail(c, nil, "The file has no data rows")
+		return
+	}
+	if len(rows)-1 > userImportMaxRows {
+		response.Fail(c, nil, fmt.Sprintf("At most %d users can be imported at a time", userImportMaxRows))
+		return
+	}
+
+	// The first row is the header, columns are matched by name so that their order does not matter
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"username", "mobile", "roles"} {
+		if _, ok := columns[name]; !ok {
+			response.Fail(c, nil, fmt.Sprintf("Missing column %s", name))
+			return
+		}
+	}
+	cell := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(util.UnescapeFormula(row[i]))
+	}
+
+	// The current user role sorting minimum value (the highest level role) and the current user
+	currentRoleSortMin, ctxUser, err := uc.UserRepository.GetCurrentUserMinRoleSort(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// Roles are referenced by keyword in the file
+	rr := repository.NewRoleRepository()
+	allRoles, _, err := rr.GetRoles(&vo.RoleListRequest{})
+	if err != nil {
+		response.Fail(c, nil, "Failed to get role list: "+err.Error())
+		return
+	}
+	rolesByKeyword := make(map[string]*model.Role)
+	for i := range allRoles {
+		rolesByKeyword[allRoles[i].Keyword] = &allRoles[i]
+	}
+
+	// Custom attributes are read from the columns named after their keys
+	ar := repository.NewUserAttributeRepository()
+	attributeDefinitions, err := ar.GetAllUserAttributes()
+	if err != nil {
+		response.Fail(c, nil, "Failed to get user attributes: "+err.Error())
+		return
+	}
+
+	// Usernames, mobiles and emails already taken in the database
+	var usernames, mobiles, emails []string
+	for _, row := range rows[1:] {
+		usernames = append(usernames, cell(row, "username"))
+		mobiles = append(mobiles, common.NormalizeMobile(cell(row, "mobile")))
+		if email := reqEmail(cell(row, "email")); email != nil {
+			emails = append(emails, *email)
+		}
+	}
+	existUsers, err := uc.UserRepository.GetUsersByUsernamesMobilesOrEmails(usernames, mobiles, emails)
+	if err != nil {
+		response.Fail(c, nil, "Failed to check existing users: "+err.Error())
+		return
+	}
+	takenUsernames := make(map[string]bool)
+	takenMobiles := make(map[string]bool)
+	takenEmails := make(map[string]bool)
+	for _, user := range existUsers {
+		takenUsernames[user.Username] = true
+		takenMobiles[user.Mobile] = true
+		if user.Email != nil {
+			takenEmails[*user.Email] = true
+		}
+	}
+
+	report := dto.ImportUsersDto{DryRun: req.DryRun, Rows: make([]dto.ImportUserRowDto, 0)}
+	users := make([]*model.User, 0)
+	for i, row := range rows[1:] {
+		result := dto.ImportUserRowDto{Row: i + 2, Username: cell(row, "username"), Errors: make([]string, 0)}
+
+		userReq := vo.CreateUserRequest{
+			Username:     cell(row, "username"),
+			Password:     cell(row, "password"),
+			Mobile:       cell(row, "mobile"),
+			Email:        cell(row, "email"),
+			Avatar:       cell(row, "avatar"),
+			Nickname:     cell(row, "nickname"),
+			Introduction: cell(row, "introduction"),
+			Status:       1,
+		}
+		if status := cell(row, "status"); status != "" {
+			// An unparsable status becomes 0 and is rejected by the validator
+			s, _ := strconv.Atoi(status)
+			userReq.Status = uint(s)
+		}
+
+		// Get roles based on the role keywords, separated by comma or semicolon
+		roles := make([]*model.Role, 0)
+		keywords := strings.FieldsFunc(cell(row, "roles"), func(r rune) bool { return r == ',' || r == ';' })
+		for _, keyword := range keywords {
+			role, ok := rolesByKeyword[strings.TrimSpace(keyword)]
+			if !ok {
+				result.Errors = append(result.Errors, fmt.Sprintf("Role %s does not exist", strings.TrimSpace(keyword)))
+				continue
+			}
+			roles = append(roles, role)
+			userReq.RoleIds = append(userReq.RoleIds, role.ID)
+		}
+
+		// Same rules as creating a single user
+		if err := common.Validate.Struct(&userReq); err != nil {
+			for _, e := range err.(validator.ValidationErrors) {
+				result.Errors = append(result.Errors, e.Translate(common.GetTrans(c)))
+			}
+		}
+		// Custom attributes follow their definitions
+		attributes := make(map[string]string)
+		for _, attribute := range attributeDefinitions {
+			if value := cell(row, strings.ToLower(attribute.Key)); value != "" {
+				attributes[attribute.Key] = value
+			}
+		}
+		attributeValues, attributeErrs := getReqAttributeValues(attributes, attributeDefinitions)
+		result.Errors = append(result.Errors, attributeErrs...)
+		// If the password is empty, the default is 123456
+		if userReq.Password == "" {
+			userReq.Password = "123456"
+		}
+		if len(userReq.Password) < 6 {
+			result.Errors = append(result.Errors, "Password length must be at least 6 characters")
+		}
+		// Users cannot create users with a higher level than themselves or with the same level
+		if len(roles) > 0 {
+			var reqRoleSorts []int
+			for _, role := range roles {
+				reqRoleSorts = append(reqRoleSorts, int(role.Sort))
+			}
+			if currentRoleSortMin >= uint(funk.MinInt(reqRoleSorts).(int)) {
+				result.Errors = append(result.Errors, "Users cannot create users with a higher level than themselves or with the same level.")
+			}
+		}
+		// Usernames, mobiles and emails must be unique, both in the database and within the file
+		mobile := common.NormalizeMobile(userReq.Mobile)
+		email := reqEmail(userReq.Email)
+		if userReq.Username != "" && takenUsernames[userReq.Username] {
+			result.Errors = append(result.Errors, fmt.Sprintf("Username %s already exists", userReq.Username))
+		}
+		if mobile != "" && takenMobiles[mobile] {
+			result.Errors = append(result.Errors, fmt.Sprintf("Mobile %s already exists", userReq.Mobile))
+		}
+		if email != nil && takenEmails[*email] {
+			result.Errors = append(result.Errors, fmt.Sprintf("Email %s already exists", *email))
+		}
+		takenUsernames[userReq.Username] = true
+		takenMobiles[mobile] = true
+		if email != nil {
+			takenEmails[*email] = true
+		}
+
+		// Row errors are shown to the user like response messages
+		for i, e := range result.Errors {
+			result.Errors[i] = common.T(common.Locale(c), e)
+		}
+		report.Rows = append(report.Rows, result)
+		if len(result.Errors) > 0 {
+			report.Invalid++
+			continue
+		}
+		report.Valid++
+		users = append(users, &model.User{
+			Username:        userReq.Username,
+			Password:        util.GenPasswd(userReq.Password),
+			Mobile:          mobile,
+			Email:           email,
+			Avatar:          userReq.Avatar,
+			Nickname:        &userReq.Nickname,
+			Introduction:    &userReq.Introduction,
+			Status:          userReq.Status,
+			Creator:         ctxUser.Username,
+			Roles:           roles,
+			AttributeValues: attributeValues,
+		})
+	}
+	report.Total = len(rows) - 1
+
+	// Only the report is returned in dry-run mode
+	if !req.DryRun && len(users) > 0 {
+		err = uc.UserRepository.WithContext(c).BatchCreateUsers(users)
+		if err != nil {
+			response.Fail(c, gin.H{"report": report}, "Failed to import users: "+err.Error())
+			return
+		}
+		report.Imported = len(users)
+	}
+	if req.DryRun {
+		response.Success(c, gin.H{"report": report}, "Import checked")
+		return
+	}
+	response.Success(c, gin.H{"report": report}, "Import users successfully")
+}
+
+// Export the filtered user list as csv or xlsx
+func (uc UserController) ExportUsers(c *gin.Context) {
+	var req vo.ExportUsersRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Custom attributes follow the fixed columns, one column per attribute key
+	ar := repository.NewUserAttributeRepository()
+	attributeDefinitions, err := ar.GetAllUserAttributes()
+	if err != nil {
+		response.Fail(c, nil, "Failed to get user attributes: "+err.Error())
+		return
+	}
+	// Custom attribute filters, sent as attributes[key]=value
+	if attributes := c.QueryMap("attributes"); len(attributes) > 0 {
+		req.Attributes = attributes
+	}
+
+	header := []string{"username", "mobile", "email", "nickname", "introduction", "avatar", "status", "roles", "creator", "createdAt"}
+	for _, attribute := range attributeDefinitions {
+		header = append(header, attribute.Key)
+	}
+	toRow := func(user *model.User) []string {
+		keywords := make([]string, 0)
+		for _, role := range user.Roles {
+			keywords = append(keywords, role.Keyword)
+		}
+		var email, nickname, introduction string
+		if user.Email != nil {
+			email = *user.Email
+		}
+		if user.Nickname != nil {
+			nickname = *user.Nickname
+		}
+		if user.Introduction != nil {
+			introduction = *user.Introduction
+		}
+		row := []string{
+			user.Username,
+			user.Mobile,
+			email,
+			nickname,
+			introduction,
+			user.Avatar,
+			strconv.Itoa(int(user.Status)),
+			strings.Join(keywords, ","),
+			user.Creator,
+			user.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+		attributes := dto.ToAttributeMap(user.AttributeValues)
+		for _, attribute := range attributeDefinitions {
+			row = append(row, attributes[attribute.Key])
+		}
+		// Users enter most of these values themselves, they must not become formulas in a spreadsheet
+		for i := range row {
+			row[i] = util.EscapeFormula(row[i])
+		}
+		return row
+	}
+
+	filename := fmt.Sprintf("users-%s", time.Now().Format("20060102150405"))
+	if req.Format == "xlsx" {
+		// xlsx is a zip archive and has to be assembled before it can be written
+		rows := [][]string{header}
+		err := uc.UserRepository.ExportUsers(&req.UserListRequest, func(users []*model.User) error {
+			for _, user := range users {
+				rows = append(rows, toRow(user))
+			}
+			return nil
+		})
+		if err != nil {
+			response.Fail(c, nil, "Failed to export users: "+err.Error())
+			return
+		}
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.xlsx", filename))
+		if err := util.WriteXlsx(c.Writer, rows); err != nil {
+			common.Log.Errorf("Failed to write user export: %v", err)
+		}
+		return
+	}
+
+	// csv is streamed batch by batch
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(header)
+	err = uc.UserRepository.ExportUsers(&req.UserListRequest, func(users []*model.User) error {
+		for _, user := range users {
+			if err := w.Write(toRow(user)); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	})
+	w.Flush()
+	if err != nil {
+		// The header has already been sent, the error can only be logged
+		common.Log.Errorf("Failed to export users: %v", err)
+	}
+}
+
+// Read all rows of an uploaded csv or xlsx file
+func readImportRows(fileHeader *multipart.FileHeader) ([][]string, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open the uploaded file: %v", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".csv":
+		r := csv.NewReader(file)
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse csv file: %v", err)
+		}
+		// Strip the utf-8 BOM written by spreadsheet programs
+		if len(rows) > 0 && len(rows[0]) > 0 {
+			rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+		}
+		return rows, nil
+	case ".xlsx":
+		return util.ReadXlsxRows(file, fileHeader.Size)
+	default:
+		return nil, errors.New("Only csv and xlsx files are supported")
+	}
+}
+
+// Update the current user's own profile
+func (uc UserController) UpdateProfile(c *gin.Context) {
+	var req vo.UpdateProfileRequest
+	// Parameter binding
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Parameter verification
+	if err := common.Validate.Struct(&req); err != nil {
+		errStr := err.(validator.ValidationErrors)[0].Translate(common.GetTrans(c))
+		response.Fail(c, nil, errStr)
+		return
+	}
+
+	// Get current user
+	ctxUser, err := uc.UserRepository.GetCurrentUser(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	// Only the caller's own non-privileged fields, roles, status and password are left untouched
+	user := model.User{
+		Model:        ctxUser.Model,
+		Username:     ctxUser.Username,
+		Mobile:       common.NormalizeMobile(req.Mobile),
+		Email:        reqEmail(req.Email),
+		Nickname:     &req.Nickname,
+		Introduction: &req.Introduction,
+		Locale:       req.Locale,
+	}
+	// A changed email has to be verified again
+	if user.Email != nil && ctxUser.Email != nil && *user.Email == *ctxUser.Email {
+		user.EmailVerifiedAt = ctxUser.EmailVerifiedAt
+	}
+	err = uc.UserRepository.WithContext(c).UpdateProfile(&user)
+	if err != nil {
+		response.Fail(c, nil, "Failed to update profile: "+err.Error())
+		return
+	}
+	response.Success(c, nil, "Profile updated successfully")
+}
+
+// Upload the current user's avatar
+func (uc UserController) UploadAvatar(c *gin.Context) {
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		response.Fail(c, nil, "Please upload an image")
+		return
+	}
+	maxSize := config.Conf.Upload.AvatarMaxSize << 20
+	if fileHeader.Size > maxSize {
+		response.Fail(c, nil, fmt.Sprintf("The avatar cannot be larger than %d MB", config.Conf.Upload.AvatarMaxSize))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		response.Fail(c, nil, "Failed to open the uploaded file: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	// Check the real content type, the file name and the header sent by the client cannot be trusted
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	contentType := http.DetectContentType(head[:n])
+	if !funk.ContainsString([]string{"image/jpeg", "image/png", "image/gif"}, contentType) {
+		response.Fail(c, nil, "Only jpeg, png and gif images are supported")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	// Reject huge dimensions before decoding the whole image into memory
+	imgConfig, _, err := image.DecodeConfig(file)
+	if err != nil {
+		response.Fail(c, nil, "Failed to read the image: "+err.Error())
+		return
+	}
+	if imgConfig.Width*imgConfig.Height > avatarMaxPixels {
+		response.Fail(c, nil, "The image dimensions are too large")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		response.Fail(c, nil, "Failed to read the image: "+err.Error())
+		return
+	}
+
+	// Crop to a square and scale it to the configured size
+	size := config.Conf.Upload.AvatarSize
+	avatar := util.CropResize(img, size, size)
+	var buf bytes.Buffer
+	ext := "png"
+	if contentType == "image/jpeg" {
+		ext = "jpg"
+		err = jpeg.Encode(&buf, avatar, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(&buf, avatar)
+	}
+	if err != nil {
+		response.Fail(c, nil, "Failed to process the image: "+err.Error())
+		return
+	}
+
+	// Get current user
+	ctxUser, err := uc.UserRepository.GetCurrentUser(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+
+	url, err := common.Storage.Save(fmt.Sprintf("avatar/%d-%d.%s", ctxUser.ID, time.Now().UnixNano(), ext), &buf)
+	if err != nil {
+		response.Fail(c, nil, "Failed to save the avatar: "+err.Error())
+		return
+	}
+	oldAvatar := ctxUser.Avatar
+	ctxUser.Avatar = url
+	err = uc.UserRepository.WithContext(c).UpdateAvatar(&ctxUser)
+	if err != nil {
+		_ = common.Storage.Delete(url)
+		response.Fail(c, nil, "Failed to update avatar: "+err.Error())
+		return
+	}
+	// The previous avatar is no longer referenced
+	if err := common.Storage.Delete(oldAvatar); err != nil {
+		common.Log.Warnf("Failed to delete old avatar %s: %v", oldAvatar, err)
+	}
+	response.Success(c, gin.H{"avatar": url}, "Avatar updated successfully")
+}
+
+// Issue a short-lived token to act as another user of a lower level
+func (uc UserController) ImpersonateUser(c *gin.Context) {
+	// Impersonation sessions cannot be chained
+	if _, ok := c.Get("actor"); ok {
+		response.Fail(c, nil, "Users cannot impersonate while impersonating")
+		return
+	}
+	// Get userId in path
+	userId, _ := strconv.Atoi(c.Param("userId"))
+	if userId <= 0 {
+		response.Fail(c, nil, "Incorrect user ID")
+		return
+	}
+
+	// The current user role sorting minimum value (the highest level role) and the current user
+	currentRoleSortMin, ctxUser, err := uc.UserRepository.GetCurrentUserMinRoleSort(c)
+	if err != nil {
+		response.Fail(c, nil, err.Error())
+		return
+	}
+	if uint(userId) == ctxUser.ID {
+		response.Fail(c, nil, "Users cannot impersonate themselves")
+		return
+	}
+
+	user, err := uc.UserRepository.GetUserById(uint(userId))
+	if err != nil {
+		response.Fail(c, nil, "Failed to obtain the user to impersonate: "+err.Error())
+		return
+	}
+	if user.Status != 1 {
+		response.Fail(c, nil, "Only users in normal status can be impersonated")
+		return
+	}
+
+	// Only users of a strictly lower level can be impersonated
+	roleMinSortList, err := uc.UserRepository.GetUserMinRoleSortsByIds([]uint{user.ID})
+	if err != nil || len(roleMinSortList) == 0 {
+		response.Fail(c, nil, "Failed to obtain user role sorting minimum value based on user ID")
+		return
+	}
+	if int(currentRoleSortMin) >= roleMinSortList[0] {
+		response.Fail(c, nil, "Users cannot impersonate users whose role level is higher than or equal to their own")
+		return
+	}
+
+	token, expires, err := middleware.GenerateImpersonationToken(user, ctxUser)
+	if err != nil {
+		response.Fail(c, nil, "Failed to issue impersonation token: "+err.Error())
+		return
+	}
+	common.Log.Infof("User %s started impersonating user %s", ctxUser.Username, user.Username)
+	response.Success(c, gin.H{
+		"token":   token,
+		"expires": expires.Format("2006-01-02 15:04:05"),
+	}, "Impersonation started")
+}
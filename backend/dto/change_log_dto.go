@@ -0,0 +1,38 @@
+package dto
+
+import (
+	"github.com/esyede/goadmin/backend/model"
+	"encoding/json"
+	"time"
+)
+
+// Change of a record with its changed fields decoded
+type ChangeLogDto struct {
+	ID           uint                `json:"ID"`
+	CreatedAt    time.Time           `json:"createdAt"`
+	EntityType   string              `json:"entityType"`
+	EntityId     uint                `json:"entityId"`
+	Action       string              `json:"action"`
+	Actor        string              `json:"actor"`
+	Impersonator string              `json:"impersonator"`
+	Changes      []model.FieldChange `json:"changes"`
+}
+
+func ToChangeLogsDto(logs []model.ChangeLog) []ChangeLogDto {
+	var dtos []ChangeLogDto
+	for _, log := range logs {
+		changes := make([]model.FieldChange, 0)
+		_ = json.Unmarshal([]byte(log.Changes), &changes)
+		dtos = append(dtos, ChangeLogDto{
+			ID:           log.ID,
+			CreatedAt:    log.CreatedAt,
+			EntityType:   log.EntityType,
+			EntityId:     log.EntityId,
+			Action:       log.Action,
+			Actor:        log.Actor,
+			Impersonator: log.Impersonator,
+			Changes:      changes,
+		})
+	}
+	return dtos
+}
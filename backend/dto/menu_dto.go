@@ -0,0 +1,126 @@
+package dto
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
+	"fmt"
+	"sort"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v2"
+)
+
+// Menu file, the menus and the roles they are bound to
+type MenuFileDto struct {
+	Menus []*MenuYamlDto `yaml:"menus"`
+}
+
+// Menu in a menu file, menus are identified by their names instead of their IDs
+type MenuYamlDto struct {
+	Name       string            `yaml:"name" validate:"required,min=1,max=50,checkUnreserved"`
+	Title      string            `yaml:"title" validate:"required,min=1,max=50"`
+	Titles     map[string]string `yaml:"titles,omitempty" validate:"dive,keys,checkLocale,endkeys,max=50"`
+	Icon       string            `yaml:"icon,omitempty" validate:"max=50"`
+	Path       string            `yaml:"path" validate:"required,min=1,max=100"`
+	Redirect   string            `yaml:"redirect,omitempty" validate:"max=100"`
+	Component  string            `yaml:"component" validate:"required,min=1,max=100"`
+	Sort       uint              `yaml:"sort" validate:"gte=1,lte=999"`
+	Status     uint              `yaml:"status" validate:"oneof=1 2"`
+	Hidden     uint              `yaml:"hidden" validate:"oneof=1 2"`
+	NoCache    uint              `yaml:"noCache" validate:"oneof=1 2"`
+	AlwaysShow uint              `yaml:"alwaysShow" validate:"oneof=1 2"`
+	Breadcrumb uint              `yaml:"breadcrumb" validate:"oneof=1 2"`
+	ActiveMenu string            `yaml:"activeMenu,omitempty" validate:"max=100"`
+	Roles      []string          `yaml:"roles,omitempty" validate:"dive,min=1,max=20"` // Keywords of the roles the menu is bound to
+	Children   []*MenuYamlDto    `yaml:"children,omitempty" validate:"-"`
+}
+
+// Change an import makes to a menu
+type MenuDiffDto struct {
+	Name   string   `json:"name"`
+	Action string   `json:"action"` // create, update or delete
+	Fields []string `json:"fields"` // Changed fields of updated menus
+}
+
+// Parse and check a menu file, omitted fields get the same defaults as in the database.
+// Validation errors are translated with trans.
+func ParseMenuYaml(data []byte, trans ut.Translator) ([]*MenuYamlDto, error) {
+	var file MenuFileDto
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("Not a valid menu file: %v", err)
+	}
+	names := make(map[string]bool)
+	if err := checkMenuYaml(file.Menus, names, trans); err != nil {
+		return nil, err
+	}
+	return file.Menus, nil
+}
+
+func checkMenuYaml(menus []*MenuYamlDto, names map[string]bool, trans ut.Translator) error {
+	for _, menu := range menus {
+		if menu == nil {
+			return fmt.Errorf("Not a valid menu file: empty menu")
+		}
+		if menu.Sort == 0 {
+			menu.Sort = 999
+		}
+		if menu.Status == 0 {
+			menu.Status = 1
+		}
+		if menu.Hidden == 0 {
+			menu.Hidden = 2
+		}
+		if menu.NoCache == 0 {
+			menu.NoCache = 2
+		}
+		if menu.AlwaysShow == 0 {
+			menu.AlwaysShow = 2
+		}
+		if menu.Breadcrumb == 0 {
+			menu.Breadcrumb = 1
+		}
+		if err := common.Validate.Struct(menu); err != nil {
+			return fmt.Errorf("Menu %s: %s", menu.Name, err.(validator.ValidationErrors)[0].Translate(trans))
+		}
+		if names[menu.Name] {
+			return fmt.Errorf("Menu name %s is used more than once", menu.Name)
+		}
+		names[menu.Name] = true
+		if err := checkMenuYaml(menu.Children, names, trans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Menu tree in the form of a menu file, roles are referred to by their keywords
+func ToMenuYamlDto(menus []*model.Menu) []*MenuYamlDto {
+	menuYamls := make([]*MenuYamlDto, 0, len(menus))
+	for _, menu := range menus {
+		roles := make([]string, 0, len(menu.Roles))
+		for _, role := range menu.Roles {
+			roles = append(roles, role.Keyword)
+		}
+		sort.Strings(roles)
+		menuYamls = append(menuYamls, &MenuYamlDto{
+			Name:       menu.Name,
+			Title:      menu.Title,
+			Titles:     menu.Titles,
+			Icon:       derefString(menu.Icon),
+			Path:       menu.Path,
+			Redirect:   derefString(menu.Redirect),
+			Component:  menu.Component,
+			Sort:       menu.Sort,
+			Status:     menu.Status,
+			Hidden:     menu.Hidden,
+			NoCache:    menu.NoCache,
+			AlwaysShow: menu.AlwaysShow,
+			Breadcrumb: menu.Breadcrumb,
+			ActiveMenu: derefString(menu.ActiveMenu),
+			Roles:      roles,
+			Children:   ToMenuYamlDto(menu.Children),
+		})
+	}
+	return menuYamls
+}
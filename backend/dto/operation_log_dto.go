@@ -0,0 +1,63 @@
+package dto
+
+// Result of verifying the hash chain of the operation logs
+type OperationLogChainDto struct {
+	Intact   bool   `json:"intact"`
+	Checked  int64  `json:"checked"`  // Number of chained logs that were checked
+	HeadHash string `json:"headHash"` // Hash of the newest log, recording it elsewhere also detects deleted newest logs
+	BrokenId uint   `json:"brokenId"` // First log whose link is broken
+	Reason   string `json:"reason"`
+}
+
+// Number of operation logs in a time bucket, errors are responses with a status of 400 or more
+type OperationLogTrafficDto struct {
+	Time   string `json:"time"`
+	Count  int64  `json:"count"`
+	Errors int64  `json:"errors"`
+}
+
+type OperationLogTopUserDto struct {
+	Username string `json:"username"`
+	Count    int64  `json:"count"`
+	Errors   int64  `json:"errors"`
+}
+
+// Requests and time costs (ms) of an endpoint
+type OperationLogPathStatsDto struct {
+	Method      string  `json:"method"`
+	Path        string  `json:"path"`
+	Count       int64   `json:"count"`
+	Errors      int64   `json:"errors"`
+	AvgTimeCost float64 `json:"avgTimeCost"`
+	P50TimeCost int64   `json:"p50TimeCost"`
+	P95TimeCost int64   `json:"p95TimeCost"`
+	MaxTimeCost int64   `json:"maxTimeCost"`
+}
+
+type OperationLogStatusDto struct {
+	Status int   `json:"status"`
+	Count  int64 `json:"count"`
+}
+
+type OperationLogIpCountDto struct {
+	Ip    string `json:"ip"`
+	Count int64  `json:"count"`
+}
+
+// Failed logins by time bucket and the addresses they came from most
+type OperationLogLoginFailuresDto struct {
+	Trend  []OperationLogTrafficDto `json:"trend"`
+	TopIps []OperationLogIpCountDto `json:"topIps"`
+}
+
+// Number of operation logs with a browser, operating system or device type, empty names are unknown user agents
+type OperationLogNameCountDto struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type OperationLogClientStatsDto struct {
+	Browsers    []OperationLogNameCountDto `json:"browsers"`
+	Systems     []OperationLogNameCountDto `json:"systems"`
+	DeviceTypes []OperationLogNameCountDto `json:"deviceTypes"`
+}
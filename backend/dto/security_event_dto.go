@@ -0,0 +1,7 @@
+package dto
+
+// Number of security events of a type
+type SecurityEventCountDto struct {
+	Type  string `json:"type"`
+	Count int64  `json:"count"`
+}
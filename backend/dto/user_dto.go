@@ -4,60 +4,165 @@ import "github.com/esyede/goadmin/backend/model"
 
 // Return the current user information to the front end
 type UserInfoDto struct {
-	ID           uint          `json:"id"`
-	Username     string        `json:"username"`
-	Mobile       string        `json:"mobile"`
-	Avatar       string        `json:"avatar"`
-	Nickname     string        `json:"nickname"`
-	Introduction string        `json:"introduction"`
-	Roles        []*model.Role `json:"roles"`
+	ID            uint                `json:"id"`
+	Username      string              `json:"username"`
+	Mobile        string              `json:"mobile"`
+	Email         string              `json:"email"`
+	EmailVerified bool                `json:"emailVerified"`
+	Avatar        string              `json:"avatar"`
+	Nickname      string              `json:"nickname"`
+	Introduction  string              `json:"introduction"`
+	Roles         []*model.Role       `json:"roles"`
+	DepartmentId  uint                `json:"departmentId"`
+	Departments   []*model.Department `json:"departments"`
+	Posts         []*model.Post       `json:"posts"`
+	Attributes    map[string]string   `json:"attributes"`
+	Locale        string              `json:"locale"`        // Preferred locale, empty to follow the browser
+	MustChangePwd bool                `json:"mustChangePwd"` // The password was reset and has to be changed before anything else
+	Impersonator  *ImpersonatorDto    `json:"impersonator"`  // Real user of an impersonation session, null otherwise
+}
+
+// Real user of an impersonation session
+type ImpersonatorDto struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
 }
 
 func ToUserInfoDto(user model.User) UserInfoDto {
 	return UserInfoDto{
-		ID:           user.ID,
-		Username:     user.Username,
-		Mobile:       user.Mobile,
-		Avatar:       user.Avatar,
-		Nickname:     *user.Nickname,
-		Introduction: *user.Introduction,
-		Roles:        user.Roles,
+		ID:            user.ID,
+		Username:      user.Username,
+		Mobile:        user.Mobile,
+		Email:         derefString(user.Email),
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Avatar:        user.Avatar,
+		Nickname:      *user.Nickname,
+		Introduction:  *user.Introduction,
+		Roles:         user.Roles,
+		DepartmentId:  derefUint(user.DepartmentId),
+		Departments:   user.Departments,
+		Posts:         user.Posts,
+		Attributes:    ToAttributeMap(user.AttributeValues),
+		Locale:        user.Locale,
+		MustChangePwd: user.MustChangePwd,
 	}
 }
 
 // Return the user list to the front end
 type UsersDto struct {
-	ID           uint   `json:"ID"`
-	Username     string `json:"username"`
-	Mobile       string `json:"mobile"`
-	Avatar       string `json:"avatar"`
-	Nickname     string `json:"nickname"`
-	Introduction string `json:"introduction"`
-	Status       uint   `json:"status"`
-	Creator      string `json:"creator"`
-	RoleIds      []uint `json:"roleIds"`
+	ID            uint              `json:"ID"`
+	Username      string            `json:"username"`
+	Mobile        string            `json:"mobile"`
+	Email         string            `json:"email"`
+	EmailVerified bool              `json:"emailVerified"`
+	Avatar        string            `json:"avatar"`
+	Nickname      string            `json:"nickname"`
+	Introduction  string            `json:"introduction"`
+	Status        uint              `json:"status"`
+	Creator       string            `json:"creator"`
+	RoleIds       []uint            `json:"roleIds"`
+	DepartmentId  uint              `json:"departmentId"`
+	DepartmentIds []uint            `json:"departmentIds"`
+	PostIds       []uint            `json:"postIds"`
+	Posts         []PostDto         `json:"posts"`
+	Attributes    map[string]string `json:"attributes"`
+}
+
+// Post summary returned with the user list
+type PostDto struct {
+	ID   uint   `json:"ID"`
+	Code string `json:"code"`
+	Name string `json:"name"`
 }
 
 func ToUsersDto(userList []*model.User) []UsersDto {
 	var users []UsersDto
 	for _, user := range userList {
 		userDto := UsersDto{
-			ID:           user.ID,
-			Username:     user.Username,
-			Mobile:       user.Mobile,
-			Avatar:       user.Avatar,
-			Nickname:     *user.Nickname,
-			Introduction: *user.Introduction,
-			Status:       user.Status,
-			Creator:      user.Creator,
+			ID:            user.ID,
+			Username:      user.Username,
+			Mobile:        user.Mobile,
+			Email:         derefString(user.Email),
+			EmailVerified: user.EmailVerifiedAt != nil,
+			Avatar:        user.Avatar,
+			Nickname:      *user.Nickname,
+			Introduction:  *user.Introduction,
+			Status:        user.Status,
+			Creator:       user.Creator,
+			DepartmentId:  derefUint(user.DepartmentId),
+			Attributes:    ToAttributeMap(user.AttributeValues),
 		}
 		roleIds := make([]uint, 0)
 		for _, role := range user.Roles {
 			roleIds = append(roleIds, role.ID)
 		}
 		userDto.RoleIds = roleIds
+		departmentIds := make([]uint, 0)
+		for _, department := range user.Departments {
+			departmentIds = append(departmentIds, department.ID)
+		}
+		userDto.DepartmentIds = departmentIds
+		postIds := make([]uint, 0)
+		posts := make([]PostDto, 0)
+		for _, post := range user.Posts {
+			postIds = append(postIds, post.ID)
+			posts = append(posts, PostDto{ID: post.ID, Code: post.Code, Name: post.Name})
+		}
+		userDto.PostIds = postIds
+		userDto.Posts = posts
 		users = append(users, userDto)
 	}
 
 	return users
 }
+
+// Custom attribute values by attribute key
+func ToAttributeMap(values []*model.UserAttributeValue) map[string]string {
+	attributes := make(map[string]string)
+	for _, value := range values {
+		if value.Attribute != nil {
+			attributes[value.Attribute.Key] = value.Value
+		}
+	}
+	return attributes
+}
+
+func derefUint(p *uint) uint {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func derefString(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// Result of importing a single row
+type ImportUserRowDto struct {
+	Row      int      `json:"row"`
+	Username string   `json:"username"`
+	Errors   []string `json:"errors"`
+}
+
+// Return the user import report to the front end
+type ImportUsersDto struct {
+	DryRun   bool               `json:"dryRun"`
+	Total    int                `json:"total"`
+	Valid    int                `json:"valid"`
+	Invalid  int                `json:"invalid"`
+	Imported int                `json:"imported"`
+	Rows     []ImportUserRowDto `json:"rows"`
+}
+
+// Result of a batch action on a single user
+type BatchUserResultDto struct {
+	ID                uint   `json:"ID"`
+	Username          string `json:"username"`
+	Success           bool   `json:"success"`
+	Message           string `json:"message"`
+	TemporaryPassword string `json:"temporaryPassword,omitempty"` // Only when it could not be sent to the user
+}
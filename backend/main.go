@@ -3,10 +3,11 @@ package main
 import (
 	"github.com/esyede/goadmin/backend/common"
 	"github.com/esyede/goadmin/backend/config"
-	"github.com/esyede/goadmin/backend/middleware"
 	"github.com/esyede/goadmin/backend/repository"
 	"github.com/esyede/goadmin/backend/routes"
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -16,23 +17,43 @@ import (
 )
 
 func main() {
+	verifyOperationLogs := flag.Bool("verify-operation-logs", false, "verify the hash chain of the operation logs and exit")
+	flag.Parse()
+
 	config.InitConfig()
 	common.InitLogger()
 	common.InitMysql()
+	if *verifyOperationLogs {
+		os.Exit(verifyOperationLogChain())
+	}
 	common.InitCasbinEnforcer()
+	common.InitI18n()
 	common.InitValidate()
+	common.InitStorage()
+	common.InitNotifier()
+	common.InitIpLocation()
 	common.InitData()
+	repository.InitMenuData()
 
+	// Operation logs are queued by the middleware and written to the database in the background
 	logRepository := repository.NewOperationLogRepository()
+	logRepository.StartOperationLogPipeline()
+	// Delete old operation logs by the retention policy
+	go logRepository.RunOperationLogRetentionSchedule()
+	// Calculate the hourly statistics of the operation logs for the dashboard
+	statsRepository := repository.NewOperationLogStatsRepository()
+	go statsRepository.RunOperationLogRollupSchedule()
 
-	for i := 0; i < 3; i++ {
-		go logRepository.SaveOperationLogChannel(middleware.OperationLogChan)
-	}
+	// Permanently delete records that stayed in the recycle bin longer than the retention period
+	recycleBinRepository := repository.NewRecycleBinRepository()
+	go recycleBinRepository.RunPurgeSchedule()
 
 	r := routes.InitRoutes()
 	host := "localhost"
 	port := config.Conf.System.Port
 	srv := &http.Server{Addr: fmt.Sprintf("%s:%d", host, port), Handler: r}
+	// Live tails of the operation logs never end by themselves, they are closed so that shutting down does not wait for them
+	srv.RegisterOnShutdown(logRepository.CloseOperationLogSubscriptions)
 
 	// Initializing the server in a goroutine so that
 	// it won't block the graceful shutdown handling below
@@ -46,7 +67,7 @@ func main() {
 
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 5 seconds.
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall.SIGKILL but can't be catch, so don't need add it
@@ -60,9 +81,32 @@ func main() {
 
 	defer cancel()
 
+	// Shutdown stops waiting for running requests after the timeout, the queued operation logs are written all the same
 	if err := srv.Shutdown(ctx); err != nil {
-		common.Log.Fatal("Server forced to shutdown:", err)
+		common.Log.Errorf("Server forced to shutdown: %v", err)
+	}
+
+	// No more requests come in, write the queued operation logs, spooling the ones the database does not take in time
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer drainCancel()
+	if err := logRepository.DrainOperationLogs(drainCtx); err != nil {
+		common.Log.Errorf("Not all operation logs were written to the database, the rest is spooled: %v", err)
 	}
 
 	common.Log.Info("Server exiting!")
 }
+
+// Print the verification report of the operation log hash chain, the exit code is 1 when the chain is broken
+func verifyOperationLogChain() int {
+	report, err := repository.NewOperationLogRepository().VerifyOperationLogs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to verify operation logs: %v\n", err)
+		return 2
+	}
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(output))
+	if !report.Intact {
+		return 1
+	}
+	return 0
+}
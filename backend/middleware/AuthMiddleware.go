@@ -8,6 +8,8 @@ import (
 	"github.com/esyede/goadmin/backend/response"
 	"github.com/esyede/goadmin/backend/util"
 	"github.com/esyede/goadmin/backend/vo"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,9 +17,23 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// The jwt middleware created by InitAuth, used to issue impersonation tokens
+var authMiddleware *jwt.GinJWTMiddleware
+
+// Context key set by login, its failures are recorded there and not again as rejected tokens
+const loginAttemptKey = "loginAttempt"
+
+// Requests without any token are not worth a security event
+var emptyTokenErrors = map[string]bool{
+	jwt.ErrEmptyAuthHeader.Error():  true,
+	jwt.ErrEmptyQueryToken.Error():  true,
+	jwt.ErrEmptyCookieToken.Error(): true,
+	jwt.ErrEmptyParamToken.Error():  true,
+}
+
 // Initialize jwt middleware
 func InitAuth() (*jwt.GinJWTMiddleware, error) {
-	authMiddleware, err := jwt.New(&jwt.GinJWTMiddleware{
+	mw, err := jwt.New(&jwt.GinJWTMiddleware{
 		Realm:           config.Conf.Jwt.Realm,                                 // jwt realm
 		Key:             []byte(config.Conf.Jwt.Key),                           // Server key
 		Timeout:         time.Hour * time.Duration(config.Conf.Jwt.Timeout),    // Token expiration time
@@ -34,7 +50,8 @@ func InitAuth() (*jwt.GinJWTMiddleware, error) {
 		TokenHeadName:   "Bearer",                                              // header name
 		TimeFunc:        time.Now,
 	})
-	return authMiddleware, err
+	authMiddleware = mw
+	return mw, err
 }
 
 // payload processing
@@ -43,10 +60,16 @@ func payloadFunc(data interface{}) jwt.MapClaims {
 		var user model.User
 		// Convert user json to structure
 		util.JsonI2Struct(v["user"], &user)
-		return jwt.MapClaims{
+		claims := jwt.MapClaims{
 			jwt.IdentityKey: user.ID,
 			"user":          v["user"],
 		}
+		// The real user behind an impersonation token
+		if actor, ok := v["actor"]; ok {
+			claims["actor"] = actor
+			claims["impersonation_exp"] = v["impersonation_exp"]
+		}
+		return claims
 	}
 	return jwt.MapClaims{}
 }
@@ -57,22 +80,28 @@ func identityHandler(c *gin.Context) interface{} {
 	// The return value type map[string]interface{} here must be consistent with the data type of payloadFunc and authorizator,
 	// otherwise it will cause authorization failure and it is not easy to find the reason.
 	return map[string]interface{}{
-		"IdentityKey": claims[jwt.IdentityKey],
-		"user":        claims["user"],
+		"IdentityKey":       claims[jwt.IdentityKey],
+		"user":              claims["user"],
+		"actor":             claims["actor"],
+		"impersonation_exp": claims["impersonation_exp"],
 	}
 }
 
 // Verify the correctness of the token and process login logic
 func login(c *gin.Context) (interface{}, error) {
+	c.Set(loginAttemptKey, true)
 	var req vo.RegisterAndLoginRequest
+	securityEventRepository := repository.NewSecurityEventRepository()
 	// Request json binding
 	if err := c.ShouldBind(&req); err != nil {
+		securityEventRepository.RecordLoginFailure(c, req.Username, err.Error(), false)
 		return "", err
 	}
 
 	// Password decrypted via RSA
 	decodeData, err := util.RSADecrypt([]byte(req.Password), config.Conf.System.RSAPrivateBytes)
 	if err != nil {
+		securityEventRepository.RecordLoginFailure(c, req.Username, err.Error(), false)
 		return nil, err
 	}
 
@@ -84,9 +113,24 @@ func login(c *gin.Context) (interface{}, error) {
 	// Password verification
 	userRepository := repository.NewUserRepository()
 	user, err := userRepository.Login(u)
+	// The user is known when the password is wrong, locked accounts are refused even with the right one
+	account := req.Username
+	if user != nil {
+		account = user.Username
+	}
+	if lockErr := securityEventRepository.CheckLoginLockout(c.ClientIP(), account); lockErr != nil {
+		securityEventRepository.RecordLoginFailure(c, account, lockErr.Error(), false)
+		return nil, repository.ErrLoginFailed
+	}
 	if err != nil {
+		securityEventRepository.RecordLoginFailure(c, account, err.Error(), true)
+		// Unknown accounts and wrong passwords get the same answer as locked accounts
+		if errors.Is(err, repository.ErrUserNotFound) || errors.Is(err, repository.ErrWrongPassword) {
+			return nil, repository.ErrLoginFailed
+		}
 		return nil, err
 	}
+	securityEventRepository.RecordLoginSuccess(c, user.Username)
 	// Write the user in json format, which will be used by payloadFunc/authorizator
 	return map[string]interface{}{
 		"user": util.Struct2Json(user),
@@ -102,14 +146,53 @@ func authorizator(data interface{}, c *gin.Context) bool {
 		util.Json2Struct(userStr, &user)
 		// Save the user to the context, it is convenient to retrieve the data when calling the api
 		c.Set("user", user)
+		// Impersonation tokens carry the real user, they stop working after their own expiration time,
+		// which is kept when the token is refreshed
+		if actorStr, ok := v["actor"].(string); ok {
+			exp, ok := v["impersonation_exp"].(float64)
+			if !ok || int64(exp) < time.Now().Unix() {
+				return false
+			}
+			var actor model.User
+			util.Json2Struct(actorStr, &actor)
+			c.Set("actor", actor)
+		}
 		return true
 	}
 	return false
 }
 
+// Issue a token that lets actor act as user, for at most the configured impersonation timeout
+func GenerateImpersonationToken(user model.User, actor model.User) (string, time.Time, error) {
+	timeout := config.Conf.Jwt.ImpersonationTimeout
+	if timeout <= 0 {
+		timeout = 30
+	}
+	expire := time.Now().Add(time.Duration(timeout) * time.Minute)
+	// Only the identity of the actor is needed
+	actorIdentity := model.User{Username: actor.Username}
+	actorIdentity.ID = actor.ID
+	token, tokenExpire, err := authMiddleware.TokenGenerator(map[string]interface{}{
+		"user":              util.Struct2Json(user),
+		"actor":             util.Struct2Json(actorIdentity),
+		"impersonation_exp": expire.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if tokenExpire.Before(expire) {
+		expire = tokenExpire
+	}
+	return token, expire, nil
+}
+
 // Handling user login verification failure
 func unauthorized(c *gin.Context, code int, message string) {
 	common.Log.Debugf("JWT authentication failed, error code: %d, message: %s", code, message)
+	// Invalid, expired and forged tokens, and impersonations that ran out
+	if !c.GetBool(loginAttemptKey) && !emptyTokenErrors[message] {
+		repository.NewSecurityEventRepository().RecordSecurityEvent(c, &model.SecurityEvent{Type: model.SecurityEventTokenInvalid, Reason: message})
+	}
 	response.Response(c, code, code, nil, fmt.Sprintf("JWT authentication failed, error code: %d, message: %s", code, message))
 }
 
@@ -125,11 +208,18 @@ func loginResponse(c *gin.Context, code int, token string, expires time.Time) {
 
 // Response after logging out
 func logoutResponse(c *gin.Context, code int) {
+	// Logging out does not need a valid token, only the logouts of known users are recorded
+	if claims, err := authMiddleware.GetClaimsFromJWT(c); err == nil {
+		recordTokenEvent(c, model.SecurityEventLogout, claims)
+	}
 	response.Success(c, nil, "Log out succeeful")
 }
 
 // Response after refreshing token
 func refreshResponse(c *gin.Context, code int, token string, expires time.Time) {
+	if t, err := authMiddleware.ParseTokenString(token); err == nil {
+		recordTokenEvent(c, model.SecurityEventTokenRefresh, jwt.ExtractClaimsFromToken(t))
+	}
 	response.Response(c, code, code,
 		gin.H{
 			"token":   token,
@@ -137,3 +227,16 @@ func refreshResponse(c *gin.Context, code int, token string, expires time.Time)
 		},
 		"Refresh token successful")
 }
+
+// Record a security event of the user and the real user behind an impersonation in the claims of a token
+func recordTokenEvent(c *gin.Context, eventType string, claims jwt.MapClaims) {
+	event := &model.SecurityEvent{Type: eventType}
+	var user, actor model.User
+	if userStr, ok := claims["user"].(string); ok && json.Unmarshal([]byte(userStr), &user) == nil {
+		event.Username = user.Username
+	}
+	if actorStr, ok := claims["actor"].(string); ok && json.Unmarshal([]byte(actorStr), &actor) == nil {
+		event.Impersonator = actor.Username
+	}
+	repository.NewSecurityEventRepository().RecordSecurityEvent(c, event)
+}
@@ -3,16 +3,25 @@ package middleware
 import (
 	"github.com/esyede/goadmin/backend/common"
 	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/model"
 	"github.com/esyede/goadmin/backend/repository"
 	"github.com/esyede/goadmin/backend/response"
 	"strings"
 	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/thoas/go-funk"
 )
 
 var checkLock sync.Mutex
 
+// Paths still available to users whose password was reset, everything they need to change it
+var mustChangePwdPaths = []string{
+	"/user/info",
+	"/menu/access/tree/:userId",
+	"/user/changePwd",
+}
+
 // Casbin middleware, RBAC-based permission access control model
 func CasbinMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -24,10 +33,15 @@ func CasbinMiddleware() gin.HandlerFunc {
 			return
 		}
 		if user.Status != 1 {
+			recordPermissionDenied(c, "The current user has been disabled")
 			response.Response(c, 401, 401, nil, "The current user has been disabled")
 			c.Abort()
 			return
 		}
+		// The user's preferred locale wins over the browser's
+		if user.Locale != "" && common.IsSupportedLocale(user.Locale) {
+			c.Set("locale", user.Locale)
+		}
 		// Get all roles of the user
 		roles := user.Roles
 		// Get the keywords of all the user's roles that are not disabled
@@ -43,8 +57,24 @@ func CasbinMiddleware() gin.HandlerFunc {
 		// 获取请求方式
 		act := c.Request.Method
 
+		// Users whose password was reset have to change it first, the actor of an impersonation cannot change it and is let through
+		if _, impersonating := c.Get("actor"); user.MustChangePwd && !impersonating {
+			if !funk.ContainsString(mustChangePwdPaths, obj) {
+				recordPermissionDenied(c, "The password has been reset and must be changed first")
+				response.Response(c, 403, 403, nil, "The password has been reset and must be changed first")
+				c.Abort()
+				return
+			}
+			// Changing the password is the only way out, so it does not depend on the role permissions
+			if obj == "/user/changePwd" {
+				c.Next()
+				return
+			}
+		}
+
 		isPass := check(subs, obj, act)
 		if !isPass {
+			recordPermissionDenied(c, "Permission denied")
 			response.Response(c, 401, 401, nil, "Permission denied")
 			c.Abort()
 			return
@@ -54,6 +84,14 @@ func CasbinMiddleware() gin.HandlerFunc {
 	}
 }
 
+// Record the attempted path and method of a denied request
+func recordPermissionDenied(c *gin.Context, reason string) {
+	repository.NewSecurityEventRepository().RecordSecurityEvent(c, &model.SecurityEvent{
+		Type:   model.SecurityEventPermissionDenied,
+		Reason: reason,
+	})
+}
+
 func check(subs []string, obj string, act string) bool {
 	// Only one request is allowed to perform verification at the same time, otherwise the verification may fail.
 	checkLock.Lock()
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// I18n middleware, picks the locale of the response messages from the Accept-Language header.
+// CasbinMiddleware replaces it with the preference of the logged in user.
+func I18nMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("locale", common.NegotiateLocale(c.GetHeader("Accept-Language")))
+		c.Next()
+	}
+}
@@ -4,20 +4,48 @@ import (
 	"github.com/esyede/goadmin/backend/config"
 	"github.com/esyede/goadmin/backend/model"
 	"github.com/esyede/goadmin/backend/repository"
+	"github.com/esyede/goadmin/backend/util"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Operation log channel
-var OperationLogChan = make(chan *model.OperationLog, 30)
+// The recorded request parameters and response body are stored in text columns
+const operationLogMaxBodySize = 60000
+
+// The user agent is stored in a varchar(255) column, cut off before the "..." so that it fits
+const operationLogMaxUserAgentSize = 252
 
 func OperationLogMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Starting time
 		startTime := time.Now()
 
+		logConf := config.Conf.OperationLog
+		maxBodySize := logConf.MaxBodySize
+		if maxBodySize <= 0 || maxBodySize > operationLogMaxBodySize {
+			maxBodySize = operationLogMaxBodySize
+		}
+		var reqBody []byte
+		var writer *bodyLogWriter
+		if logConf.CaptureBody {
+			// The body can only be read once, so it is put back for the handler
+			contentType := c.ContentType()
+			if c.Request.Body != nil && (contentType == gin.MIMEJSON || contentType == gin.MIMEPOSTForm) {
+				reqBody, _ = ioutil.ReadAll(c.Request.Body)
+				c.Request.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+			}
+			writer = &bodyLogWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}, limit: maxBodySize}
+			c.Writer = writer
+		}
+
 		// handle the request
 		c.Next()
 
@@ -38,6 +66,11 @@ func OperationLogMiddleware() gin.HandlerFunc {
 			username = "Not logged in"
 		}
 		username = user.Username
+		// The real user behind an impersonation session
+		var impersonator string
+		if actor, ok := c.Get("actor"); ok {
+			impersonator = actor.(model.User).Username
+		}
 
 		// Get access path
 		path := strings.TrimPrefix(c.FullPath(), "/"+config.Conf.System.UrlPathPrefix)
@@ -49,20 +82,138 @@ func OperationLogMiddleware() gin.HandlerFunc {
 		apiDesc, _ := apiRepository.GetApiDescByPath(path, method)
 
 		operationLog := model.OperationLog{
-			Username:   username,
-			Ip:         c.ClientIP(),
-			IpLocation: "",
-			Method:     method,
-			Path:       path,
-			Desc:       apiDesc,
-			Status:     c.Writer.Status(),
-			StartTime:  startTime,
-			TimeCost:   timeCost,
-			// UserAgent:  c.Request.UserAgent(),
+			Username:     username,
+			Impersonator: impersonator,
+			Ip:           c.ClientIP(),
+			IpLocation:   "", // Located by the log pipeline, outside of the request
+			Method:       method,
+			Path:         path,
+			Desc:         apiDesc,
+			Status:       c.Writer.Status(),
+			StartTime:    startTime,
+			TimeCost:     timeCost,
+			// Cut off here, the stored value is the one the audit hash is calculated over
+			UserAgent: truncateLog(c.Request.UserAgent(), operationLogMaxUserAgentSize),
+		}
+		if writer != nil {
+			operationLog.Params = requestParams(c, reqBody, logConf.RedactFields, maxBodySize)
+			if writer.body.Len() > 0 {
+				response := util.RedactJson(writer.body.Bytes(), logConf.RedactFields)
+				if writer.truncated {
+					response += "..."
+				}
+				operationLog.Response = truncateLog(response, maxBodySize)
+			}
 		}
 
 		// It is best to send the logs to rabbitmq or kafka
-		// Here it is sent to the channel and three goroutine processing are enabled.
-		OperationLogChan <- &operationLog
+		// Here they are queued without waiting and written to the database in batches by the pipeline
+		repository.NewOperationLogRepository().EnqueueOperationLog(&operationLog)
+	}
+}
+
+// Keeps a copy of the json written to the response, up to a limit
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body      *bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *bodyLogWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyLogWriter) capture(b []byte) {
+	// Downloaded files are not worth recording
+	if !strings.Contains(w.Header().Get("Content-Type"), "json") {
+		return
+	}
+	room := w.limit - w.body.Len()
+	if len(b) > room {
+		w.truncated = true
+		if room > 0 {
+			w.body.Write(b[:room])
+		}
+		return
+	}
+	w.body.Write(b)
+}
+
+// Query, path and body parameters of a request as json, with sensitive fields redacted.
+// Files of multipart requests are left out, only their other fields are recorded.
+func requestParams(c *gin.Context, body []byte, redactFields []string, limit int) string {
+	params := make(map[string]interface{})
+	if len(c.Params) > 0 {
+		pathParams := make(map[string]interface{}, len(c.Params))
+		for _, param := range c.Params {
+			pathParams[param.Key] = param.Value
+		}
+		params["path"] = pathParams
+	}
+	if query := c.Request.URL.Query(); len(query) > 0 {
+		params["query"] = valuesToMap(query)
+	}
+	switch {
+	case len(body) > 0 && c.ContentType() == gin.MIMEJSON:
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err == nil {
+			params["body"] = value
+		} else {
+			// Sensitive fields of a body that cannot be parsed cannot be redacted either
+			params["body"] = fmt.Sprintf("<invalid json, %d bytes>", len(body))
+		}
+	case len(body) > 0:
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			params["body"] = valuesToMap(values)
+		}
+	case c.Request.MultipartForm != nil && len(c.Request.MultipartForm.Value) > 0:
+		params["body"] = valuesToMap(c.Request.MultipartForm.Value)
+	}
+	if len(params) == 0 {
+		return ""
+	}
+
+	str, err := util.MarshalJson(util.RedactValue(params, redactFields))
+	if err != nil {
+		return ""
+	}
+	return truncateLog(str, limit)
+}
+
+// Fields with a single value are recorded as strings
+func valuesToMap(values map[string][]string) map[string]interface{} {
+	m := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if len(value) == 1 {
+			m[key] = value[0]
+			continue
+		}
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = item
+		}
+		m[key] = items
+	}
+	return m
+}
+
+// Cut off a string at limit bytes without splitting a character
+func truncateLog(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
 	}
+	return s[:cut] + "..."
 }
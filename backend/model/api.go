@@ -4,9 +4,10 @@ import "gorm.io/gorm"
 
 type Api struct {
 	gorm.Model
-	Method   string `gorm:"type:varchar(20);comment:'Request method'" json:"method"`
-	Path     string `gorm:"type:varchar(100);comment:'Access path'" json:"path"`
-	Category string `gorm:"type:varchar(50);comment:'Category'" json:"category"`
-	Desc     string `gorm:"type:varchar(100);comment:'Description'" json:"desc"`
-	Creator  string `gorm:"type:varchar(20);comment:'Creator'" json:"creator"`
+	Method   string      `gorm:"type:varchar(20);comment:'Request method'" json:"method"`
+	Path     string      `gorm:"type:varchar(100);comment:'Access path'" json:"path"`
+	Category string      `gorm:"type:varchar(50);comment:'Category'" json:"category"`
+	Desc     string      `gorm:"type:varchar(100);comment:'Description'" json:"desc"`
+	Descs    LocaleTexts `gorm:"type:text;comment:'Descriptions in other locales (json)'" json:"descs"`
+	Creator  string      `gorm:"type:varchar(20);comment:'Creator'" json:"creator"`
 }
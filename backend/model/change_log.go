@@ -0,0 +1,21 @@
+package model
+
+import "gorm.io/gorm"
+
+// Change of a user, role, menu or api with the fields before and after, recorded by the change history callbacks
+type ChangeLog struct {
+	gorm.Model
+	EntityType   string `gorm:"type:varchar(20);index:idx_change_entity;comment:'Entity type (user, role, menu, api)'" json:"entityType"`
+	EntityId     uint   `gorm:"index:idx_change_entity;comment:'Entity ID'" json:"entityId"`
+	Action       string `gorm:"type:varchar(20);comment:'Action (create, update, delete, restore, purge)'" json:"action"`
+	Actor        string `gorm:"type:varchar(20);comment:'Username of the user who made the change, empty for the system'" json:"actor"`
+	Impersonator string `gorm:"type:varchar(20);comment:'Real user when the change was made through impersonation'" json:"impersonator"`
+	Changes      string `gorm:"type:text;comment:'Changed fields (json, sensitive fields masked)'" json:"changes"`
+}
+
+// Value of a field before and after a change, nil when the record did not exist
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
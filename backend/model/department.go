@@ -0,0 +1,17 @@
+package model
+
+import "gorm.io/gorm"
+
+type Department struct {
+	gorm.Model
+	Name     string        `gorm:"type:varchar(50);not null;comment:'Department name'" json:"name"`
+	Code     string        `gorm:"type:varchar(50);not null;unique;comment:'Department code'" json:"code"`
+	Desc     *string       `gorm:"type:varchar(100);comment:'Description'" json:"desc"`
+	Sort     uint          `gorm:"type:int(3) unsigned;default:999;comment:'Department order (1-999)'" json:"sort"`
+	Status   uint          `gorm:"type:tinyint(1);default:1;comment:'1 normal, 2 disabled'" json:"status"`
+	ParentId *uint         `gorm:"default:0;comment:'Parent department number (0 means the root department)'" json:"parentId"`
+	Creator  string        `gorm:"type:varchar(20);comment:'Creator'" json:"creator"`
+	Children []*Department `gorm:"-" json:"children"`                            // Sub-department collection
+	Users    []*User       `gorm:"many2many:user_departments;" json:"users"`     // Department member many-to-many relationship
+	Leaders  []*User       `gorm:"many2many:department_leaders;" json:"leaders"` // Department leader many-to-many relationship
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// Texts by locale stored as a json object, e.g. the titles of a menu in other locales
+type LocaleTexts map[string]string
+
+func (t LocaleTexts) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+func (t *LocaleTexts) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*t = LocaleTexts{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.New("Unsupported type for LocaleTexts")
+	}
+	if len(b) == 0 {
+		*t = LocaleTexts{}
+		return nil
+	}
+	return json.Unmarshal(b, t)
+}
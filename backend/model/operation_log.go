@@ -8,14 +8,22 @@ import (
 
 type OperationLog struct {
 	gorm.Model
-	Username   string    `gorm:"type:varchar(20);comment:'Username'" json:"username"`
-	Ip         string    `gorm:"type:varchar(20);comment:'IP address'" json:"ip"`
-	IpLocation string    `gorm:"type:varchar(20);comment:'IP location'" json:"ipLocation"`
-	Method     string    `gorm:"type:varchar(20);comment:'Request method'" json:"method"`
-	Path       string    `gorm:"type:varchar(100);comment:'Access path'" json:"path"`
-	Desc       string    `gorm:"type:varchar(100);comment:'Description'" json:"desc"`
-	Status     int       `gorm:"type:int(4);comment:'Response status code'" json:"status"`
-	StartTime  time.Time `gorm:"type:datetime(3);comment:'Start time'" json:"startTime"`
-	TimeCost   int64     `gorm:"type:int(6);comment:'Request time (ms)'" json:"timeCost"`
-	UserAgent  string    `gorm:"type:varchar(20);comment:'User agent'" json:"userAgent"`
+	Username     string    `gorm:"type:varchar(20);comment:'Username'" json:"username"`
+	Impersonator string    `gorm:"type:varchar(20);comment:'Real user when the request was made through impersonation'" json:"impersonator"`
+	Ip           string    `gorm:"type:varchar(50);comment:'IP address'" json:"ip"`
+	IpLocation   string    `gorm:"type:varchar(50);comment:'IP location'" json:"ipLocation"`
+	Method       string    `gorm:"type:varchar(20);index:idx_operation_logs_path_time,priority:2;comment:'Request method'" json:"method"`
+	Path         string    `gorm:"type:varchar(100);index:idx_operation_logs_path_time,priority:1;comment:'Access path'" json:"path"`
+	Desc         string    `gorm:"type:varchar(100);comment:'Description'" json:"desc"`
+	Status       int       `gorm:"type:int(4);index;comment:'Response status code'" json:"status"`
+	StartTime    time.Time `gorm:"type:datetime(3);index;comment:'Start time'" json:"startTime"`
+	TimeCost     int64     `gorm:"type:int(6);index;index:idx_operation_logs_path_time,priority:3;comment:'Request time (ms)'" json:"timeCost"`
+	UserAgent    string    `gorm:"type:varchar(255);comment:'User agent'" json:"userAgent"`
+	Browser      string    `gorm:"type:varchar(30);index;comment:'Browser or client parsed from the user agent'" json:"browser"`
+	Os           string    `gorm:"type:varchar(30);index;comment:'Operating system parsed from the user agent'" json:"os"`
+	DeviceType   string    `gorm:"type:varchar(10);index;comment:'Device type parsed from the user agent (desktop, mobile, tablet, bot)'" json:"deviceType"`
+	Params       string    `gorm:"type:text;index:idx_operation_logs_body,class:FULLTEXT;comment:'Request parameters (json, sensitive fields redacted)'" json:"params"`
+	Response     string    `gorm:"type:text;index:idx_operation_logs_body,class:FULLTEXT;comment:'Response body (sensitive fields redacted)'" json:"response"`
+	PrevHash     string    `gorm:"type:varchar(64);comment:'Hash of the previous log in audit mode'" json:"prevHash"`
+	Hash         string    `gorm:"type:varchar(64);comment:'Hash of this log chained to the previous one in audit mode'" json:"hash"`
 }
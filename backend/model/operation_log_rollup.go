@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Hourly statistics of operation logs, calculated again by the rollup job while late logs may still arrive
+type OperationLogRollup struct {
+	ID          uint      `gorm:"primarykey" json:"ID"`
+	Bucket      time.Time `gorm:"type:datetime;index;comment:'Start of the hour'" json:"bucket"`
+	Method      string    `gorm:"type:varchar(20);comment:'Request method'" json:"method"`
+	Path        string    `gorm:"type:varchar(100);comment:'Access path'" json:"path"`
+	Status      int       `gorm:"type:int(4);comment:'Response status code'" json:"status"`
+	Username    string    `gorm:"type:varchar(20);comment:'Username'" json:"username"`
+	Count       int64     `gorm:"comment:'Number of requests'" json:"count"`
+	TimeCostSum int64     `gorm:"comment:'Sum of the request times (ms)'" json:"timeCostSum"`
+	TimeCostMax int64     `gorm:"comment:'Longest request time (ms)'" json:"timeCostMax"`
+	Histogram   string    `gorm:"type:varchar(255);comment:'Number of requests per request time bucket, comma separated'" json:"histogram"`
+}
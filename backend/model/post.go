@@ -0,0 +1,14 @@
+package model
+
+import "gorm.io/gorm"
+
+type Post struct {
+	gorm.Model
+	Code    string  `gorm:"type:varchar(50);not null;unique;comment:'Post code'" json:"code"`
+	Name    string  `gorm:"type:varchar(50);not null;unique;comment:'Post name'" json:"name"`
+	Desc    *string `gorm:"type:varchar(100);comment:'Description'" json:"desc"`
+	Sort    uint    `gorm:"type:int(3);default:999;comment:'Post order (1-999)'" json:"sort"`
+	Status  uint    `gorm:"type:tinyint(1);default:1;comment:'1 normal, 2 disabled'" json:"status"`
+	Creator string  `gorm:"type:varchar(20);comment:'Creator'" json:"creator"`
+	Users   []*User `gorm:"many2many:user_posts" json:"users"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "gorm.io/gorm"
+
+// Snapshot of what was detached from a soft-deleted record, used to restore it from the recycle bin
+type RecycleRecord struct {
+	gorm.Model
+	EntityType   string `gorm:"type:varchar(20);index:idx_recycle_entity;comment:'Entity type (user, role, menu, api, operationLog)'" json:"entityType"`
+	EntityId     uint   `gorm:"index:idx_recycle_entity;comment:'Entity ID'" json:"entityId"`
+	Associations string `gorm:"type:text;comment:'Detached join table rows (json)'" json:"associations"`
+	Policies     string `gorm:"type:text;comment:'Removed casbin policies (json)'" json:"policies"`
+	UniqueValues string `gorm:"type:text;comment:'Original values of the unique columns, released while in the recycle bin (json)'" json:"uniqueValues"`
+}
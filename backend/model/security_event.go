@@ -0,0 +1,29 @@
+package model
+
+import "gorm.io/gorm"
+
+// Types of security events
+const (
+	SecurityEventLoginSuccess     = "login_success"
+	SecurityEventLoginFailure     = "login_failure"
+	SecurityEventLogout           = "logout"
+	SecurityEventTokenRefresh     = "token_refresh"
+	SecurityEventTokenInvalid     = "token_invalid"
+	SecurityEventLockout          = "lockout"
+	SecurityEventPermissionDenied = "permission_denied"
+	SecurityEventPrivilegeChange  = "privilege_change"
+)
+
+// Login, logout, rejected token, permission denial or privilege change, kept apart from the operation logs
+type SecurityEvent struct {
+	gorm.Model
+	Type         string `gorm:"type:varchar(30);index;comment:'Event type'" json:"type"`
+	Username     string `gorm:"type:varchar(50);index;comment:'Username, the account entered for failed logins of unknown users'" json:"username"`
+	Impersonator string `gorm:"type:varchar(20);comment:'Real user when the event happened through impersonation'" json:"impersonator"`
+	Target       string `gorm:"type:varchar(50);comment:'User or role whose privileges changed, like user:alice or role:admin'" json:"target"`
+	Ip           string `gorm:"type:varchar(50);index;comment:'IP address'" json:"ip"`
+	Method       string `gorm:"type:varchar(20);comment:'Request method'" json:"method"`
+	Path         string `gorm:"type:varchar(100);comment:'Access path, the attempted one for permission denials'" json:"path"`
+	Reason       string `gorm:"type:varchar(255);comment:'Reason of failures and denials'" json:"reason"`
+	Detail       string `gorm:"type:text;comment:'Details (json), e.g. the roles before and after a privilege change'" json:"detail"`
+}
@@ -1,16 +1,28 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	Username     string  `gorm:"type:varchar(20);not null;unique" json:"username"`
-	Password     string  `gorm:"size:255;not null" json:"password"`
-	Mobile       string  `gorm:"type:varchar(11);not null;unique" json:"mobile"`
-	Avatar       string  `gorm:"type:varchar(255)" json:"avatar"`
-	Nickname     *string `gorm:"type:varchar(20)" json:"nickname"`
-	Introduction *string `gorm:"type:varchar(255)" json:"introduction"`
-	Status       uint    `gorm:"type:tinyint(1);default:1;comment:'1 normal, 2 disabled'" json:"status"`
-	Creator      string  `gorm:"type:varchar(20);" json:"creator"`
-	Roles        []*Role `gorm:"many2many:user_roles" json:"roles"`
+	Username        string                `gorm:"type:varchar(20);not null;unique" json:"username"`
+	Password        string                `gorm:"size:255;not null" json:"password"`
+	Mobile          string                `gorm:"type:varchar(20);not null;unique;comment:'E.164 format'" json:"mobile"`
+	Email           *string               `gorm:"type:varchar(100);unique" json:"email"`
+	EmailVerifiedAt *time.Time            `gorm:"comment:'Time the email was verified, null if unverified'" json:"emailVerifiedAt"`
+	Avatar          string                `gorm:"type:varchar(255)" json:"avatar"`
+	Nickname        *string               `gorm:"type:varchar(20)" json:"nickname"`
+	Introduction    *string               `gorm:"type:varchar(255)" json:"introduction"`
+	Status          uint                  `gorm:"type:tinyint(1);default:1;comment:'1 normal, 2 disabled, 3 invited (pending acceptance)'" json:"status"`
+	Locale          string                `gorm:"type:varchar(10);comment:'Preferred locale, empty to follow the browser'" json:"locale"`
+	MustChangePwd   bool                  `gorm:"default:false;comment:'Whether the password was reset and has to be changed before anything else'" json:"mustChangePwd"`
+	Creator         string                `gorm:"type:varchar(20);" json:"creator"`
+	Roles           []*Role               `gorm:"many2many:user_roles" json:"roles"`
+	DepartmentId    *uint                 `gorm:"default:0;comment:'Primary department number (0 means none)'" json:"departmentId"`
+	Departments     []*Department         `gorm:"many2many:user_departments" json:"departments"`
+	Posts           []*Post               `gorm:"many2many:user_posts" json:"posts"`
+	AttributeValues []*UserAttributeValue `gorm:"foreignKey:UserId" json:"attributeValues"`
 }
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Admin-defined extra field of users
+type UserAttribute struct {
+	gorm.Model
+	Key      string     `gorm:"type:varchar(50);not null;unique;comment:'Key used in requests and responses'" json:"key"`
+	Name     string     `gorm:"type:varchar(50);not null;comment:'Display name'" json:"name"`
+	Type     string     `gorm:"type:varchar(20);not null;comment:'string, number, boolean, date or enum'" json:"type"`
+	Required bool       `gorm:"default:false;comment:'Whether every user must have a value'" json:"required"`
+	Pattern  string     `gorm:"type:varchar(255);comment:'Regular expression values must match'" json:"pattern"`
+	Options  StringList `gorm:"type:text;comment:'Allowed values of enum attributes (json)'" json:"options"`
+	Sort     uint       `gorm:"type:int(3);default:999;comment:'Attribute order (1-999)'" json:"sort"`
+	Status   uint       `gorm:"type:tinyint(1);default:1;comment:'1 normal, 2 disabled'" json:"status"`
+	Creator  string     `gorm:"type:varchar(20);comment:'Creator'" json:"creator"`
+}
+
+// Value of a custom attribute of a user
+type UserAttributeValue struct {
+	ID          uint           `gorm:"primarykey" json:"ID"`
+	UserId      uint           `gorm:"not null;uniqueIndex:idx_user_attribute" json:"userId"`
+	AttributeId uint           `gorm:"not null;uniqueIndex:idx_user_attribute;index" json:"attributeId"`
+	Attribute   *UserAttribute `json:"attribute"`
+	Value       string         `gorm:"type:varchar(255);comment:'Value as a string'" json:"value"`
+}
+
+// List of strings stored as a json array
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	return string(b), err
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*l = StringList{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.New("Unsupported type for StringList")
+	}
+	if len(b) == 0 {
+		*l = StringList{}
+		return nil
+	}
+	return json.Unmarshal(b, l)
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UserInvitation struct {
+	gorm.Model
+	UserId     uint       `gorm:"not null;index;comment:'Invited user'" json:"userId"`
+	User       *User      `json:"user"`
+	TokenHash  string     `gorm:"type:char(64);not null;unique;comment:'SHA-256 of the invitation token, the token itself is never stored'" json:"-"`
+	ExpiresAt  time.Time  `gorm:"comment:'Expiration time'" json:"expiresAt"`
+	AcceptedAt *time.Time `gorm:"comment:'Acceptance time'" json:"acceptedAt"`
+	RevokedAt  *time.Time `gorm:"comment:'Revocation time'" json:"revokedAt"`
+	Creator    string     `gorm:"type:varchar(20);comment:'Creator'" json:"creator"`
+}
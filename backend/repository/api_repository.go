@@ -5,11 +5,13 @@ import (
 	"github.com/esyede/goadmin/backend/dto"
 	"github.com/esyede/goadmin/backend/model"
 	"github.com/esyede/goadmin/backend/vo"
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/thoas/go-funk"
+	"gorm.io/gorm"
 )
 
 type IApiRepository interface {
@@ -20,19 +22,31 @@ type IApiRepository interface {
 	UpdateApiById(apiId uint, api *model.Api) error              // Update interface
 	BatchDeleteApiByIds(apiIds []uint) error                     // Batch deletion interface
 	GetApiDescByPath(path string, method string) (string, error) // Get interface description based on the interface path and request method
+	WithContext(ctx context.Context) IApiRepository              // Repository whose changes are recorded as made by the user of the request context
 }
 
 type ApiRepository struct {
+	ctx context.Context // Context the database is used with
 }
 
 func NewApiRepository() IApiRepository {
 	return ApiRepository{}
 }
 
+// Repository whose changes are recorded as made by the user of the request context
+func (a ApiRepository) WithContext(ctx context.Context) IApiRepository {
+	a.ctx = ctx
+	return a
+}
+
+func (a ApiRepository) db() *gorm.DB {
+	return common.DBWithContext(a.ctx)
+}
+
 // Get interface list
 func (a ApiRepository) GetApis(req *vo.ApiListRequest) ([]*model.Api, int64, error) {
 	var list []*model.Api
-	db := common.DB.Model(&model.Api{}).Order("created_at DESC")
+	db := a.db().Model(&model.Api{}).Order("created_at DESC")
 
 	method := strings.TrimSpace(req.Method)
 
@@ -81,14 +95,14 @@ func (a ApiRepository) GetApis(req *vo.ApiListRequest) ([]*model.Api, int64, err
 // Get interface list based on the interface ID
 func (a ApiRepository) GetApisById(apiIds []uint) ([]*model.Api, error) {
 	var apis []*model.Api
-	err := common.DB.Where("id IN (?)", apiIds).Find(&apis).Error
+	err := a.db().Where("id IN (?)", apiIds).Find(&apis).Error
 	return apis, err
 }
 
 // Get interface tree (classified by interface Category field)
 func (a ApiRepository) GetApiTree() ([]*dto.ApiTreeDto, error) {
 	var apiList []*model.Api
-	err := common.DB.Order("category").Order("created_at").Find(&apiList).Error
+	err := a.db().Order("category").Order("created_at").Find(&apiList).Error
 
 	// Get all categories
 	var categoryList []string
@@ -120,7 +134,7 @@ func (a ApiRepository) GetApiTree() ([]*dto.ApiTreeDto, error) {
 
 // Create interface
 func (a ApiRepository) CreateApi(api *model.Api) error {
-	err := common.DB.Create(api).Error
+	err := a.db().Create(api).Error
 	return err
 }
 
@@ -128,14 +142,19 @@ func (a ApiRepository) CreateApi(api *model.Api) error {
 func (a ApiRepository) UpdateApiById(apiId uint, api *model.Api) error {
 	// Get interface information based on id
 	var oldApi model.Api
-	err := common.DB.First(&oldApi, apiId).Error
+	err := a.db().First(&oldApi, apiId).Error
 
 	if err != nil {
 		return errors.New("Failed to obtain interface information based on interface ID")
 	}
 
-	err = common.DB.Model(api).Where("id = ?", apiId).Updates(api).Error
+	err = a.db().Model(api).Where("id = ?", apiId).Updates(api).Error
 
+	if err != nil {
+		return err
+	}
+	// Updates ignores zero values, removed descriptions have to be written explicitly
+	err = a.db().Model(&model.Api{}).Where("id = ?", apiId).Update("descs", api.Descs).Error
 	if err != nil {
 		return err
 	}
@@ -185,11 +204,19 @@ func (a ApiRepository) BatchDeleteApiByIds(apiIds []uint) error {
 		return errors.New("The interface list was not obtained based on the interface ID.")
 	}
 
-	err = common.DB.Where("id IN (?)", apiIds).Unscoped().Delete(&model.Api{}).Error
+	// The casbin policies of the interfaces are kept in the recycle bin for a restore
+	apiPolicies := make(map[uint][][]string)
+	for _, api := range apis {
+		apiPolicies[api.ID] = common.CasbinEnforcer.GetFilteredPolicy(1, api.Path, api.Method)
+	}
+	// Move the interfaces to the recycle bin
+	err = a.db().Transaction(func(tx *gorm.DB) error {
+		return recycle(tx, "api", apiIds, apiPolicies)
+	})
 	// If the deletion is successful, delete the policy in casbin
 	if err == nil {
 		for _, api := range apis {
-			policies := common.CasbinEnforcer.GetFilteredPolicy(1, api.Path, api.Method)
+			policies := apiPolicies[api.ID]
 			if len(policies) > 0 {
 				isRemoved, _ := common.CasbinEnforcer.RemovePolicies(policies)
 				if !isRemoved {
@@ -211,6 +238,6 @@ func (a ApiRepository) BatchDeleteApiByIds(apiIds []uint) error {
 // Get interface description based on the interface path and request method
 func (a ApiRepository) GetApiDescByPath(path string, method string) (string, error) {
 	var api model.Api
-	err := common.DB.Where("path = ?", path).Where("method = ?", method).First(&api).Error
+	err := a.db().Where("path = ?", path).Where("method = ?", method).First(&api).Error
 	return api.Desc, err
 }
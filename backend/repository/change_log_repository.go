@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/vo"
+)
+
+type IChangeLogRepository interface {
+	GetChangeHistory(req *vo.ChangeHistoryRequest) ([]model.ChangeLog, int64, error) // Get the changes of a record, newest first
+}
+
+type ChangeLogRepository struct {
+}
+
+func NewChangeLogRepository() IChangeLogRepository {
+	return ChangeLogRepository{}
+}
+
+// Get the changes of a record, newest first
+func (cr ChangeLogRepository) GetChangeHistory(req *vo.ChangeHistoryRequest) ([]model.ChangeLog, int64, error) {
+	var list []model.ChangeLog
+	db := common.DB.Model(&model.ChangeLog{}).Where("entity_type = ? AND entity_id = ?", req.EntityType, req.EntityId).Order("id DESC")
+
+	// Paging
+	var total int64
+	err := db.Count(&total).Error
+	if err != nil {
+		return list, total, err
+	}
+	pageNum := req.PageNum
+	pageSize := req.PageSize
+	if pageNum > 0 && pageSize > 0 {
+		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&list).Error
+	} else {
+		err = db.Find(&list).Error
+	}
+	return list, total, err
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/vo"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type IDepartmentRepository interface {
+	GetDepartments(req *vo.DepartmentListRequest) ([]*model.Department, int64, error) // Get department list
+	GetDepartmentTree() ([]*model.Department, error)                                  // Get department tree
+	GetDepartmentsByIds(departmentIds []uint) ([]*model.Department, error)            // Get departments based on the department ID
+	GetDepartmentChildIds(departmentId uint) ([]uint, error)                          // Get the department ID and the IDs of all its sub-departments
+	CreateDepartment(department *model.Department) error                              // Create department
+	UpdateDepartmentById(departmentId uint, department *model.Department) error       // Update department
+	BatchDeleteDepartmentByIds(departmentIds []uint) error                            // Batch delete department
+	GetDepartmentUsersById(departmentId uint) ([]*model.User, error)                  // Get department members
+	UpdateDepartmentUsers(department *model.Department) error                         // Update department members
+}
+
+type DepartmentRepository struct {
+}
+
+func NewDepartmentRepository() IDepartmentRepository {
+	return DepartmentRepository{}
+}
+
+// Get department list
+func (d DepartmentRepository) GetDepartments(req *vo.DepartmentListRequest) ([]*model.Department, int64, error) {
+	var list []*model.Department
+	db := common.DB.Model(&model.Department{}).Order("sort")
+
+	name := strings.TrimSpace(req.Name)
+	if name != "" {
+		db = db.Where("name LIKE ?", fmt.Sprintf("%%%s%%", name))
+	}
+	code := strings.TrimSpace(req.Code)
+	if code != "" {
+		db = db.Where("code LIKE ?", fmt.Sprintf("%%%s%%", code))
+	}
+	status := req.Status
+	if status != 0 {
+		db = db.Where("status = ?", status)
+	}
+	// Paging only when pageNum > 0 and pageSize > 0
+	// Total number of records
+	var total int64
+	err := db.Count(&total).Error
+	if err != nil {
+		return list, total, err
+	}
+	pageNum := int(req.PageNum)
+	pageSize := int(req.PageSize)
+	if pageNum > 0 && pageSize > 0 {
+		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Preload("Leaders").Find(&list).Error
+	} else {
+		err = db.Preload("Leaders").Find(&list).Error
+	}
+	return list, total, err
+}
+
+// Get department tree
+func (d DepartmentRepository) GetDepartmentTree() ([]*model.Department, error) {
+	var departments []*model.Department
+	err := common.DB.Order("sort").Preload("Leaders").Find(&departments).Error
+	// The one with parentId 0 is the root department
+	return GenDepartmentTree(0, departments), err
+}
+
+func GenDepartmentTree(parentId uint, departments []*model.Department) []*model.Department {
+	tree := make([]*model.Department, 0)
+
+	for _, d := range departments {
+		if *d.ParentId == parentId {
+			children := GenDepartmentTree(d.ID, departments)
+			d.Children = children
+			tree = append(tree, d)
+		}
+	}
+	return tree
+}
+
+// Get departments based on the department ID
+func (d DepartmentRepository) GetDepartmentsByIds(departmentIds []uint) ([]*model.Department, error) {
+	var list []*model.Department
+	err := common.DB.Where("id IN (?)", departmentIds).Find(&list).Error
+	return list, err
+}
+
+// Get the department ID and the IDs of all its sub-departments
+func (d DepartmentRepository) GetDepartmentChildIds(departmentId uint) ([]uint, error) {
+	var departments []*model.Department
+	err := common.DB.Select("id", "parent_id").Find(&departments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint{departmentId}
+	// Walk the tree level by level, the visited set guards against dirty data forming a cycle
+	visited := map[uint]bool{departmentId: true}
+	for i := 0; i < len(ids); i++ {
+		for _, department := range departments {
+			if *department.ParentId == ids[i] && !visited[department.ID] {
+				visited[department.ID] = true
+				ids = append(ids, department.ID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Create department
+func (d DepartmentRepository) CreateDepartment(department *model.Department) error {
+	err := common.DB.Create(department).Error
+	return err
+}
+
+// Update department
+func (d DepartmentRepository) UpdateDepartmentById(departmentId uint, department *model.Department) error {
+	var oldDepartment model.Department
+	err := common.DB.First(&oldDepartment, departmentId).Error
+	if err != nil {
+		return errors.New("Failed to obtain department information based on department ID")
+	}
+
+	// Leaders are maintained through the association, not through Updates
+	leaders := department.Leaders
+	department.Leaders = nil
+	err = common.DB.Model(&oldDepartment).Updates(department).Error
+	if err != nil {
+		return err
+	}
+	// Updates ignores zero values, so moving a department back to the root has to be written explicitly
+	err = common.DB.Model(&oldDepartment).Update("parent_id", department.ParentId).Error
+	if err != nil {
+		return err
+	}
+	err = common.DB.Model(&oldDepartment).Association("Leaders").Replace(leaders)
+	return err
+}
+
+// Batch delete department
+func (d DepartmentRepository) BatchDeleteDepartmentByIds(departmentIds []uint) error {
+	var departments []*model.Department
+	err := common.DB.Where("id IN (?)", departmentIds).Find(&departments).Error
+	if err != nil {
+		return err
+	}
+	if len(departments) == 0 {
+		return errors.New("The department list was not obtained based on the department ID.")
+	}
+
+	// Departments that still have sub-departments outside of the deleted set cannot be deleted
+	var childCount int64
+	err = common.DB.Model(&model.Department{}).
+		Where("parent_id IN (?)", departmentIds).
+		Where("id NOT IN (?)", departmentIds).
+		Count(&childCount).Error
+	if err != nil {
+		return err
+	}
+	if childCount > 0 {
+		return errors.New("Please delete the sub-departments first")
+	}
+
+	err = common.DB.Transaction(func(tx *gorm.DB) error {
+		// Users whose primary department is deleted no longer have a primary department
+		err := tx.Model(&model.User{}).Where("department_id IN (?)", departmentIds).Update("department_id", 0).Error
+		if err != nil {
+			return err
+		}
+		return tx.Select("Users", "Leaders").Unscoped().Delete(&departments).Error
+	})
+	// Members' cached department information is outdated
+	if err == nil {
+		userInfoCache.Flush()
+	}
+	return err
+}
+
+// Get department members
+func (d DepartmentRepository) GetDepartmentUsersById(departmentId uint) ([]*model.User, error) {
+	var department model.Department
+	err := common.DB.Where("id = ?", departmentId).Preload("Users").First(&department).Error
+	return department.Users, err
+}
+
+// Update department members
+func (d DepartmentRepository) UpdateDepartmentUsers(department *model.Department) error {
+	err := common.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(department).Association("Users").Replace(department.Users)
+		if err != nil {
+			return err
+		}
+		// Removed members cannot keep this department as their primary department
+		keepIds := make([]uint, 0)
+		for _, user := range department.Users {
+			keepIds = append(keepIds, user.ID)
+		}
+		db := tx.Model(&model.User{}).Where("department_id = ?", department.ID)
+		if len(keepIds) > 0 {
+			db = db.Where("id NOT IN (?)", keepIds)
+		}
+		return db.Update("department_id", 0).Error
+	})
+	if err == nil {
+		userInfoCache.Flush()
+	}
+	return err
+}
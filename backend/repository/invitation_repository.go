@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/vo"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IInvitationRepository interface {
+	InviteUser(user *model.User, creator string) (string, error)                          // Create a pending user and its invitation, returns the invitation token
+	GetInvitations(req *vo.InvitationListRequest) ([]*model.UserInvitation, int64, error) // Get pending invitations
+	GetInvitationById(id uint) (model.UserInvitation, error)                              // Get a pending invitation
+	ResendInvitation(invitation *model.UserInvitation, creator string) (string, error)    // Replace an invitation with a new one, returns the new token
+	RevokeInvitation(id uint) error                                                       // Revoke a pending invitation
+	GetInvitationByToken(token string) (model.UserInvitation, error)                      // Get a usable invitation by its token
+	AcceptInvitation(invitation *model.UserInvitation, hashPasswd string) error           // Set the invitee's password and activate the user
+	WithContext(ctx context.Context) IInvitationRepository                                // Repository whose changes are recorded as made by the user of the request context
+}
+
+type InvitationRepository struct {
+	ctx context.Context // Context the database is used with
+}
+
+func NewInvitationRepository() IInvitationRepository {
+	return InvitationRepository{}
+}
+
+// Repository whose changes are recorded as made by the user of the request context
+func (i InvitationRepository) WithContext(ctx context.Context) IInvitationRepository {
+	i.ctx = ctx
+	return i
+}
+
+func (i InvitationRepository) db() *gorm.DB {
+	return common.DBWithContext(i.ctx)
+}
+
+// Generate a random invitation token and the hash that is stored instead of it
+func newInvitationToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	return token, hashInvitationToken(token), nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Hours an invitation can be accepted in, 72 when not configured
+func InvitationTimeout() int {
+	if config.Conf.Invitation.Timeout <= 0 {
+		return 72
+	}
+	return config.Conf.Invitation.Timeout
+}
+
+// Create an invitation for a pending user inside tx
+func createInvitation(tx *gorm.DB, userId uint, creator string) (string, error) {
+	token, tokenHash, err := newInvitationToken()
+	if err != nil {
+		return "", err
+	}
+	invitation := model.UserInvitation{
+		UserId:    userId,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(time.Duration(InvitationTimeout()) * time.Hour),
+		Creator:   creator,
+	}
+	return token, tx.Create(&invitation).Error
+}
+
+// Create a pending user and its invitation, returns the invitation token
+func (i InvitationRepository) InviteUser(user *model.User, creator string) (string, error) {
+	if err := checkRecycledDuplicates(i.db(), "user", userUniqueValues(user)); err != nil {
+		return "", err
+	}
+	var token string
+	err := i.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		var err error
+		token, err = createInvitation(tx, user.ID, creator)
+		return err
+	})
+	if err == nil {
+		recordInitialRoles(i.ctx, user)
+	}
+	return token, err
+}
+
+// Get pending invitations
+func (i InvitationRepository) GetInvitations(req *vo.InvitationListRequest) ([]*model.UserInvitation, int64, error) {
+	var list []*model.UserInvitation
+	// Invitations of deleted users are left out
+	db := i.db().Model(&model.UserInvitation{}).
+		Where("accepted_at IS NULL AND revoked_at IS NULL").
+		Where("user_id IN (?)", i.db().Model(&model.User{}).Select("id")).
+		Order("created_at DESC")
+
+	username := strings.TrimSpace(req.Username)
+	if username != "" {
+		db = db.Where("user_id IN (?)", i.db().Model(&model.User{}).Select("id").Where("username LIKE ?", fmt.Sprintf("%%%s%%", username)))
+	}
+	// Paging only when pageNum > 0 and pageSize > 0
+	// Total number of records
+	var total int64
+	err := db.Count(&total).Error
+	if err != nil {
+		return list, total, err
+	}
+	db = db.Preload("User", func(db *gorm.DB) *gorm.DB {
+		return db.Omit("password")
+	})
+	pageNum := int(req.PageNum)
+	pageSize := int(req.PageSize)
+	if pageNum > 0 && pageSize > 0 {
+		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&list).Error
+	} else {
+		err = db.Find(&list).Error
+	}
+	return list, total, err
+}
+
+// Get a pending invitation
+func (i InvitationRepository) GetInvitationById(id uint) (model.UserInvitation, error) {
+	var invitation model.UserInvitation
+	err := i.db().Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).Preload("User").First(&invitation).Error
+	if err != nil {
+		return invitation, errors.New("The invitation does not exist or has already been used")
+	}
+	if invitation.User == nil {
+		return invitation, errors.New("The invited user does not exist")
+	}
+	return invitation, nil
+}
+
+// Replace an invitation with a new one, returns the new token
+// The old token stops working immediately
+func (i InvitationRepository) ResendInvitation(invitation *model.UserInvitation, creator string) (string, error) {
+	var token string
+	err := i.db().Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.UserInvitation{}).Where("id = ?", invitation.ID).Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		token, err = createInvitation(tx, invitation.UserId, creator)
+		return err
+	})
+	return token, err
+}
+
+// Revoke a pending invitation, the user stays pending until it is invited again or deleted
+func (i InvitationRepository) RevokeInvitation(id uint) error {
+	result := i.db().Model(&model.UserInvitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("The invitation does not exist or has already been used")
+	}
+	return nil
+}
+
+// Get a usable invitation by its token
+func (i InvitationRepository) GetInvitationByToken(token string) (model.UserInvitation, error) {
+	var invitation model.UserInvitation
+	err := i.db().
+		Where("token_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", hashInvitationToken(token), time.Now()).
+		Preload("User").
+		First(&invitation).Error
+	// The same message for every case, so that the endpoint tells nothing about other tokens
+	if err != nil || invitation.User == nil || invitation.User.Status != 3 {
+		return invitation, errors.New("The invitation is invalid or has expired")
+	}
+	return invitation, nil
+}
+
+// Set the invitee's password and activate the user
+func (i InvitationRepository) AcceptInvitation(invitation *model.UserInvitation, hashPasswd string) error {
+	now := time.Now()
+	err := i.db().Transaction(func(tx *gorm.DB) error {
+		// The conditions make the token single-use even if it is accepted twice at the same time
+		result := tx.Model(&model.UserInvitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("The invitation is invalid or has expired")
+		}
+		// The invitee proved to own the email the invitation was sent to
+		return tx.Model(&model.User{}).Where("id = ?", invitation.UserId).Updates(map[string]interface{}{
+			"password":          hashPasswd,
+			"status":            1,
+			"email_verified_at": now,
+		}).Error
+	})
+	if err == nil && invitation.User != nil {
+		userInfoCache.Delete(invitation.User.Username)
+	}
+	return err
+}
@@ -2,39 +2,74 @@ package repository
 
 import (
 	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/dto"
 	"github.com/esyede/goadmin/backend/model"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"time"
 
+	"github.com/patrickmn/go-cache"
 	"github.com/thoas/go-funk"
+	"gorm.io/gorm"
 )
 
 type IMenuRepository interface {
-	GetMenus() ([]*model.Menu, error)                           // Get menu list
-	GetMenuTree() ([]*model.Menu, error)                        // Get menu tree
-	CreateMenu(menu *model.Menu) error                          // Create menu
-	UpdateMenuById(menuId uint, menu *model.Menu) error         // Update menu
-	BatchDeleteMenuByIds(menuIds []uint) error                  // Batch delete menu
-	GetUserMenusByUserId(userId uint) ([]*model.Menu, error)    // Get user's permission (accessible) menu list based on the user ID
-	GetUserMenuTreeByUserId(userId uint) ([]*model.Menu, error) // Get user's permissions (accessible) menu tree based on the user ID
+	GetMenus() ([]*model.Menu, error)                                                             // Get menu list
+	GetMenuTree() ([]*model.Menu, error)                                                          // Get menu tree
+	GetMenusByIds(menuIds []uint) ([]*model.Menu, error)                                          // Get menus based on the menu ID
+	GetMenuChildIds(menuId uint) ([]uint, error)                                                  // Get the menu ID and the IDs of all its sub-menus
+	CheckMenuParents(parents map[uint]uint) error                                                 // Check that changing the parents of menus keeps the menus a tree
+	CheckMenuName(name string, menuId uint) error                                                 // Check that no other menu has the name
+	CreateMenu(menu *model.Menu) error                                                            // Create menu
+	UpdateMenuById(menuId uint, menu *model.Menu) error                                           // Update menu
+	BatchDeleteMenuByIds(menuIds []uint) error                                                    // Batch delete menu
+	MoveMenus(menus []*model.Menu) error                                                          // Change the parents and sorting of menus in one transaction
+	GetUserMenusByUserId(userId uint) ([]*model.Menu, error)                                      // Get user's permission (accessible) menu list based on the user ID
+	GetUserMenuTreeByUserId(userId uint) ([]*model.Menu, error)                                   // Get user's permissions (accessible) menu tree based on the user ID
+	ExportMenus() ([]*dto.MenuYamlDto, error)                                                     // Get the menu tree with the roles of the menus in the form of a menu file
+	DiffMenus(menus []*dto.MenuYamlDto, prune bool) ([]*dto.MenuDiffDto, error)                   // Get the changes importing the menus of a menu file would make
+	ImportMenus(menus []*dto.MenuYamlDto, prune bool, creator string) ([]*dto.MenuDiffDto, error) // Create and update menus to match a menu file in one transaction
+	SeedMenus(menus []*dto.MenuYamlDto) error                                                     // Create the menus of a menu file that do not exist yet
+	WithContext(ctx context.Context) IMenuRepository                                              // Repository whose changes are recorded as made by the user of the request context
 }
 
 type MenuRepository struct {
+	ctx context.Context // Context the database is used with
 }
 
+// Accessible menus by role set, emptied whenever menus or the menus of roles change
+var userMenuCache = cache.New(24*time.Hour, 48*time.Hour)
+
 func NewMenuRepository() IMenuRepository {
 	return MenuRepository{}
 }
 
+// Repository whose changes are recorded as made by the user of the request context
+func (m MenuRepository) WithContext(ctx context.Context) IMenuRepository {
+	m.ctx = ctx
+	return m
+}
+
+func (m MenuRepository) db() *gorm.DB {
+	return common.DBWithContext(m.ctx)
+}
+
 // Get menu list
 func (m MenuRepository) GetMenus() ([]*model.Menu, error) {
 	var menus []*model.Menu
-	err := common.DB.Order("sort").Find(&menus).Error
+	err := m.db().Order("sort").Order("id").Find(&menus).Error
 	return menus, err
 }
 
 // Get menu tree
 func (m MenuRepository) GetMenuTree() ([]*model.Menu, error) {
 	var menus []*model.Menu
-	err := common.DB.Order("sort").Find(&menus).Error
+	err := m.db().Order("sort").Order("id").Find(&menus).Error
 	// The one with parentId 0 is the root menu
 	return GenMenuTree(0, menus), err
 }
@@ -52,77 +87,225 @@ func GenMenuTree(parentId uint, menus []*model.Menu) []*model.Menu {
 	return tree
 }
 
+// Get menus based on the menu ID
+func (m MenuRepository) GetMenusByIds(menuIds []uint) ([]*model.Menu, error) {
+	var menus []*model.Menu
+	err := m.db().Where("id IN (?)", menuIds).Find(&menus).Error
+	return menus, err
+}
+
+// Get the menu ID and the IDs of all its sub-menus
+func (m MenuRepository) GetMenuChildIds(menuId uint) ([]uint, error) {
+	var menus []*model.Menu
+	err := m.db().Select("id", "parent_id").Find(&menus).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint{menuId}
+	// Walk the tree level by level, the visited set guards against dirty data forming a cycle
+	visited := map[uint]bool{menuId: true}
+	for i := 0; i < len(ids); i++ {
+		for _, menu := range menus {
+			if *menu.ParentId == ids[i] && !visited[menu.ID] {
+				visited[menu.ID] = true
+				ids = append(ids, menu.ID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Check that changing the parents of menus (menu ID => new parent ID) keeps the menus a tree:
+// every menu and parent exists, and no menu becomes its own ancestor
+func (m MenuRepository) CheckMenuParents(parents map[uint]uint) error {
+	var menus []*model.Menu
+	err := m.db().Select("id", "parent_id").Find(&menus).Error
+	if err != nil {
+		return err
+	}
+	parentOf := make(map[uint]uint, len(menus))
+	for _, menu := range menus {
+		parentOf[menu.ID] = *menu.ParentId
+	}
+	for id, parentId := range parents {
+		if _, ok := parentOf[id]; !ok {
+			return fmt.Errorf("Menu %d does not exist", id)
+		}
+		if _, ok := parentOf[parentId]; parentId != 0 && !ok {
+			return fmt.Errorf("Parent menu %d does not exist", parentId)
+		}
+		parentOf[id] = parentId
+	}
+	// Follow the parents of every changed menu up to the root
+	for id := range parents {
+		visited := map[uint]bool{id: true}
+		for parentId := parentOf[id]; parentId != 0; parentId = parentOf[parentId] {
+			if visited[parentId] {
+				return fmt.Errorf("Menu %d cannot be moved under itself or its sub-menus", id)
+			}
+			visited[parentId] = true
+		}
+	}
+	return nil
+}
+
+// Check that no other menu has the name, menu files identify menus by their names
+func (m MenuRepository) CheckMenuName(name string, menuId uint) error {
+	var count int64
+	err := m.db().Model(&model.Menu{}).Where("name = ? AND id <> ?", name, menuId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("Menu name %s already exists", name)
+	}
+	return checkRecycledDuplicates(m.db(), "menu", map[string][]string{"name": {name}})
+}
+
 // Create menu
 func (m MenuRepository) CreateMenu(menu *model.Menu) error {
-	err := common.DB.Create(menu).Error
+	err := m.db().Create(menu).Error
+	userMenuCache.Flush()
 	return err
 }
 
 // Update menu
 func (m MenuRepository) UpdateMenuById(menuId uint, menu *model.Menu) error {
-	err := common.DB.Model(menu).Where("id = ?", menuId).Updates(menu).Error
+	err := m.db().Model(menu).Where("id = ?", menuId).Updates(menu).Error
+	if err != nil {
+		return err
+	}
+	// Updates ignores zero values, so moving a menu back to the root and removing titles have to be written explicitly
+	err = m.db().Model(&model.Menu{}).Where("id = ?", menuId).Updates(map[string]interface{}{
+		"parent_id": menu.ParentId,
+		"titles":    menu.Titles,
+	}).Error
+	userMenuCache.Flush()
 	return err
 }
 
 // Batch delete menu
 func (m MenuRepository) BatchDeleteMenuByIds(menuIds []uint) error {
 	var menus []*model.Menu
-	err := common.DB.Where("id IN (?)", menuIds).Find(&menus).Error
+	err := m.db().Where("id IN (?)", menuIds).Find(&menus).Error
 	if err != nil {
 		return err
 	}
-	err = common.DB.Select("Roles").Unscoped().Delete(&menus).Error
+	if len(menus) == 0 {
+		return errors.New("The menu list was not obtained based on the menu ID.")
+	}
+
+	// Sub-menus outside of the deleted set would be left without a parent
+	ids := make([]uint, 0, len(menus))
+	for _, menu := range menus {
+		childIds, err := m.GetMenuChildIds(menu.ID)
+		if err != nil {
+			return err
+		}
+		for _, childId := range childIds {
+			if !funk.Contains(ids, childId) {
+				ids = append(ids, childId)
+			}
+		}
+	}
+	if len(ids) > len(menus) && config.Conf.Menu.DeleteMode != "cascade" {
+		return errors.New("Please delete the sub-menus first")
+	}
+
+	// Move the menus to the recycle bin, their roles are kept for a restore
+	err = m.db().Transaction(func(tx *gorm.DB) error {
+		return recycle(tx, "menu", ids, nil)
+	})
+	userMenuCache.Flush()
 	return err
 }
 
-// Get user's permission (accessible) menu list based on the user ID
+// Change the parents and sorting of menus in one transaction
+func (m MenuRepository) MoveMenus(menus []*model.Menu) error {
+	defer userMenuCache.Flush()
+	return m.db().Transaction(func(tx *gorm.DB) error {
+		for _, menu := range menus {
+			err := tx.Model(&model.Menu{}).Where("id = ?", menu.ID).Updates(map[string]interface{}{
+				"parent_id": menu.ParentId,
+				"sort":      menu.Sort,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get user's permission (accessible) menu list based on the user ID, parents come before their sub-menus
 func (m MenuRepository) GetUserMenusByUserId(userId uint) ([]*model.Menu, error) {
-	// Get user
-	var user model.User
-	err := common.DB.Where("id = ?", userId).Preload("Roles").First(&user).Error
+	// Only the roles in normal status grant menus
+	var roleIds []uint
+	err := m.db().Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ? AND roles.status = 1 AND roles.deleted_at IS NULL", userId).
+		Order("roles.id").
+		Pluck("roles.id", &roleIds).Error
 	if err != nil {
 		return nil, err
 	}
-	// Get role
-	roles := user.Roles
-	// Menu collection of all characters
-	allRoleMenus := make([]*model.Menu, 0)
-	for _, role := range roles {
-		var userRole model.Role
-		err := common.DB.Where("id = ?", role.ID).Preload("Menus").First(&userRole).Error
+	if len(roleIds) == 0 {
+		return []*model.Menu{}, nil
+	}
+
+	// Users with the same roles have the same menus
+	key := fmt.Sprint(roleIds)
+	cached, found := userMenuCache.Get(key)
+	if !found {
+		var menus []*model.Menu
+		err = m.db().Select("DISTINCT menus.*").
+			Joins("JOIN role_menus ON role_menus.menu_id = menus.id").
+			Where("role_menus.role_id IN (?) AND menus.status = 1", roleIds).
+			Order("menus.sort").Order("menus.id").
+			Find(&menus).Error
 		if err != nil {
 			return nil, err
 		}
-		// Get character's menu
-		menus := userRole.Menus
-		allRoleMenus = append(allRoleMenus, menus...)
+		sorted := make([]model.Menu, 0, len(menus))
+		for _, menu := range sortMenusByTree(menus) {
+			sorted = append(sorted, *menu)
+		}
+		userMenuCache.Set(key, sorted, cache.DefaultExpiration)
+		cached = sorted
 	}
 
-	// The menu collection of all characters is deduplicated
-	allRoleMenusId := make([]int, 0)
-	for _, menu := range allRoleMenus {
-		allRoleMenusId = append(allRoleMenusId, int(menu.ID))
+	// Callers build trees and localize titles, so every call gets its own copies
+	menus := cached.([]model.Menu)
+	accessMenus := make([]*model.Menu, len(menus))
+	for i := range menus {
+		menu := menus[i]
+		accessMenus[i] = &menu
 	}
-	allRoleMenusIdUniq := funk.UniqInt(allRoleMenusId)
-	allRoleMenusUniq := make([]*model.Menu, 0)
-	for _, id := range allRoleMenusIdUniq {
-		for _, menu := range allRoleMenus {
-			if id == int(menu.ID) {
-				allRoleMenusUniq = append(allRoleMenusUniq, menu)
-				break
+	return accessMenus, nil
+}
+
+// Order menus sorted by sort the way they appear in the menu tree, menus without an accessible parent come last
+func sortMenusByTree(menus []*model.Menu) []*model.Menu {
+	sorted := make([]*model.Menu, 0, len(menus))
+	visited := make(map[uint]bool, len(menus))
+	var walk func(parentId uint)
+	walk = func(parentId uint) {
+		for _, menu := range menus {
+			if *menu.ParentId == parentId && !visited[menu.ID] {
+				visited[menu.ID] = true
+				sorted = append(sorted, menu)
+				walk(menu.ID)
 			}
 		}
 	}
-
-	// Get menu with status 1
-	accessMenus := make([]*model.Menu, 0)
-	for _, menu := range allRoleMenusUniq {
-		if menu.Status == 1 {
-			accessMenus = append(accessMenus, menu)
+	walk(0)
+	for _, menu := range menus {
+		if !visited[menu.ID] {
+			sorted = append(sorted, menu)
 		}
 	}
-
-	return accessMenus, err
+	return sorted
 }
 
 // Get user's permissions (accessible) menu tree based on the user ID
@@ -134,3 +317,310 @@ func (m MenuRepository) GetUserMenuTreeByUserId(userId uint) ([]*model.Menu, err
 	tree := GenMenuTree(0, menus)
 	return tree, err
 }
+
+// Get the menu tree with the roles of the menus in the form of a menu file
+func (m MenuRepository) ExportMenus() ([]*dto.MenuYamlDto, error) {
+	var menus []*model.Menu
+	err := m.db().Preload("Roles").Order("sort").Order("id").Find(&menus).Error
+	if err != nil {
+		return nil, err
+	}
+	return dto.ToMenuYamlDto(GenMenuTree(0, menus)), nil
+}
+
+// Get the changes importing the menus of a menu file would make, without making them
+func (m MenuRepository) DiffMenus(menus []*dto.MenuYamlDto, prune bool) ([]*dto.MenuDiffDto, error) {
+	plan, err := planMenuImport(m.db(), menus, prune)
+	if err != nil {
+		return nil, err
+	}
+	return plan.changes(), nil
+}
+
+// Create and update menus to match a menu file in one transaction, menus are matched by name.
+// With prune the menus missing from the file are moved to the recycle bin, otherwise they are kept.
+func (m MenuRepository) ImportMenus(menus []*dto.MenuYamlDto, prune bool, creator string) ([]*dto.MenuDiffDto, error) {
+	var changes []*dto.MenuDiffDto
+	err := m.db().Transaction(func(tx *gorm.DB) error {
+		plan, err := planMenuImport(tx, menus, prune)
+		if err != nil {
+			return err
+		}
+		changes = plan.changes()
+		return plan.apply(tx, false, creator)
+	})
+	userMenuCache.Flush()
+	return changes, err
+}
+
+// Create the menus of a menu file that do not exist yet, the existing ones are left as they are
+func (m MenuRepository) SeedMenus(menus []*dto.MenuYamlDto) error {
+	defer userMenuCache.Flush()
+	return m.db().Transaction(func(tx *gorm.DB) error {
+		plan, err := planMenuImport(tx, menus, false)
+		if err != nil {
+			return err
+		}
+		return plan.apply(tx, true, "system")
+	})
+}
+
+// Seed the menus from the menu file in the configuration
+func InitMenuData() {
+	// Whether to initialize data
+	if !config.Conf.System.InitData || config.Conf.Menu.SeedFile == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(config.Conf.Menu.SeedFile)
+	if err != nil {
+		common.Log.Errorf("Failed to read menu file: %v", err)
+		return
+	}
+	menus, err := dto.ParseMenuYaml(data, common.Trans)
+	if err != nil {
+		common.Log.Errorf("Failed to parse menu file: %v", err)
+		return
+	}
+	err = NewMenuRepository().SeedMenus(menus)
+	if err != nil {
+		common.Log.Errorf("Failed to write system menu data: %v", err)
+	}
+}
+
+// Menu of a menu file and what importing it does
+type menuImportStep struct {
+	menu   *dto.MenuYamlDto
+	parent string // Name of the parent menu, empty for root menus
+	id     uint   // ID of the existing menu with the same name, 0 for a new menu
+	roles  []*model.Role
+	diff   *dto.MenuDiffDto // nil when the existing menu already matches
+}
+
+type menuImportPlan struct {
+	steps   []*menuImportStep // Parents come before their sub-menus
+	deletes []*model.Menu     // Menus missing from the file, only when pruning
+}
+
+// Match the menus of a menu file with the current menus by name
+func planMenuImport(tx *gorm.DB, menus []*dto.MenuYamlDto, prune bool) (*menuImportPlan, error) {
+	var current []*model.Menu
+	err := tx.Preload("Roles").Order("sort").Order("id").Find(&current).Error
+	if err != nil {
+		return nil, err
+	}
+	currentById := make(map[uint]*model.Menu, len(current))
+	currentByName := make(map[string]*model.Menu, len(current))
+	for _, menu := range current {
+		currentById[menu.ID] = menu
+		currentByName[menu.Name] = menu
+	}
+
+	// Roles are referred to by their keywords
+	keywords := make([]string, 0)
+	var collect func(menus []*dto.MenuYamlDto)
+	collect = func(menus []*dto.MenuYamlDto) {
+		for _, menu := range menus {
+			keywords = append(keywords, menu.Roles...)
+			collect(menu.Children)
+		}
+	}
+	collect(menus)
+	keywords = funk.UniqString(keywords)
+	rolesByKeyword := make(map[string]*model.Role)
+	if len(keywords) > 0 {
+		var roles []*model.Role
+		err = tx.Where("keyword IN (?)", keywords).Find(&roles).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range roles {
+			rolesByKeyword[role.Keyword] = role
+		}
+	}
+	for _, keyword := range keywords {
+		if _, ok := rolesByKeyword[keyword]; !ok {
+			return nil, fmt.Errorf("Role %s does not exist", keyword)
+		}
+	}
+
+	plan := &menuImportPlan{}
+	names := make(map[string]bool)
+	created := make([]string, 0)
+	var walk func(menus []*dto.MenuYamlDto, parent string)
+	walk = func(menus []*dto.MenuYamlDto, parent string) {
+		for _, menu := range menus {
+			names[menu.Name] = true
+			step := &menuImportStep{menu: menu, parent: parent}
+			for _, keyword := range funk.UniqString(menu.Roles) {
+				step.roles = append(step.roles, rolesByKeyword[keyword])
+			}
+			if existing, ok := currentByName[menu.Name]; ok {
+				step.id = existing.ID
+				existingParent := ""
+				if p, ok := currentById[*existing.ParentId]; ok {
+					existingParent = p.Name
+				}
+				fields := diffMenu(existing, existingParent, menu, parent)
+				if len(fields) > 0 {
+					step.diff = &dto.MenuDiffDto{Name: menu.Name, Action: "update", Fields: fields}
+				}
+			} else {
+				step.diff = &dto.MenuDiffDto{Name: menu.Name, Action: "create", Fields: []string{}}
+				created = append(created, menu.Name)
+			}
+			plan.steps = append(plan.steps, step)
+			walk(menu.Children, menu.Name)
+		}
+	}
+	walk(menus, "")
+	if err := checkRecycledDuplicates(tx, "menu", map[string][]string{"name": created}); err != nil {
+		return nil, err
+	}
+
+	if prune {
+		for _, menu := range current {
+			if !names[menu.Name] {
+				plan.deletes = append(plan.deletes, menu)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Fields of an existing menu that differ from the menu in the file
+func diffMenu(existing *model.Menu, existingParent string, menu *dto.MenuYamlDto, parent string) []string {
+	fields := make([]string, 0)
+	diff := func(field string, changed bool) {
+		if changed {
+			fields = append(fields, field)
+		}
+	}
+	titles := map[string]string(existing.Titles)
+	diff("title", existing.Title != menu.Title)
+	diff("titles", len(titles)+len(menu.Titles) > 0 && !reflect.DeepEqual(titles, menu.Titles))
+	diff("icon", derefMenuString(existing.Icon) != menu.Icon)
+	diff("path", existing.Path != menu.Path)
+	diff("redirect", derefMenuString(existing.Redirect) != menu.Redirect)
+	diff("component", existing.Component != menu.Component)
+	diff("sort", existing.Sort != menu.Sort)
+	diff("status", existing.Status != menu.Status)
+	diff("hidden", existing.Hidden != menu.Hidden)
+	diff("noCache", existing.NoCache != menu.NoCache)
+	diff("alwaysShow", existing.AlwaysShow != menu.AlwaysShow)
+	diff("breadcrumb", existing.Breadcrumb != menu.Breadcrumb)
+	diff("activeMenu", derefMenuString(existing.ActiveMenu) != menu.ActiveMenu)
+	diff("parent", existingParent != parent)
+
+	roles := make([]string, 0, len(existing.Roles))
+	for _, role := range existing.Roles {
+		roles = append(roles, role.Keyword)
+	}
+	menuRoles := funk.UniqString(menu.Roles)
+	sort.Strings(roles)
+	sort.Strings(menuRoles)
+	diff("roles", !reflect.DeepEqual(roles, menuRoles))
+	return fields
+}
+
+func derefMenuString(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// Changes the plan makes
+func (p *menuImportPlan) changes() []*dto.MenuDiffDto {
+	changes := make([]*dto.MenuDiffDto, 0)
+	for _, step := range p.steps {
+		if step.diff != nil {
+			changes = append(changes, step.diff)
+		}
+	}
+	for _, menu := range p.deletes {
+		changes = append(changes, &dto.MenuDiffDto{Name: menu.Name, Action: "delete", Fields: []string{}})
+	}
+	return changes
+}
+
+// Make the changes of the plan inside tx, with onlyCreate the existing menus are not touched
+func (p *menuImportPlan) apply(tx *gorm.DB, onlyCreate bool, creator string) error {
+	ids := make(map[string]uint)
+	for _, step := range p.steps {
+		menu := step.menu
+		// Parents come first, so their IDs are known even when they have just been created
+		parentId := ids[step.parent]
+		if step.id == 0 {
+			newMenu := model.Menu{
+				Name:       menu.Name,
+				Title:      menu.Title,
+				Titles:     model.LocaleTexts(menu.Titles),
+				Icon:       &menu.Icon,
+				Path:       menu.Path,
+				Redirect:   &menu.Redirect,
+				Component:  menu.Component,
+				Sort:       menu.Sort,
+				Status:     menu.Status,
+				Hidden:     menu.Hidden,
+				NoCache:    menu.NoCache,
+				AlwaysShow: menu.AlwaysShow,
+				Breadcrumb: menu.Breadcrumb,
+				ActiveMenu: &menu.ActiveMenu,
+				ParentId:   &parentId,
+				Creator:    creator,
+				Roles:      step.roles,
+			}
+			if err := tx.Create(&newMenu).Error; err != nil {
+				return err
+			}
+			ids[menu.Name] = newMenu.ID
+			continue
+		}
+		ids[menu.Name] = step.id
+		if onlyCreate || step.diff == nil {
+			continue
+		}
+
+		// Zero values have to be written too, so the fields are updated with a map
+		err := tx.Model(&model.Menu{}).Where("id = ?", step.id).Updates(map[string]interface{}{
+			"title":       menu.Title,
+			"titles":      model.LocaleTexts(menu.Titles),
+			"icon":        menu.Icon,
+			"path":        menu.Path,
+			"redirect":    menu.Redirect,
+			"component":   menu.Component,
+			"sort":        menu.Sort,
+			"status":      menu.Status,
+			"hidden":      menu.Hidden,
+			"no_cache":    menu.NoCache,
+			"always_show": menu.AlwaysShow,
+			"breadcrumb":  menu.Breadcrumb,
+			"active_menu": menu.ActiveMenu,
+			"parent_id":   parentId,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if funk.ContainsString(step.diff.Fields, "roles") {
+			association := tx.Model(&model.Menu{Model: gorm.Model{ID: step.id}}).Association("Roles")
+			if len(step.roles) == 0 {
+				err = association.Clear()
+			} else {
+				err = association.Replace(step.roles)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if onlyCreate || len(p.deletes) == 0 {
+		return nil
+	}
+	// Pruned menus go to the recycle bin like deleted ones, their roles are kept for a restore
+	deleteIds := make([]uint, 0, len(p.deletes))
+	for _, menu := range p.deletes {
+		deleteIds = append(deleteIds, menu.ID)
+	}
+	return recycle(tx, "menu", deleteIds, nil)
+}
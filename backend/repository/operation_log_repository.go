@@ -2,16 +2,49 @@ package repository
 
 import (
 	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/dto"
 	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/util"
 	"github.com/esyede/goadmin/backend/vo"
+	"bufio"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 type IOperationLogRepository interface {
-	GetOperationLogs(req *vo.OperationLogListRequest) ([]model.OperationLog, int64, error)
+	GetOperationLogs(req *vo.OperationLogListRequest) ([]model.OperationLog, int64, string, error)
+	GetOperationLogById(id uint) (model.OperationLog, error) // Get an operation log with its request parameters and response body
 	BatchDeleteOperationLogByIds(ids []uint) error
-	SaveOperationLogChannel(olc <-chan *model.OperationLog) // Handle OperationLogChan to log to database
+	StartOperationLogPipeline()                                                                           // Start writing queued operation logs to the database in the background
+	EnqueueOperationLog(log *model.OperationLog)                                                          // Queue an operation log without waiting for the database
+	DrainOperationLogs(ctx context.Context) error                                                         // Stop accepting operation logs and write the queued ones, for shutdown
+	DroppedOperationLogs() uint64                                                                         // Number of operation logs lost since the start
+	VerifyOperationLogs() (*dto.OperationLogChainDto, error)                                              // Walk the hash chain of the operation logs in audit mode and report the first broken link
+	ExportOperationLogs(req *vo.OperationLogListRequest, fn func(logs []*model.OperationLog) error) error // Walk the filtered operation logs in batches
+	ApplyOperationLogRetention() error                                                                    // Delete operation logs the retention policy does not keep, archiving them first if enabled
+	RunOperationLogRetentionSchedule()                                                                    // Periodically apply the retention policy
+	SubscribeOperationLogs(req *vo.OperationLogTailRequest) (*OperationLogSubscription, error)            // Receive the operation logs written by the pipeline that match the filters
+	UnsubscribeOperationLogs(sub *OperationLogSubscription)                                               // Stop receiving operation logs
+	CloseOperationLogSubscriptions()                                                                      // End all live tails and refuse new ones, for shutdown
 }
 
 type OperationLogRepository struct {
@@ -21,9 +54,83 @@ func NewOperationLogRepository() IOperationLogRepository {
 	return OperationLogRepository{}
 }
 
-func (o OperationLogRepository) GetOperationLogs(req *vo.OperationLogListRequest) ([]model.OperationLog, int64, error) {
+// Get operation logs, keyset paging returns the cursor of the next page instead of the total
+func (o OperationLogRepository) GetOperationLogs(req *vo.OperationLogListRequest) ([]model.OperationLog, int64, string, error) {
 	var list []model.OperationLog
-	db := common.DB.Model(&model.OperationLog{}).Order("start_time DESC")
+	db := operationLogListQuery(req)
+
+	// Sorting, the id breaks ties so that the order is stable across pages
+	column := operationLogSortColumns[req.SortBy]
+	if column == "" {
+		column = "start_time"
+	}
+	order := "DESC"
+	if req.SortOrder == "asc" {
+		order = "ASC"
+	}
+	orderBy := fmt.Sprintf("%s %s, id %s", column, order, order)
+
+	// Keyset paging continues after the last log of the previous page, which stays fast on large tables
+	if req.Keyset {
+		pageSize := req.PageSize
+		if pageSize <= 0 {
+			pageSize = 20
+		}
+		// The request parameters and response bodies are only shown in the log detail
+		query := db.Omit("params", "response").Order(orderBy)
+		if req.Cursor != "" {
+			value, id, err := decodeOperationLogCursor(req.Cursor, column)
+			if err != nil {
+				return list, 0, "", err
+			}
+			operator := "<"
+			if order == "ASC" {
+				operator = ">"
+			}
+			query = query.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, operator, column, operator), value, value, id)
+		}
+		// One more log than needed tells if there is a next page
+		if err := query.Limit(pageSize + 1).Find(&list).Error; err != nil {
+			return list, 0, "", err
+		}
+		if len(list) <= pageSize {
+			return list, 0, "", nil
+		}
+		list = list[:pageSize]
+		cursor, err := encodeOperationLogCursor(list[pageSize-1], column)
+		return list, 0, cursor, err
+	}
+
+	// Paging
+	var total int64
+	err := db.Count(&total).Error
+	if err != nil {
+		return list, total, "", err
+	}
+	query := db.Omit("params", "response").Order(orderBy)
+	pageNum := req.PageNum
+	pageSize := req.PageSize
+	if pageNum > 0 && pageSize > 0 {
+		err = query.Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&list).Error
+	} else {
+		err = query.Find(&list).Error
+	}
+
+	return list, total, "", err
+
+}
+
+// Walk the filtered operation logs in batches, so that large exports are not loaded into memory at once
+func (o OperationLogRepository) ExportOperationLogs(req *vo.OperationLogListRequest, fn func(logs []*model.OperationLog) error) error {
+	var list []*model.OperationLog
+	return operationLogListQuery(req).FindInBatches(&list, 500, func(tx *gorm.DB, batch int) error {
+		return fn(list)
+	}).Error
+}
+
+// Build the operation log list query from the filter conditions
+func operationLogListQuery(req *vo.OperationLogListRequest) *gorm.DB {
+	db := common.DB.Model(&model.OperationLog{})
 
 	username := strings.TrimSpace(req.Username)
 	if username != "" {
@@ -41,43 +148,917 @@ func (o OperationLogRepository) GetOperationLogs(req *vo.OperationLogListRequest
 	if status != 0 {
 		db = db.Where("status = ?", status)
 	}
+	if req.StatusClass != 0 {
+		db = db.Where("status BETWEEN ? AND ?", req.StatusClass*100, req.StatusClass*100+99)
+	}
+	if req.Method != "" {
+		db = db.Where("method = ?", req.Method)
+	}
+	if req.Browser != "" {
+		db = db.Where("browser = ?", req.Browser)
+	}
+	if req.Os != "" {
+		db = db.Where("os = ?", req.Os)
+	}
+	if req.DeviceType != "" {
+		db = db.Where("device_type = ?", req.DeviceType)
+	}
+	if req.StartTimeFrom != "" {
+		from, _ := time.ParseInLocation(operationLogTimeLayout, req.StartTimeFrom, time.Local)
+		db = db.Where("start_time >= ?", from)
+	}
+	if req.StartTimeTo != "" {
+		to, _ := time.ParseInLocation(operationLogTimeLayout, req.StartTimeTo, time.Local)
+		db = db.Where("start_time <= ?", to)
+	}
+	if req.MinTimeCost > 0 {
+		db = db.Where("time_cost >= ?", req.MinTimeCost)
+	}
+	if req.MaxTimeCost > 0 {
+		db = db.Where("time_cost <= ?", req.MaxTimeCost)
+	}
+	desc := strings.TrimSpace(req.Desc)
+	if desc != "" {
+		db = db.Where("`desc` LIKE ?", fmt.Sprintf("%%%s%%", desc))
+	}
+	keyword := strings.TrimSpace(req.Keyword)
+	if keyword != "" {
+		// The full-text index skips words shorter than 3 characters, those are scanned for instead
+		if len([]rune(keyword)) < 3 {
+			like := fmt.Sprintf("%%%s%%", keyword)
+			db = db.Where("params LIKE ? OR response LIKE ?", like, like)
+		} else {
+			phrase := `"` + strings.ReplaceAll(keyword, `"`, " ") + `"`
+			db = db.Where("MATCH(params, response) AGAINST (? IN BOOLEAN MODE)", phrase)
+		}
+	}
+	return db
+}
 
-	// Paging
-	var total int64
-	err := db.Count(&total).Error
-	if err != nil {
-		return list, total, err
+// Layout of the start time range of the operation log list
+const operationLogTimeLayout = "2006-01-02 15:04:05"
+
+// Columns the operation log list can be sorted by, all of them are indexed
+var operationLogSortColumns = map[string]string{
+	"startTime": "start_time",
+	"timeCost":  "time_cost",
+	"status":    "status",
+}
+
+// Position after the last log of a page
+type operationLogCursor struct {
+	Value string `json:"v"`
+	Id    uint   `json:"id"`
+}
+
+func encodeOperationLogCursor(log model.OperationLog, column string) (string, error) {
+	cursor := operationLogCursor{Id: log.ID}
+	switch column {
+	case "start_time":
+		cursor.Value = log.StartTime.Format(time.RFC3339Nano)
+	case "time_cost":
+		cursor.Value = strconv.FormatInt(log.TimeCost, 10)
+	default:
+		cursor.Value = strconv.Itoa(log.Status)
 	}
-	pageNum := req.PageNum
-	pageSize := req.PageSize
-	if pageNum > 0 && pageSize > 0 {
-		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&list).Error
-	} else {
-		err = db.Find(&list).Error
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
 
-	return list, total, err
+// A cursor is only valid for the sort column it was created with
+func decodeOperationLogCursor(s string, column string) (interface{}, uint, error) {
+	invalid := errors.New("Invalid cursor")
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, 0, invalid
+	}
+	var cursor operationLogCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Id == 0 {
+		return nil, 0, invalid
+	}
+	if column == "start_time" {
+		value, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, 0, invalid
+		}
+		return value, cursor.Id, nil
+	}
+	value, err := strconv.ParseInt(cursor.Value, 10, 64)
+	if err != nil {
+		return nil, 0, invalid
+	}
+	return value, cursor.Id, nil
+}
 
+// Get an operation log with its request parameters and response body
+func (o OperationLogRepository) GetOperationLogById(id uint) (model.OperationLog, error) {
+	var log model.OperationLog
+	err := common.DB.Where("id = ?", id).First(&log).Error
+	return log, err
 }
 
 func (o OperationLogRepository) BatchDeleteOperationLogByIds(ids []uint) error {
-	err := common.DB.Where("id IN (?)", ids).Unscoped().Delete(&model.OperationLog{}).Error
+	if config.Conf.OperationLog.Audit {
+		return ErrOperationLogAudit
+	}
+	// Soft delete, the logs stay in the recycle bin until they are purged
+	err := common.DB.Where("id IN (?)", ids).Delete(&model.OperationLog{}).Error
 	return err
 }
 
-// var Logs []model.OperationLog // Global variables need to be locked by multiple threads, so each thread maintains one by itself.
-// Handle OperationLogChan to log to database
-func (o OperationLogRepository) SaveOperationLogChannel(olc <-chan *model.OperationLog) {
-	// Will only be executed once when the thread is started
-	Logs := make([]model.OperationLog, 0)
+// Queue between the requests and the database writers of operation logs
+type operationLogPipeline struct {
+	queue   chan *model.OperationLog
+	mu      sync.RWMutex // Guards closing the queue against concurrent sends
+	closed  bool
+	dropped uint64        // Accessed atomically
+	abort   chan struct{} // Closed when draining takes too long, writers stop retrying and spool their batches
+	done    chan struct{} // Closed when draining starts, stops the spool replay
+	wg      sync.WaitGroup
+}
+
+var logPipeline *operationLogPipeline
 
-	// Always execute - it will execute after receiving olc
-	for log := range olc {
-		Logs = append(Logs, *log)
-		// Every 10 records are sent to the database
-		if len(Logs) > 5 {
-			common.DB.Create(&Logs)
-			Logs = make([]model.OperationLog, 0)
+// Start writing queued operation logs to the database in the background.
+// Logs are written when a batch is full or the flush interval passed, whichever comes first.
+func (o OperationLogRepository) StartOperationLogPipeline() {
+	conf := config.Conf.OperationLog
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	workers := conf.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	logPipeline = &operationLogPipeline{
+		queue: make(chan *model.OperationLog, queueSize),
+		abort: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		logPipeline.wg.Add(1)
+		go logPipeline.write()
+	}
+	// Logs spooled before a restart are written again too
+	go logPipeline.replaySpool()
+}
+
+// Queue an operation log without waiting for the database, when the queue is full the log is spooled or dropped
+func (o OperationLogRepository) EnqueueOperationLog(log *model.OperationLog) {
+	p := logPipeline
+	if p == nil {
+		return
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if !p.closed {
+		select {
+		case p.queue <- log:
+			return
+		default:
+		}
+	}
+	if config.Conf.OperationLog.Overflow == "spool" {
+		if err := spoolOperationLogs([]model.OperationLog{*log}); err == nil {
+			return
+		}
+	}
+	p.drop(1)
+}
+
+// Stop accepting operation logs and write the queued ones, the ones that cannot be written before ctx ends are spooled
+func (o OperationLogRepository) DrainOperationLogs(ctx context.Context) error {
+	p := logPipeline
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+		close(p.done)
+	}
+	p.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+	// Writers waiting for the database give up and spool what they have,
+	// a writer stuck in a database call is not waited for much longer
+	close(p.abort)
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+	}
+	return ctx.Err()
+}
+
+// Number of operation logs lost since the start, because the queue was full or they could not be spooled
+func (o OperationLogRepository) DroppedOperationLogs() uint64 {
+	if logPipeline == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&logPipeline.dropped)
+}
+
+func (p *operationLogPipeline) drop(n int) {
+	dropped := atomic.AddUint64(&p.dropped, uint64(n))
+	// Warn now and then instead of for every log
+	if dropped-uint64(n) == 0 || dropped/1000 != (dropped-uint64(n))/1000 {
+		common.Log.Warnf("%d operation logs have been dropped so far", dropped)
+	}
+}
+
+// Write queued logs in batches until the queue is closed and empty
+func (p *operationLogPipeline) write() {
+	defer p.wg.Done()
+	conf := config.Conf.OperationLog
+	batchSize := conf.BatchSize
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+	interval := time.Duration(conf.FlushInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]model.OperationLog, 0, batchSize)
+	for {
+		select {
+		case log, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			// Locating the address may take a while, so it is done here instead of in the request
+			log.IpLocation = common.IpLocation(log.Ip)
+			// Derived from the user agent, which the audit hash covers, so they are not hashed themselves
+			ua := util.ParseUserAgent(log.UserAgent)
+			log.Browser, log.Os, log.DeviceType = ua.Browser, ua.Os, ua.DeviceType
+			batch = append(batch, *log)
+			if len(batch) >= batchSize {
+				p.flush(batch)
+				batch = make([]model.OperationLog, 0, batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = make([]model.OperationLog, 0, batchSize)
+			}
+		}
+	}
+}
+
+// Write a batch to the database, retrying with a growing delay, and spool it when the database keeps failing
+func (p *operationLogPipeline) flush(batch []model.OperationLog) {
+	if len(batch) == 0 {
+		return
+	}
+	err := createWithRetry(batch, p.abort)
+	if err == nil {
+		// Published once written, so that the tail shows the ids and creation times.
+		// Spooled logs are written much later and are left out of the tail.
+		for i := range batch {
+			logTail.publish(&batch[i])
 		}
+		return
+	}
+	common.Log.Errorf("Failed to write %d operation logs: %v", len(batch), err)
+	if err := spoolOperationLogs(batch); err != nil {
+		common.Log.Errorf("Failed to spool operation logs: %v", err)
+		p.drop(len(batch))
+	}
+}
+
+func createWithRetry(batch []model.OperationLog, abort <-chan struct{}) error {
+	maxRetries := config.Conf.OperationLog.MaxRetries
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		err := createOperationLogs(batch)
+		if err == nil || attempt >= maxRetries {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-abort:
+			return err
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// Append operation logs to a new file in the spool directory, one json log per line.
+// Files are written under a temporary name first so the replay never reads half a file.
+func spoolOperationLogs(logs []model.OperationLog) error {
+	dir := config.Conf.OperationLog.SpoolPath
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(dir, fmt.Sprintf("operation-logs-%d-*.tmp", time.Now().UnixNano()))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for i := range logs {
+		if err = encoder.Encode(&logs[i]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), strings.TrimSuffix(file.Name(), ".tmp")+".jsonl")
+}
+
+// Write spooled logs to the database every flush interval until draining starts, oldest files first
+func (p *operationLogPipeline) replaySpool() {
+	interval := time.Duration(config.Conf.OperationLog.FlushInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	// Spooled logs are not urgent
+	ticker := time.NewTicker(interval * 12)
+	defer ticker.Stop()
+	for {
+		files, _ := filepath.Glob(filepath.Join(config.Conf.OperationLog.SpoolPath, "operation-logs-*.jsonl"))
+		sort.Strings(files)
+		for _, name := range files {
+			if err := replaySpoolFile(name); err != nil {
+				// The database is probably still unavailable, try again later
+				common.Log.Errorf("Failed to write spooled operation logs of %s: %v", name, err)
+				break
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func replaySpoolFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	logs := make([]model.OperationLog, 0)
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var log model.OperationLog
+		if err = decoder.Decode(&log); err != nil {
+			break
+		}
+		logs = append(logs, log)
+	}
+	file.Close()
+	if err != nil {
+		// A damaged file would block the replay forever
+		common.Log.Errorf("Skipping damaged operation log spool file %s: %v", name, err)
+		return os.Rename(name, name+".damaged")
+	}
+	if len(logs) > 0 {
+		if err := createOperationLogs(logs); err != nil {
+			return err
+		}
+	}
+	return os.Remove(name)
+}
+
+// Delete operation logs the retention policy does not keep, archiving them first if enabled.
+// Rules give the logs of some statuses their own age, the other logs are kept for the max age,
+// and finally only the newest logs are kept when the table has more than the max rows.
+func (o OperationLogRepository) ApplyOperationLogRetention() error {
+	conf := config.Conf.OperationLog.Retention
+	if conf == nil {
+		return nil
+	}
+	var archive *operationLogArchive
+	if conf.Archive {
+		archive = &operationLogArchive{dir: conf.ArchivePath}
+		defer func() {
+			if err := archive.close(); err != nil {
+				common.Log.Errorf("Failed to close operation log archive: %v", err)
+			}
+		}()
+	}
+
+	if config.Conf.OperationLog.Audit {
+		return applyAuditRetention(conf, archive)
+	}
+
+	now := time.Now()
+	var deleted int64
+	// Logs matched by an earlier rule are left to that rule
+	matched := make([]string, 0, len(conf.Rules))
+	for _, rule := range conf.Rules {
+		condition, err := retentionStatusCondition(rule.Status)
+		if err != nil {
+			return err
+		}
+		if rule.MaxAge > 0 {
+			where := condition
+			if len(matched) > 0 {
+				where = fmt.Sprintf("%s AND NOT (%s)", condition, strings.Join(matched, " OR "))
+			}
+			n, err := pruneOperationLogs(archive, where+" AND start_time < ?", now.AddDate(0, 0, -rule.MaxAge))
+			deleted += n
+			if err != nil {
+				return err
+			}
+		}
+		matched = append(matched, condition)
+	}
+	if conf.MaxAge > 0 {
+		where := "start_time < ?"
+		if len(matched) > 0 {
+			where = fmt.Sprintf("NOT (%s) AND start_time < ?", strings.Join(matched, " OR "))
+		}
+		n, err := pruneOperationLogs(archive, where, now.AddDate(0, 0, -conf.MaxAge))
+		deleted += n
+		if err != nil {
+			return err
+		}
+	}
+	if conf.MaxRows > 0 {
+		// Ids grow with time, everything up to the first log beyond the max rows is deleted
+		var ids []uint
+		err := common.DB.Unscoped().Model(&model.OperationLog{}).Order("id DESC").Offset(conf.MaxRows).Limit(1).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			n, err := pruneOperationLogs(archive, "id <= ?", ids[0])
+			deleted += n
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if deleted > 0 {
+		common.Log.Infof("Deleted %d operation logs by the retention policy", deleted)
+	}
+	return nil
+}
+
+// Periodically apply the retention policy
+func (o OperationLogRepository) RunOperationLogRetentionSchedule() {
+	interval := time.Hour
+	if conf := config.Conf.OperationLog.Retention; conf != nil && conf.Interval > 0 {
+		interval = time.Duration(conf.Interval) * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := o.ApplyOperationLogRetention(); err != nil {
+			common.Log.Errorf("Failed to apply the operation log retention policy: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Condition of a retention rule status, a code like "404" or a class like "4xx"
+func retentionStatusCondition(status string) (string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if len(status) == 3 && strings.HasSuffix(status, "xx") && status[0] >= '1' && status[0] <= '5' {
+		class := int(status[0] - '0')
+		return fmt.Sprintf("status BETWEEN %d AND %d", class*100, class*100+99), nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 599 {
+		return "", fmt.Errorf("Invalid status of operation log retention rule: %q", status)
+	}
+	return fmt.Sprintf("status = %d", code), nil
+}
+
+// Permanently delete the matching operation logs in batches, the batches are archived before they are deleted
+func pruneOperationLogs(archive *operationLogArchive, where string, args ...interface{}) (int64, error) {
+	var deleted int64
+	for {
+		var logs []model.OperationLog
+		db := common.DB.Unscoped().Where(where, args...).Order("id").Limit(1000)
+		if archive == nil {
+			db = db.Select("id")
+		}
+		if err := db.Find(&logs).Error; err != nil {
+			return deleted, err
+		}
+		if len(logs) == 0 {
+			return deleted, nil
+		}
+		if archive != nil {
+			if err := archive.write(logs); err != nil {
+				return deleted, fmt.Errorf("Failed to archive operation logs: %v", err)
+			}
+		}
+		ids := make([]uint, len(logs))
+		for i, log := range logs {
+			ids[i] = log.ID
+		}
+		result := common.DB.Unscoped().Where("id IN (?)", ids).Delete(&model.OperationLog{})
+		deleted += result.RowsAffected
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+	}
+}
+
+// Gzipped json lines file of the operation logs deleted by one run of the retention policy, created on the first write
+type operationLogArchive struct {
+	dir  string
+	file *os.File
+	gz   *gzip.Writer
+}
+
+// Archived logs are flushed to the file before they are deleted
+func (a *operationLogArchive) write(logs []model.OperationLog) error {
+	if a.file == nil {
+		if err := os.MkdirAll(a.dir, 0755); err != nil {
+			return err
+		}
+		name := filepath.Join(a.dir, fmt.Sprintf("operation-logs-%s.jsonl.gz", time.Now().Format("20060102150405")))
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		a.file = file
+		a.gz = gzip.NewWriter(file)
+	}
+	encoder := json.NewEncoder(a.gz)
+	for i := range logs {
+		if err := encoder.Encode(&logs[i]); err != nil {
+			return err
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *operationLogArchive) close() error {
+	if a.file == nil {
+		return nil
+	}
+	err := a.gz.Close()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Operation logs cannot be deleted in audit mode
+var ErrOperationLogAudit = errors.New("Operation logs cannot be deleted in audit mode")
+
+// Method of the log recording the deletion of the oldest logs by the retention policy in audit mode
+const operationLogTombstoneMethod = "AUDIT"
+
+// Parameters of a tombstone log, the first remaining log is chained to the last deleted one
+type operationLogTombstone struct {
+	ThroughId   uint   `json:"throughId"`
+	ThroughHash string `json:"throughHash"`
+	Count       int64  `json:"count"`
+}
+
+// Hash of the newest chained log, logs are chained one writer at a time so the ids follow the chain
+var operationLogChain struct {
+	sync.Mutex
+	loaded   bool
+	lastHash string
+}
+
+// Write operation logs in one transaction, chaining them to the newest log in audit mode
+func createOperationLogs(logs []model.OperationLog) error {
+	if !config.Conf.OperationLog.Audit {
+		return common.DB.CreateInBatches(&logs, 100).Error
+	}
+	operationLogChain.Lock()
+	defer operationLogChain.Unlock()
+	if !operationLogChain.loaded {
+		var hashes []string
+		err := common.DB.Unscoped().Model(&model.OperationLog{}).Where("hash <> ''").Order("id DESC").Limit(1).Pluck("hash", &hashes).Error
+		if err != nil {
+			return err
+		}
+		if len(hashes) > 0 {
+			operationLogChain.lastHash = hashes[0]
+		}
+		operationLogChain.loaded = true
+	}
+
+	prevHash := operationLogChain.lastHash
+	for i := range logs {
+		// Ids of a failed attempt are not valid anymore, the database stores milliseconds
+		logs[i].ID = 0
+		logs[i].StartTime = logs[i].StartTime.Truncate(time.Millisecond)
+		logs[i].PrevHash = prevHash
+		logs[i].Hash = operationLogHash(&logs[i])
+		prevHash = logs[i].Hash
+	}
+	err := common.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(&logs, 100).Error
+	})
+	if err != nil {
+		return err
+	}
+	operationLogChain.lastHash = prevHash
+	return nil
+}
+
+// Hash of the content of a log and the hash of the previous log, keyed by the audit key when there is one
+func operationLogHash(log *model.OperationLog) string {
+	content, _ := json.Marshal([]interface{}{
+		log.PrevHash,
+		log.Username,
+		log.Impersonator,
+		log.Ip,
+		log.IpLocation,
+		log.Method,
+		log.Path,
+		log.Desc,
+		log.Status,
+		log.StartTime.UnixMilli(),
+		log.TimeCost,
+		log.UserAgent,
+		log.Params,
+		log.Response,
+	})
+	if key := config.Conf.OperationLog.AuditKey; key != "" {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(content)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Delete the oldest logs the retention policy does not keep, logs in between cannot be deleted without breaking the chain.
+// The deletion is recorded in the chain first, so an interrupted deletion is still accounted for.
+func applyAuditRetention(conf *config.OperationLogRetentionConfig, archive *operationLogArchive) error {
+	var throughId uint
+	if conf.MaxAge > 0 {
+		// Everything before the first log that is young enough
+		var ids []uint
+		cutoff := time.Now().AddDate(0, 0, -conf.MaxAge)
+		err := common.DB.Unscoped().Model(&model.OperationLog{}).Where("start_time >= ?", cutoff).Order("id").Limit(1).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			throughId = ids[0] - 1
+		} else {
+			err = common.DB.Unscoped().Model(&model.OperationLog{}).Order("id DESC").Limit(1).Pluck("id", &ids).Error
+			if err != nil {
+				return err
+			}
+			if len(ids) > 0 {
+				throughId = ids[0]
+			}
+		}
+	}
+	if conf.MaxRows > 0 {
+		var ids []uint
+		err := common.DB.Unscoped().Model(&model.OperationLog{}).Order("id DESC").Offset(conf.MaxRows).Limit(1).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 && ids[0] > throughId {
+			throughId = ids[0]
+		}
+	}
+	if throughId == 0 {
+		return nil
+	}
+
+	var last model.OperationLog
+	err := common.DB.Unscoped().Select("id", "hash").Where("id <= ?", throughId).Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil || last.ID == 0 {
+		return err
+	}
+	var count int64
+	err = common.DB.Unscoped().Model(&model.OperationLog{}).Where("id <= ?", throughId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	params, _ := json.Marshal(operationLogTombstone{ThroughId: last.ID, ThroughHash: last.Hash, Count: count})
+	tombstone := model.OperationLog{
+		Username:  "system",
+		Method:    operationLogTombstoneMethod,
+		Path:      "retention",
+		Desc:      fmt.Sprintf("Deleted %d operation logs through #%d", count, last.ID),
+		Status:    200,
+		StartTime: time.Now(),
+		Params:    string(params),
+	}
+	if err := createOperationLogs([]model.OperationLog{tombstone}); err != nil {
+		return err
+	}
+	deleted, err := pruneOperationLogs(archive, "id <= ?", last.ID)
+	if deleted > 0 {
+		common.Log.Infof("Deleted %d operation logs by the retention policy", deleted)
+	}
+	return err
+}
+
+// Walk the hash chain of the operation logs from the oldest chained log and report the first broken link.
+// Logs written before audit mode was enabled are not chained and are skipped.
+func (o OperationLogRepository) VerifyOperationLogs() (*dto.OperationLogChainDto, error) {
+	report := &dto.OperationLogChainDto{Intact: true}
+	var (
+		list       []*model.OperationLog
+		started    bool
+		prevHash   string
+		first      *model.OperationLog
+		tombstones []operationLogTombstone
+	)
+	err := common.DB.Unscoped().FindInBatches(&list, 500, func(tx *gorm.DB, batch int) error {
+		for _, log := range list {
+			if !started {
+				if log.Hash == "" {
+					continue
+				}
+				started = true
+				first = &model.OperationLog{}
+				*first = *log
+				prevHash = log.PrevHash
+			}
+			switch {
+			case log.Hash == "":
+				report.Reason = "The log is not chained"
+			case log.PrevHash != prevHash:
+				report.Reason = "The previous log was deleted or changed"
+			case operationLogHash(log) != log.Hash:
+				report.Reason = "The log was changed"
+			}
+			if report.Reason != "" {
+				report.Intact = false
+				report.BrokenId = log.ID
+				return errStopVerification
+			}
+			if log.Method == operationLogTombstoneMethod {
+				var tombstone operationLogTombstone
+				if json.Unmarshal([]byte(log.Params), &tombstone) == nil {
+					tombstones = append(tombstones, tombstone)
+				}
+			}
+			prevHash = log.Hash
+			report.Checked++
+		}
+		return nil
+	}).Error
+	if err != nil && err != errStopVerification {
+		return nil, err
+	}
+	if !report.Intact || first == nil {
+		return report, nil
+	}
+	report.HeadHash = prevHash
+
+	// The oldest logs may only be missing when their deletion was recorded
+	if first.PrevHash != "" {
+		recorded := false
+		for _, tombstone := range tombstones {
+			// An interrupted deletion leaves some of the logs it recorded
+			if tombstone.ThroughHash == first.PrevHash || first.ID <= tombstone.ThroughId {
+				recorded = true
+				break
+			}
+		}
+		if !recorded {
+			report.Intact = false
+			report.BrokenId = first.ID
+			report.Reason = "Older logs were deleted without being recorded"
+		}
+	}
+	return report, nil
+}
+
+var errStopVerification = errors.New("stop verification")
+
+// Subscription to the operation logs passing through the pipeline, for the live tail
+type OperationLogSubscription struct {
+	Logs    chan *model.OperationLog // Closed when the subscription ends
+	filter  vo.OperationLogTailRequest
+	dropped uint64 // Accessed atomically
+}
+
+// Number of logs the subscriber missed because it did not keep up
+func (s *OperationLogSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *OperationLogSubscription) match(log *model.OperationLog) bool {
+	f := s.filter
+	if f.Username != "" && log.Username != f.Username {
+		return false
+	}
+	if f.PathPrefix != "" && !strings.HasPrefix(log.Path, f.PathPrefix) {
+		return false
+	}
+	if f.Status != "" {
+		status := strconv.Itoa(log.Status)
+		if strings.HasSuffix(f.Status, "xx") {
+			return status[:1] == f.Status[:1]
+		}
+		return status == f.Status
+	}
+	return true
+}
+
+// Subscribers of the live tail, the pipeline never waits for them
+type operationLogTail struct {
+	mu     sync.RWMutex
+	subs   map[*OperationLogSubscription]struct{}
+	closed bool
+}
+
+var logTail = &operationLogTail{subs: make(map[*OperationLogSubscription]struct{})}
+
+var (
+	ErrTooManySubscribers = errors.New("Too many live tails are open")
+	ErrTailClosed         = errors.New("The server is shutting down")
+)
+
+// Hand a log to the subscribers whose filters it matches, a subscriber whose buffer is full misses it
+func (t *operationLogTail) publish(log *model.OperationLog) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for sub := range t.subs {
+		if !sub.match(log) {
+			continue
+		}
+		select {
+		case sub.Logs <- log:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Receive the operation logs written by the pipeline that match the filters
+func (o OperationLogRepository) SubscribeOperationLogs(req *vo.OperationLogTailRequest) (*OperationLogSubscription, error) {
+	maxSubscribers, buffer := 20, 100
+	if conf := config.Conf.OperationLog.Tail; conf != nil {
+		if conf.MaxSubscribers > 0 {
+			maxSubscribers = conf.MaxSubscribers
+		}
+		if conf.Buffer > 0 {
+			buffer = conf.Buffer
+		}
+	}
+	logTail.mu.Lock()
+	defer logTail.mu.Unlock()
+	if logTail.closed {
+		return nil, ErrTailClosed
+	}
+	if len(logTail.subs) >= maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	sub := &OperationLogSubscription{Logs: make(chan *model.OperationLog, buffer), filter: *req}
+	logTail.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Stop receiving operation logs
+func (o OperationLogRepository) UnsubscribeOperationLogs(sub *OperationLogSubscription) {
+	logTail.mu.Lock()
+	defer logTail.mu.Unlock()
+	if _, ok := logTail.subs[sub]; ok {
+		delete(logTail.subs, sub)
+		close(sub.Logs)
+	}
+}
+
+// End all live tails and refuse new ones, the server does not shut down while streams are open
+func (o OperationLogRepository) CloseOperationLogSubscriptions() {
+	logTail.mu.Lock()
+	defer logTail.mu.Unlock()
+	logTail.closed = true
+	for sub := range logTail.subs {
+		delete(logTail.subs, sub)
+		close(sub.Logs)
 	}
 }
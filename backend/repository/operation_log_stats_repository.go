@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/dto"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/vo"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IOperationLogStatsRepository interface {
+	GetTraffic(req *vo.OperationLogStatsRequest) ([]dto.OperationLogTrafficDto, error)            // Get the number of requests and errors per time bucket
+	GetTopUsers(req *vo.OperationLogStatsRequest) ([]dto.OperationLogTopUserDto, error)           // Get the users with the most requests
+	GetTopPaths(req *vo.OperationLogStatsRequest) ([]dto.OperationLogPathStatsDto, error)         // Get the endpoints with the most requests and their time costs
+	GetStatuses(req *vo.OperationLogStatsRequest) ([]dto.OperationLogStatusDto, error)            // Get the number of responses per status code
+	GetLoginFailures(req *vo.OperationLogStatsRequest) (*dto.OperationLogLoginFailuresDto, error) // Get the failed logins per time bucket and the addresses they came from most
+	GetClients(req *vo.OperationLogStatsRequest) (*dto.OperationLogClientStatsDto, error)         // Get the most used browsers, operating systems and device types
+	RollupOperationLogs() error                                                                   // Calculate the hourly statistics of the recent operation logs again
+	RunOperationLogRollupSchedule()                                                               // Periodically calculate the hourly statistics
+}
+
+type OperationLogStatsRepository struct {
+}
+
+func NewOperationLogStatsRepository() IOperationLogStatsRepository {
+	return OperationLogStatsRepository{}
+}
+
+// Path of the login requests, failed logins are answered with a status of 400 or more
+const operationLogLoginPath = "/base/login"
+
+// Upper bounds (ms) of the request time buckets of the rollup histograms, the last bucket has no upper bound
+var operationLogHistogramBounds = []int64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Table the statistics are calculated from, the operation logs themselves or their hourly rollups
+type operationLogStatsSource struct {
+	rollup      bool
+	timeColumn  string
+	count       string
+	errors      string
+	timeCostSum string
+	timeCostMax string
+}
+
+var (
+	rawStatsSource = operationLogStatsSource{
+		timeColumn:  "start_time",
+		count:       "COUNT(*)",
+		errors:      "SUM(status >= 400)",
+		timeCostSum: "SUM(time_cost)",
+		timeCostMax: "MAX(time_cost)",
+	}
+	rollupStatsSource = operationLogStatsSource{
+		rollup:      true,
+		timeColumn:  "bucket",
+		count:       "SUM(count)",
+		errors:      "SUM(IF(status >= 400, count, 0))",
+		timeCostSum: "SUM(time_cost_sum)",
+		timeCostMax: "MAX(time_cost_max)",
+	}
+)
+
+// Rollups are used when they are enabled, unless the logs themselves are asked for
+func statsSource(req *vo.OperationLogStatsRequest) operationLogStatsSource {
+	conf := config.Conf.OperationLog.Rollup
+	if req.Source == "raw" || conf == nil || !conf.Enabled {
+		return rawStatsSource
+	}
+	return rollupStatsSource
+}
+
+// Query of a source within the time range of the request, the last 24 hours by default.
+// Rollups cover whole hours, so their range starts at the hour of the start time.
+func (s operationLogStatsSource) query(req *vo.OperationLogStatsRequest) *gorm.DB {
+	to := time.Now()
+	if req.StartTimeTo != "" {
+		to, _ = time.ParseInLocation(operationLogTimeLayout, req.StartTimeTo, time.Local)
+	}
+	from := to.Add(-24 * time.Hour)
+	if req.StartTimeFrom != "" {
+		from, _ = time.ParseInLocation(operationLogTimeLayout, req.StartTimeFrom, time.Local)
+	}
+	if s.rollup {
+		return common.DB.Model(&model.OperationLogRollup{}).Where("bucket >= ? AND bucket <= ?", startOfHour(from), to)
+	}
+	return common.DB.Model(&model.OperationLog{}).Where("start_time >= ? AND start_time <= ?", from, to)
+}
+
+// Expression of the time bucket of a row
+func (s operationLogStatsSource) bucket(interval string) string {
+	if interval == "day" {
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d')", s.timeColumn)
+	}
+	return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:00')", s.timeColumn)
+}
+
+func statsTop(req *vo.OperationLogStatsRequest) int {
+	if req.Top <= 0 {
+		return 10
+	}
+	return req.Top
+}
+
+// Get the number of requests and errors per time bucket
+func (o OperationLogStatsRepository) GetTraffic(req *vo.OperationLogStatsRequest) ([]dto.OperationLogTrafficDto, error) {
+	s := statsSource(req)
+	list := make([]dto.OperationLogTrafficDto, 0)
+	err := s.query(req).
+		Select(fmt.Sprintf("%s AS time, %s AS count, %s AS errors", s.bucket(req.Interval), s.count, s.errors)).
+		Group("time").Order("time").Scan(&list).Error
+	return list, err
+}
+
+// Get the users with the most requests
+func (o OperationLogStatsRepository) GetTopUsers(req *vo.OperationLogStatsRequest) ([]dto.OperationLogTopUserDto, error) {
+	s := statsSource(req)
+	list := make([]dto.OperationLogTopUserDto, 0)
+	err := s.query(req).
+		Select(fmt.Sprintf("username, %s AS count, %s AS errors", s.count, s.errors)).
+		Where("username <> ''").
+		Group("username").Order("count DESC").Limit(statsTop(req)).Scan(&list).Error
+	return list, err
+}
+
+// Get the endpoints with the most requests and their time costs.
+// Percentiles are exact when calculated from the logs and the upper bounds of histogram buckets when calculated from rollups.
+func (o OperationLogStatsRepository) GetTopPaths(req *vo.OperationLogStatsRequest) ([]dto.OperationLogPathStatsDto, error) {
+	s := statsSource(req)
+	list := make([]dto.OperationLogPathStatsDto, 0)
+	err := s.query(req).
+		Select(fmt.Sprintf("method, path, %s AS count, %s AS errors, %s / %s AS avg_time_cost, %s AS max_time_cost",
+			s.count, s.errors, s.timeCostSum, s.count, s.timeCostMax)).
+		Group("method, path").Order("count DESC").Limit(statsTop(req)).Scan(&list).Error
+	if err != nil {
+		return list, err
+	}
+
+	for i := range list {
+		stats := &list[i]
+		if s.rollup {
+			var histograms []string
+			err = s.query(req).Where("method = ? AND path = ?", stats.Method, stats.Path).Pluck("histogram", &histograms).Error
+			if err != nil {
+				return list, err
+			}
+			counts := mergeHistograms(histograms)
+			stats.P50TimeCost = histogramPercentile(counts, 0.5, stats.MaxTimeCost)
+			stats.P95TimeCost = histogramPercentile(counts, 0.95, stats.MaxTimeCost)
+			continue
+		}
+		// The n-th smallest time cost. The path, method and time cost index keeps this from sorting the logs,
+		// but the logs before the offset are still read to filter them by time, the rollups are cheaper on large tables.
+		for _, p := range []struct {
+			percentile float64
+			value      *int64
+		}{{0.5, &stats.P50TimeCost}, {0.95, &stats.P95TimeCost}} {
+			offset := int(math.Ceil(p.percentile*float64(stats.Count))) - 1
+			if offset < 0 {
+				offset = 0
+			}
+			var costs []int64
+			err = s.query(req).Where("method = ? AND path = ?", stats.Method, stats.Path).
+				Order("time_cost").Offset(offset).Limit(1).Pluck("time_cost", &costs).Error
+			if err != nil {
+				return list, err
+			}
+			if len(costs) > 0 {
+				*p.value = costs[0]
+			}
+		}
+	}
+	return list, nil
+}
+
+// Get the number of responses per status code
+func (o OperationLogStatsRepository) GetStatuses(req *vo.OperationLogStatsRequest) ([]dto.OperationLogStatusDto, error) {
+	s := statsSource(req)
+	list := make([]dto.OperationLogStatusDto, 0)
+	err := s.query(req).
+		Select(fmt.Sprintf("status, %s AS count", s.count)).
+		Group("status").Order("status").Scan(&list).Error
+	return list, err
+}
+
+// Get the failed logins per time bucket and the addresses they came from most.
+// Rollups do not keep the addresses, they are always counted from the logs.
+func (o OperationLogStatsRepository) GetLoginFailures(req *vo.OperationLogStatsRequest) (*dto.OperationLogLoginFailuresDto, error) {
+	s := statsSource(req)
+	failures := &dto.OperationLogLoginFailuresDto{
+		Trend:  make([]dto.OperationLogTrafficDto, 0),
+		TopIps: make([]dto.OperationLogIpCountDto, 0),
+	}
+	err := s.query(req).
+		Select(fmt.Sprintf("%s AS time, %s AS count, %s AS errors", s.bucket(req.Interval), s.count, s.errors)).
+		Where("path = ? AND status >= 400", operationLogLoginPath).
+		Group("time").Order("time").Scan(&failures.Trend).Error
+	if err != nil {
+		return nil, err
+	}
+	err = rawStatsSource.query(req).
+		Select("ip, COUNT(*) AS count").
+		Where("path = ? AND status >= 400", operationLogLoginPath).
+		Group("ip").Order("count DESC").Limit(statsTop(req)).Scan(&failures.TopIps).Error
+	return failures, err
+}
+
+// Get the most used browsers, operating systems and device types.
+// Rollups do not keep the user agents, they are always counted from the logs.
+func (o OperationLogStatsRepository) GetClients(req *vo.OperationLogStatsRequest) (*dto.OperationLogClientStatsDto, error) {
+	clients := &dto.OperationLogClientStatsDto{}
+	for _, group := range []struct {
+		column string
+		list   *[]dto.OperationLogNameCountDto
+	}{{"browser", &clients.Browsers}, {"os", &clients.Systems}, {"device_type", &clients.DeviceTypes}} {
+		*group.list = make([]dto.OperationLogNameCountDto, 0)
+		err := rawStatsSource.query(req).
+			Select(group.column + " AS name, COUNT(*) AS count").
+			Group(group.column).Order("count DESC").Limit(statsTop(req)).Scan(group.list).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return clients, nil
+}
+
+// Calculate the hourly statistics of the recent operation logs again.
+// The last two hours are always calculated again, logs are written in the background and may arrive late.
+func (o OperationLogStatsRepository) RollupOperationLogs() error {
+	var latest []time.Time
+	err := common.DB.Model(&model.OperationLogRollup{}).Order("bucket DESC").Limit(1).Pluck("bucket", &latest).Error
+	if err != nil {
+		return err
+	}
+	var from time.Time
+	if len(latest) > 0 {
+		from = startOfHour(latest[0].Add(-time.Hour))
+	} else {
+		// Nothing rolled up yet, start at the oldest log
+		var oldest []time.Time
+		err := common.DB.Model(&model.OperationLog{}).Order("start_time").Limit(1).Pluck("start_time", &oldest).Error
+		if err != nil || len(oldest) == 0 {
+			return err
+		}
+		from = startOfHour(oldest[0])
+	}
+	to := startOfHour(time.Now()).Add(time.Hour)
+
+	// A day at a time, so that a long backlog does not hold locks for long
+	for start := from; start.Before(to); start = start.AddDate(0, 0, 1) {
+		end := start.AddDate(0, 0, 1)
+		if end.After(to) {
+			end = to
+		}
+		if err := rollupOperationLogs(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Periodically calculate the hourly statistics
+func (o OperationLogStatsRepository) RunOperationLogRollupSchedule() {
+	conf := config.Conf.OperationLog.Rollup
+	if conf == nil || !conf.Enabled {
+		return
+	}
+	interval := time.Duration(conf.Interval) * time.Minute
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := o.RollupOperationLogs(); err != nil {
+			common.Log.Errorf("Failed to roll up operation logs: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Replace the rollups of the hours from start until end
+func rollupOperationLogs(start time.Time, end time.Time) error {
+	histogram := make([]string, 0, len(operationLogHistogramBounds)+1)
+	lower := int64(0)
+	for _, bound := range operationLogHistogramBounds {
+		histogram = append(histogram, fmt.Sprintf("SUM(time_cost >= %d AND time_cost < %d)", lower, bound))
+		lower = bound
+	}
+	histogram = append(histogram, fmt.Sprintf("SUM(time_cost >= %d)", lower))
+
+	return common.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("bucket >= ? AND bucket < ?", start, end).Delete(&model.OperationLogRollup{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO operation_log_rollups (bucket, method, path, status, username, count, time_cost_sum, time_cost_max, histogram)
+SELECT DATE_FORMAT(start_time, '%Y-%m-%d %H:00:00'), method, path, status, username, COUNT(*), SUM(time_cost), MAX(time_cost), CONCAT_WS(',', `+strings.Join(histogram, ", ")+`)
+FROM operation_logs WHERE deleted_at IS NULL AND start_time >= ? AND start_time < ?
+GROUP BY 1, method, path, status, username`, start, end).Error
+	})
+}
+
+// Sum of the counts of histograms from rollups
+func mergeHistograms(histograms []string) []int64 {
+	counts := make([]int64, len(operationLogHistogramBounds)+1)
+	for _, histogram := range histograms {
+		for i, value := range strings.Split(histogram, ",") {
+			if i >= len(counts) {
+				break
+			}
+			n, _ := strconv.ParseInt(value, 10, 64)
+			counts[i] += n
+		}
+	}
+	return counts
+}
+
+// Upper bound of the histogram bucket holding the percentile, the longest time cost for the last bucket
+func histogramPercentile(counts []int64, percentile float64, max int64) int64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(percentile * float64(total)))
+	var seen int64
+	for i, n := range counts {
+		seen += n
+		if seen >= rank {
+			if i < len(operationLogHistogramBounds) && operationLogHistogramBounds[i] < max {
+				return operationLogHistogramBounds[i]
+			}
+			return max
+		}
+	}
+	return max
+}
+
+func startOfHour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/vo"
+	"fmt"
+	"strings"
+)
+
+type IPostRepository interface {
+	GetPosts(req *vo.PostListRequest) ([]model.Post, int64, error) // Get post list
+	GetPostsByIds(postIds []uint) ([]*model.Post, error)           // Get posts based on the post ID
+	CreatePost(post *model.Post) error                             // Create post
+	UpdatePostById(postId uint, post *model.Post) error            // Update post
+	BatchDeletePostByIds(postIds []uint) error                     // Delete posts
+}
+
+type PostRepository struct {
+}
+
+func NewPostRepository() IPostRepository {
+	return PostRepository{}
+}
+
+// Get post list
+func (p PostRepository) GetPosts(req *vo.PostListRequest) ([]model.Post, int64, error) {
+	var list []model.Post
+	db := common.DB.Model(&model.Post{}).Order("sort").Order("created_at DESC")
+
+	code := strings.TrimSpace(req.Code)
+	if code != "" {
+		db = db.Where("code LIKE ?", fmt.Sprintf("%%%s%%", code))
+	}
+	name := strings.TrimSpace(req.Name)
+	if name != "" {
+		db = db.Where("name LIKE ?", fmt.Sprintf("%%%s%%", name))
+	}
+	status := req.Status
+	if status != 0 {
+		db = db.Where("status = ?", status)
+	}
+	// Paging only when pageNum > 0 and pageSize > 0
+	// Total number of records
+	var total int64
+	err := db.Count(&total).Error
+	if err != nil {
+		return list, total, err
+	}
+	pageNum := int(req.PageNum)
+	pageSize := int(req.PageSize)
+	if pageNum > 0 && pageSize > 0 {
+		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&list).Error
+	} else {
+		err = db.Find(&list).Error
+	}
+	return list, total, err
+}
+
+// Get posts based on the post ID
+func (p PostRepository) GetPostsByIds(postIds []uint) ([]*model.Post, error) {
+	var list []*model.Post
+	err := common.DB.Where("id IN (?)", postIds).Find(&list).Error
+	return list, err
+}
+
+// Create post
+func (p PostRepository) CreatePost(post *model.Post) error {
+	err := common.DB.Create(post).Error
+	return err
+}
+
+// Update post
+func (p PostRepository) UpdatePostById(postId uint, post *model.Post) error {
+	err := common.DB.Model(&model.Post{}).Where("id = ?", postId).Updates(post).Error
+	return err
+}
+
+// Delete posts
+func (p PostRepository) BatchDeletePostByIds(postIds []uint) error {
+	var posts []*model.Post
+	err := common.DB.Where("id IN (?)", postIds).Find(&posts).Error
+	if err != nil {
+		return err
+	}
+	err = common.DB.Select("Users").Unscoped().Delete(&posts).Error
+	return err
+}
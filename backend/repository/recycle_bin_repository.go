@@ -0,0 +1,625 @@
+package repository
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/vo"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Join table rows that belong to an entity, they are detached when the entity is moved to the recycle bin
+type recycleJoinTable struct {
+	Name        string // Join table name
+	OwnerColumn string // Column referencing the recycled entity
+	OtherColumn string // Column referencing the other side of the relationship
+}
+
+// Unique column of an entity. Soft-deleted rows keep their unique indexes,
+// so the value is replaced with "~" and the id while the entity is in the recycle bin.
+type recycleUniqueColumn struct {
+	Name     string // Column name
+	Conflict string // Error when a live record took the value while the entity was in the recycle bin
+	Recycled string // Error when a record recycled before values were released still holds the value
+}
+
+// Entity types that can be put into the recycle bin
+var recycleEntities = map[string]struct {
+	Model         interface{}
+	JoinTables    []recycleJoinTable
+	UniqueColumns []recycleUniqueColumn
+}{
+	"user": {&model.User{}, []recycleJoinTable{
+		{"user_roles", "user_id", "role_id"},
+		{"user_departments", "user_id", "department_id"},
+		{"user_posts", "user_id", "post_id"},
+		{"department_leaders", "user_id", "department_id"},
+	}, []recycleUniqueColumn{
+		{"username", "Username %s already exists", "Username %s belongs to a user in the recycle bin, restore or purge it first"},
+		{"mobile", "Mobile %s already exists", "Mobile %s belongs to a user in the recycle bin, restore or purge it first"},
+		{"email", "Email %s already exists", "Email %s belongs to a user in the recycle bin, restore or purge it first"},
+	}},
+	"role": {&model.Role{}, []recycleJoinTable{
+		{"user_roles", "role_id", "user_id"},
+		{"role_menus", "role_id", "menu_id"},
+	}, []recycleUniqueColumn{
+		{"name", "Role name %s already exists", "Role name %s belongs to a role in the recycle bin, restore or purge it first"},
+		{"keyword", "Role keyword %s already exists", "Role keyword %s belongs to a role in the recycle bin, restore or purge it first"},
+	}},
+	"menu": {&model.Menu{}, []recycleJoinTable{
+		{"role_menus", "menu_id", "role_id"},
+	}, []recycleUniqueColumn{
+		{"name", "Menu name %s already exists", "Menu name %s belongs to a menu in the recycle bin, restore or purge it first"},
+	}},
+	"api":          {&model.Api{}, nil, nil},
+	"operationLog": {&model.OperationLog{}, nil, nil},
+}
+
+type IRecycleBinRepository interface {
+	GetRecycleBin(req *vo.RecycleBinListRequest) (interface{}, int64, error)        // Get soft-deleted records of an entity type
+	GetRecycleRecords(entityType string, ids []uint) ([]model.RecycleRecord, error) // Get the snapshots of soft-deleted records
+	GetDeletedRoles(ids []uint) ([]*model.Role, error)                              // Get soft-deleted roles
+	Restore(entityType string, ids []uint) error                                    // Restore soft-deleted records with their associations and casbin policies
+	Purge(entityType string, ids []uint) error                                      // Permanently delete soft-deleted records
+	PurgeExpired() error                                                            // Permanently delete records that stayed in the recycle bin longer than the retention period
+	RunPurgeSchedule()                                                              // Periodically purge expired records
+	WithContext(ctx context.Context) IRecycleBinRepository                          // Repository whose changes are recorded as made by the user of the request context
+}
+
+type RecycleBinRepository struct {
+	ctx context.Context // Context the database is used with
+}
+
+func NewRecycleBinRepository() IRecycleBinRepository {
+	return RecycleBinRepository{}
+}
+
+// Repository whose changes are recorded as made by the user of the request context
+func (r RecycleBinRepository) WithContext(ctx context.Context) IRecycleBinRepository {
+	r.ctx = ctx
+	return r
+}
+
+func (r RecycleBinRepository) db() *gorm.DB {
+	return common.DBWithContext(r.ctx)
+}
+
+// Soft delete entities inside tx, detaching their join table rows and recording them (and the removed casbin policies) for a later restore
+func recycle(tx *gorm.DB, entityType string, ids []uint, policies map[uint][][]string) error {
+	entity, ok := recycleEntities[entityType]
+	if !ok {
+		return fmt.Errorf("Unknown entity type: %s", entityType)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	associations := make(map[uint]map[string][]uint)
+	for _, jt := range entity.JoinTables {
+		var rows []struct {
+			Owner uint
+			Other uint
+		}
+		err := tx.Table(jt.Name).
+			Select(fmt.Sprintf("%s AS owner, %s AS other", jt.OwnerColumn, jt.OtherColumn)).
+			Where(jt.OwnerColumn+" IN (?)", ids).
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if associations[row.Owner] == nil {
+				associations[row.Owner] = make(map[string][]uint)
+			}
+			associations[row.Owner][jt.Name] = append(associations[row.Owner][jt.Name], row.Other)
+		}
+		err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s IN (?)", jt.Name, jt.OwnerColumn), ids).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	uniqueValues, err := getUniqueValues(tx, entity.Model, entity.UniqueColumns, ids)
+	if err != nil {
+		return err
+	}
+
+	records := make([]model.RecycleRecord, 0, len(ids))
+	for _, id := range ids {
+		record := model.RecycleRecord{EntityType: entityType, EntityId: id}
+		if len(associations[id]) > 0 {
+			b, _ := json.Marshal(associations[id])
+			record.Associations = string(b)
+		}
+		if len(policies[id]) > 0 {
+			b, _ := json.Marshal(policies[id])
+			record.Policies = string(b)
+		}
+		if len(uniqueValues[id]) > 0 {
+			b, _ := json.Marshal(uniqueValues[id])
+			record.UniqueValues = string(b)
+		}
+		records = append(records, record)
+	}
+	err = tx.Create(&records).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Where("id IN (?)", ids).Delete(entity.Model).Error
+	if err != nil || len(entity.UniqueColumns) == 0 {
+		return err
+	}
+	// Release the unique values after deleting, so that the change history keeps the original ones.
+	// A raw statement is not recorded as a change.
+	table, err := tableName(tx, entity.Model)
+	if err != nil {
+		return err
+	}
+	sets := make([]string, 0, len(entity.UniqueColumns))
+	for _, column := range entity.UniqueColumns {
+		sets = append(sets, fmt.Sprintf("%s = CONCAT('~', id)", column.Name))
+	}
+	return tx.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE id IN (?)", table, strings.Join(sets, ", ")), ids).Error
+}
+
+// Get the values of the unique columns of records by their ids, null values stay nil
+func getUniqueValues(db *gorm.DB, entityModel interface{}, columns []recycleUniqueColumn, ids []uint) (map[uint]map[string]*string, error) {
+	values := make(map[uint]map[string]*string)
+	if len(columns) == 0 {
+		return values, nil
+	}
+	names := []string{"id"}
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	rows, err := db.Unscoped().Model(entityModel).Select(names).Where("id IN (?)", ids).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uint
+		columnValues := make([]sql.NullString, len(columns))
+		dest := []interface{}{&id}
+		for i := range columnValues {
+			dest = append(dest, &columnValues[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		values[id] = make(map[string]*string)
+		for i, column := range columns {
+			if columnValues[i].Valid {
+				value := columnValues[i].String
+				values[id][column.Name] = &value
+			} else {
+				values[id][column.Name] = nil
+			}
+		}
+	}
+	return values, rows.Err()
+}
+
+// Original unique values of records in the recycle bin by their ids, records recycled before the values were released have none
+func getRecycledUniqueValues(db *gorm.DB, entityType string, ids []uint) (map[uint]map[string]*string, error) {
+	values := make(map[uint]map[string]*string)
+	var records []model.RecycleRecord
+	err := db.Where("entity_type = ? AND entity_id IN (?) AND unique_values <> ''", entityType, ids).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		var recordValues map[string]*string
+		if err := json.Unmarshal([]byte(record.UniqueValues), &recordValues); err != nil {
+			return nil, err
+		}
+		values[record.EntityId] = recordValues
+	}
+	return values, nil
+}
+
+// Report values of unique columns that are still held by records recycled before the values were released,
+// creating or updating a record with one of them fails with a duplicate key otherwise
+func checkRecycledDuplicates(db *gorm.DB, entityType string, values map[string][]string) error {
+	entity := recycleEntities[entityType]
+	for _, column := range entity.UniqueColumns {
+		if len(values[column.Name]) == 0 {
+			continue
+		}
+		var taken []string
+		err := db.Unscoped().Model(entity.Model).
+			Where("deleted_at IS NOT NULL").
+			Where(column.Name+" IN (?)", values[column.Name]).
+			Limit(1).Pluck(column.Name, &taken).Error
+		if err != nil {
+			return err
+		}
+		if len(taken) > 0 {
+			return fmt.Errorf(column.Recycled, taken[0])
+		}
+	}
+	return nil
+}
+
+func tableName(db *gorm.DB, entityModel interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(entityModel); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+// Get soft-deleted records of an entity type
+func (r RecycleBinRepository) GetRecycleBin(req *vo.RecycleBinListRequest) (interface{}, int64, error) {
+	entity, ok := recycleEntities[req.EntityType]
+	if !ok {
+		return nil, 0, fmt.Errorf("Unknown entity type: %s", req.EntityType)
+	}
+
+	db := r.db().Unscoped().Model(entity.Model).Where("deleted_at IS NOT NULL").Order("deleted_at DESC")
+	var total int64
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, total, err
+	}
+	pageNum := int(req.PageNum)
+	pageSize := int(req.PageSize)
+	if pageNum > 0 && pageSize > 0 {
+		db = db.Offset((pageNum - 1) * pageSize).Limit(pageSize)
+	}
+
+	var list interface{}
+	switch req.EntityType {
+	case "user":
+		var users []*model.User
+		err = db.Find(&users).Error
+		var values map[uint]map[string]*string
+		if err == nil {
+			ids := make([]uint, 0, len(users))
+			for _, user := range users {
+				ids = append(ids, user.ID)
+			}
+			values, err = getRecycledUniqueValues(r.db(), req.EntityType, ids)
+		}
+		for _, user := range users {
+			// Passwords never leave the server
+			user.Password = ""
+			// Show the values the user had before it was recycled
+			if v, ok := values[user.ID]; ok {
+				if v["username"] != nil {
+					user.Username = *v["username"]
+				}
+				if v["mobile"] != nil {
+					user.Mobile = *v["mobile"]
+				}
+				user.Email = v["email"]
+			}
+		}
+		list = users
+	case "role":
+		var roles []*model.Role
+		err = db.Find(&roles).Error
+		var values map[uint]map[string]*string
+		if err == nil {
+			ids := make([]uint, 0, len(roles))
+			for _, role := range roles {
+				ids = append(ids, role.ID)
+			}
+			values, err = getRecycledUniqueValues(r.db(), req.EntityType, ids)
+		}
+		for _, role := range roles {
+			if v, ok := values[role.ID]; ok {
+				if v["name"] != nil {
+					role.Name = *v["name"]
+				}
+				if v["keyword"] != nil {
+					role.Keyword = *v["keyword"]
+				}
+			}
+		}
+		list = roles
+	case "menu":
+		var menus []*model.Menu
+		err = db.Find(&menus).Error
+		list = menus
+	case "api":
+		var apis []*model.Api
+		err = db.Find(&apis).Error
+		list = apis
+	case "operationLog":
+		var logs []*model.OperationLog
+		err = db.Find(&logs).Error
+		list = logs
+	}
+	return list, total, err
+}
+
+// Get the snapshots of soft-deleted records
+func (r RecycleBinRepository) GetRecycleRecords(entityType string, ids []uint) ([]model.RecycleRecord, error) {
+	var records []model.RecycleRecord
+	err := r.db().Where("entity_type = ? AND entity_id IN (?)", entityType, ids).Find(&records).Error
+	return records, err
+}
+
+// Get soft-deleted roles
+func (r RecycleBinRepository) GetDeletedRoles(ids []uint) ([]*model.Role, error) {
+	var roles []*model.Role
+	err := r.db().Unscoped().Where("id IN (?) AND deleted_at IS NOT NULL", ids).Find(&roles).Error
+	return roles, err
+}
+
+// Restore soft-deleted records with their associations and casbin policies
+func (r RecycleBinRepository) Restore(entityType string, ids []uint) error {
+	entity, ok := recycleEntities[entityType]
+	if !ok {
+		return fmt.Errorf("Unknown entity type: %s", entityType)
+	}
+	joinTables := make(map[string]recycleJoinTable)
+	for _, jt := range entity.JoinTables {
+		joinTables[jt.Name] = jt
+	}
+
+	var count int64
+	err := r.db().Unscoped().Model(entity.Model).Where("id IN (?) AND deleted_at IS NOT NULL", ids).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return errors.New("Some records are not in the recycle bin")
+	}
+
+	// A restored menu needs its parent, which may still be in the recycle bin
+	if entityType == "menu" {
+		var missingCount int64
+		err = r.db().Unscoped().Model(&model.Menu{}).
+			Where("id IN (?) AND parent_id <> 0", ids).
+			Where("parent_id NOT IN (?)", ids).
+			Where("parent_id NOT IN (?)", r.db().Model(&model.Menu{}).Select("id")).
+			Count(&missingCount).Error
+		if err != nil {
+			return err
+		}
+		if missingCount > 0 {
+			return errors.New("Please restore the parent menus first")
+		}
+	}
+
+	// Released unique values may have been taken by other records in the meantime
+	uniqueValues, err := getRecycledUniqueValues(r.db(), entityType, ids)
+	if err != nil {
+		return err
+	}
+	for _, column := range entity.UniqueColumns {
+		values := make([]string, 0)
+		restored := make(map[string]bool)
+		for _, v := range uniqueValues {
+			if v[column.Name] == nil {
+				continue
+			}
+			value := *v[column.Name]
+			if restored[value] {
+				return fmt.Errorf(column.Conflict, value)
+			}
+			restored[value] = true
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		var taken []string
+		err = r.db().Model(entity.Model).Where(column.Name+" IN (?)", values).Limit(1).Pluck(column.Name, &taken).Error
+		if err != nil {
+			return err
+		}
+		if len(taken) > 0 {
+			return fmt.Errorf(column.Conflict, taken[0])
+		}
+	}
+
+	records, err := r.GetRecycleRecords(entityType, ids)
+	if err != nil {
+		return err
+	}
+	table, err := tableName(r.db(), entity.Model)
+	if err != nil {
+		return err
+	}
+
+	policies := make([][]string, 0)
+	err = r.db().Transaction(func(tx *gorm.DB) error {
+		for id, v := range uniqueValues {
+			sets := make([]string, 0, len(entity.UniqueColumns))
+			args := make([]interface{}, 0, len(entity.UniqueColumns)+1)
+			for _, column := range entity.UniqueColumns {
+				sets = append(sets, column.Name+" = ?")
+				args = append(args, v[column.Name])
+			}
+			err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", table, strings.Join(sets, ", ")), append(args, id)...).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Unscoped().Model(entity.Model).Where("id IN (?)", ids).Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if record.Associations != "" {
+				var associations map[string][]uint
+				if err := json.Unmarshal([]byte(record.Associations), &associations); err != nil {
+					return err
+				}
+				for table, otherIds := range associations {
+					jt, ok := joinTables[table]
+					if !ok {
+						continue
+					}
+					for _, otherId := range otherIds {
+						// The row may have been re-created in the meantime
+						err := tx.Exec(fmt.Sprintf("INSERT IGNORE INTO %s (%s, %s) VALUES (?, ?)", jt.Name, jt.OwnerColumn, jt.OtherColumn), record.EntityId, otherId).Error
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+			if record.Policies != "" {
+				var recordPolicies [][]string
+				if err := json.Unmarshal([]byte(record.Policies), &recordPolicies); err != nil {
+					return err
+				}
+				policies = append(policies, recordPolicies...)
+			}
+		}
+		return tx.Unscoped().Where("entity_type = ? AND entity_id IN (?)", entityType, ids).Delete(&model.RecycleRecord{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	r.recordRestoredPrivileges(entityType, ids, policies)
+
+	// Restore casbin policies, skipping the ones that already exist
+	newPolicies := make([][]string, 0)
+	for _, policy := range policies {
+		if !common.CasbinEnforcer.HasPolicy(policy) {
+			newPolicies = append(newPolicies, policy)
+		}
+	}
+	if len(newPolicies) > 0 {
+		isAdded, _ := common.CasbinEnforcer.AddPolicies(newPolicies)
+		if !isAdded {
+			return errors.New("The records were restored, but restoring their permission interfaces failed.")
+		}
+	}
+
+	// Restored users and roles change the cached user information
+	if entityType == "user" || entityType == "role" {
+		userInfoCache.Flush()
+	}
+	// Restored menus and roles change the accessible menus
+	if entityType == "menu" || entityType == "role" {
+		userMenuCache.Flush()
+	}
+	return nil
+}
+
+// Record the roles of restored users and the users, menus and permission interfaces of restored roles as privilege changes.
+// Failures are logged, the records are restored already.
+func (r RecycleBinRepository) recordRestoredPrivileges(entityType string, ids []uint, policies [][]string) {
+	switch entityType {
+	case "user":
+		var users []*model.User
+		if err := r.db().Where("id IN (?)", ids).Preload("Roles").Find(&users).Error; err != nil {
+			common.Log.Errorf("Failed to record the roles of restored users: %v", err)
+			return
+		}
+		for _, user := range users {
+			recordPrivilegeChange(r.ctx, "user:"+user.Username, common.ListChanges("roles", nil, roleKeywords(user.Roles)))
+		}
+	case "role":
+		var roles []*model.Role
+		if err := r.db().Where("id IN (?)", ids).Preload("Users").Preload("Menus").Find(&roles).Error; err != nil {
+			common.Log.Errorf("Failed to record the privileges of restored roles: %v", err)
+			return
+		}
+		for _, role := range roles {
+			usernames := make([]string, 0, len(role.Users))
+			for _, user := range role.Users {
+				usernames = append(usernames, user.Username)
+			}
+			menuIds := make([]string, 0, len(role.Menus))
+			for _, menu := range role.Menus {
+				menuIds = append(menuIds, strconv.Itoa(int(menu.ID)))
+			}
+			// Permission interfaces as "METHOD path", like the changes of role interfaces
+			apis := make([]string, 0)
+			for _, policy := range policies {
+				if len(policy) > 2 && policy[0] == role.Keyword {
+					apis = append(apis, policy[2]+" "+policy[1])
+				}
+			}
+			changes := common.ListChanges("users", nil, usernames)
+			changes = append(changes, common.ListChanges("menus", nil, menuIds)...)
+			changes = append(changes, common.ListChanges("apis", nil, apis)...)
+			recordPrivilegeChange(r.ctx, "role:"+role.Keyword, changes)
+		}
+	}
+}
+
+// Permanently delete soft-deleted records
+func (r RecycleBinRepository) Purge(entityType string, ids []uint) error {
+	entity, ok := recycleEntities[entityType]
+	if !ok {
+		return fmt.Errorf("Unknown entity type: %s", entityType)
+	}
+	return r.db().Transaction(func(tx *gorm.DB) error {
+		// Only records that are already in the recycle bin
+		err := tx.Unscoped().Where("id IN (?) AND deleted_at IS NOT NULL", ids).Delete(entity.Model).Error
+		if err != nil {
+			return err
+		}
+		// Invitations and attribute values are useless without their user
+		if entityType == "user" {
+			remaining := tx.Model(&model.User{}).Unscoped().Select("id")
+			err = tx.Unscoped().Where("user_id IN (?) AND user_id NOT IN (?)", ids, remaining).Delete(&model.UserInvitation{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Where("user_id IN (?) AND user_id NOT IN (?)", ids, remaining).Delete(&model.UserAttributeValue{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Where("entity_type = ? AND entity_id IN (?)", entityType, ids).Delete(&model.RecycleRecord{}).Error
+	})
+}
+
+// Permanently delete records that stayed in the recycle bin longer than the retention period
+func (r RecycleBinRepository) PurgeExpired() error {
+	retentionDays := config.Conf.RecycleBin.RetentionDays
+	if retentionDays <= 0 {
+		return nil
+	}
+	expiredAt := time.Now().AddDate(0, 0, -retentionDays)
+	for entityType, entity := range recycleEntities {
+		var ids []uint
+		err := r.db().Unscoped().Model(entity.Model).Where("deleted_at < ?", expiredAt).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if err := r.Purge(entityType, ids); err != nil {
+			return err
+		}
+		common.Log.Infof("Purged %d expired %s records from the recycle bin", len(ids), entityType)
+	}
+	return nil
+}
+
+// Periodically purge expired records
+func (r RecycleBinRepository) RunPurgeSchedule() {
+	interval := time.Duration(config.Conf.RecycleBin.PurgeInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.PurgeExpired(); err != nil {
+			common.Log.Errorf("Failed to purge the recycle bin: %v", err)
+		}
+		<-ticker.C
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"github.com/esyede/goadmin/backend/common"
 	"github.com/esyede/goadmin/backend/model"
 	"github.com/esyede/goadmin/backend/vo"
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+
+	"gorm.io/gorm"
 )
 
 type IRoleRepository interface {
@@ -19,19 +23,31 @@ type IRoleRepository interface {
 	GetRoleApisByRoleKeyword(roleKeyword string) ([]*model.Api, error)   // Get permission interface of the role based on the role keyword
 	UpdateRoleApis(roleKeyword string, reqRolePolicies [][]string) error // Update the permission interface of the role (delete them all first and then add them)
 	BatchDeleteRoleByIds(roleIds []uint) error                           // Delete role
+	WithContext(ctx context.Context) IRoleRepository                     // Repository whose changes are recorded as made by the user of the request context
 }
 
 type RoleRepository struct {
+	ctx context.Context // Context the database is used with
 }
 
 func NewRoleRepository() IRoleRepository {
 	return RoleRepository{}
 }
 
+// Repository whose changes are recorded as made by the user of the request context
+func (r RoleRepository) WithContext(ctx context.Context) IRoleRepository {
+	r.ctx = ctx
+	return r
+}
+
+func (r RoleRepository) db() *gorm.DB {
+	return common.DBWithContext(r.ctx)
+}
+
 // Get role list
 func (r RoleRepository) GetRoles(req *vo.RoleListRequest) ([]model.Role, int64, error) {
 	var list []model.Role
-	db := common.DB.Model(&model.Role{}).Order("created_at DESC")
+	db := r.db().Model(&model.Role{}).Order("created_at DESC")
 
 	name := strings.TrimSpace(req.Name)
 	if name != "" {
@@ -65,33 +81,73 @@ func (r RoleRepository) GetRoles(req *vo.RoleListRequest) ([]model.Role, int64,
 // Get role based on the role ID
 func (r RoleRepository) GetRolesByIds(roleIds []uint) ([]*model.Role, error) {
 	var list []*model.Role
-	err := common.DB.Where("id IN (?)", roleIds).Find(&list).Error
+	err := r.db().Where("id IN (?)", roleIds).Find(&list).Error
 	return list, err
 }
 
 // Creating a Role
 func (r RoleRepository) CreateRole(role *model.Role) error {
-	err := common.DB.Create(role).Error
+	if err := checkRecycledDuplicates(r.db(), "role", roleUniqueValues(role)); err != nil {
+		return err
+	}
+	err := r.db().Create(role).Error
 	return err
 }
 
+// Unique values of a role, checked against roles recycled before their values were released
+func roleUniqueValues(role *model.Role) map[string][]string {
+	values := make(map[string][]string)
+	if role.Name != "" {
+		values["name"] = []string{role.Name}
+	}
+	if role.Keyword != "" {
+		values["keyword"] = []string{role.Keyword}
+	}
+	return values
+}
+
 // Update role
 func (r RoleRepository) UpdateRoleById(roleId uint, role *model.Role) error {
-	err := common.DB.Model(&model.Role{}).Where("id = ?", roleId).Updates(role).Error
+	if err := checkRecycledDuplicates(r.db(), "role", roleUniqueValues(role)); err != nil {
+		return err
+	}
+	err := r.db().Model(&model.Role{}).Where("id = ?", roleId).Updates(role).Error
+	// Disabled roles grant no menus
+	userMenuCache.Flush()
 	return err
 }
 
 // Get role's permission menu
 func (r RoleRepository) GetRoleMenusById(roleId uint) ([]*model.Menu, error) {
 	var role model.Role
-	err := common.DB.Where("id = ?", roleId).Preload("Menus").First(&role).Error
+	err := r.db().Where("id = ?", roleId).Preload("Menus").First(&role).Error
 	return role.Menus, err
 }
 
 // Update the role's permissions menu
 func (r RoleRepository) UpdateRoleMenus(role *model.Role) error {
-	err := common.DB.Model(role).Association("Menus").Replace(role.Menus)
-	return err
+	var before []uint
+	err := r.db().Table("role_menus").Where("role_id = ?", role.ID).Pluck("menu_id", &before).Error
+	if err != nil {
+		return err
+	}
+	err = r.db().Model(role).Association("Menus").Replace(role.Menus)
+	userMenuCache.Flush()
+	if err != nil {
+		return err
+	}
+	beforeIds := make([]string, 0, len(before))
+	for _, id := range before {
+		beforeIds = append(beforeIds, strconv.Itoa(int(id)))
+	}
+	afterIds := make([]string, 0, len(role.Menus))
+	for _, menu := range role.Menus {
+		afterIds = append(afterIds, strconv.Itoa(int(menu.ID)))
+	}
+	changes := common.ListChanges("menus", beforeIds, afterIds)
+	common.RecordChange(r.db(), "role", role.ID, "update", changes)
+	recordPrivilegeChange(r.ctx, "role:"+role.Keyword, changes)
+	return nil
 }
 
 // Get permission interface of the role based on the role keyword
@@ -100,7 +156,7 @@ func (r RoleRepository) GetRoleApisByRoleKeyword(roleKeyword string) ([]*model.A
 
 	// Get all interfaces
 	var apis []*model.Api
-	err := common.DB.Find(&apis).Error
+	err := r.db().Find(&apis).Error
 	if err != nil {
 		return apis, errors.New("Failed to obtain role permission interface")
 	}
@@ -140,6 +196,7 @@ func (r RoleRepository) UpdateRoleApis(roleKeyword string, reqRolePolicies [][]s
 	if !isAdded {
 		return errors.New("Failed to update role's permission interface")
 	}
+	r.recordRoleApiChanges(roleKeyword, rmPolicies, reqRolePolicies)
 	err = common.CasbinEnforcer.LoadPolicy()
 	if err != nil {
 		return errors.New("The role's permission interface was updated successfully, but the role's permission interface policy failed to load.")
@@ -148,19 +205,48 @@ func (r RoleRepository) UpdateRoleApis(roleKeyword string, reqRolePolicies [][]s
 	}
 }
 
+// Record the permission interfaces of a role before and after an update, as "METHOD path"
+func (r RoleRepository) recordRoleApiChanges(roleKeyword string, before [][]string, after [][]string) {
+	var role model.Role
+	if err := r.db().Where("keyword = ?", roleKeyword).First(&role).Error; err != nil {
+		common.Log.Errorf("Failed to record permission interface changes of role %s: %v", roleKeyword, err)
+		return
+	}
+	apis := func(policies [][]string) []string {
+		list := make([]string, 0, len(policies))
+		for _, policy := range policies {
+			if len(policy) > 2 {
+				list = append(list, policy[2]+" "+policy[1])
+			}
+		}
+		return list
+	}
+	changes := common.ListChanges("apis", apis(before), apis(after))
+	common.RecordChange(r.db(), "role", role.ID, "update", changes)
+	recordPrivilegeChange(r.ctx, "role:"+role.Keyword, changes)
+}
+
 // Delete role
 func (r RoleRepository) BatchDeleteRoleByIds(roleIds []uint) error {
 	var roles []*model.Role
-	err := common.DB.Where("id IN (?)", roleIds).Find(&roles).Error
+	err := r.db().Where("id IN (?)", roleIds).Find(&roles).Error
 	if err != nil {
 		return err
 	}
-	err = common.DB.Select("Users", "Menus").Unscoped().Delete(&roles).Error
+	// The casbin policies of the roles are kept in the recycle bin for a restore
+	policies := make(map[uint][][]string)
+	for _, role := range roles {
+		policies[role.ID] = common.CasbinEnforcer.GetFilteredPolicy(0, role.Keyword)
+	}
+	// Move the roles to the recycle bin, their users and menus are kept for a restore
+	err = r.db().Transaction(func(tx *gorm.DB) error {
+		return recycle(tx, "role", roleIds, policies)
+	})
+	userMenuCache.Flush()
 	// Delete the casbin policy if the deletion is successful.
 	if err == nil {
 		for _, role := range roles {
-			roleKeyword := role.Keyword
-			rmPolicies := common.CasbinEnforcer.GetFilteredPolicy(0, roleKeyword)
+			rmPolicies := policies[role.ID]
 			if len(rmPolicies) > 0 {
 				isRemoved, _ := common.CasbinEnforcer.RemovePolicies(rmPolicies)
 				if !isRemoved {
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/config"
+	"github.com/esyede/goadmin/backend/dto"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/util"
+	"github.com/esyede/goadmin/backend/vo"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"gorm.io/gorm"
+)
+
+type ISecurityEventRepository interface {
+	GetSecurityEvents(req *vo.SecurityEventListRequest) ([]model.SecurityEvent, int64, error)     // Get security events, newest first
+	GetSecurityEventCounts(req *vo.SecurityEventListRequest) ([]dto.SecurityEventCountDto, error) // Count the filtered security events by type
+	RecordSecurityEvent(c *gin.Context, event *model.SecurityEvent)                               // Record a security event of a request
+	CheckLoginLockout(ip string, username string) error                                           // Refuse the logins of locked addresses and accounts
+	RecordLoginFailure(c *gin.Context, username string, reason string, counted bool)              // Record a failed login, counted ones lock the account and the address when there are too many
+	RecordLoginSuccess(c *gin.Context, username string)                                           // Record a login and forget the failed ones before it
+}
+
+type SecurityEventRepository struct {
+}
+
+func NewSecurityEventRepository() ISecurityEventRepository {
+	return SecurityEventRepository{}
+}
+
+var (
+	ErrAccountLocked = errors.New("Too many failed logins, the account is locked for a while")
+	ErrAddressLocked = errors.New("Too many failed logins from this address, its logins are refused for a while")
+	// Told to the client for unknown accounts, wrong passwords and lockouts alike
+	ErrLoginFailed = errors.New("Wrong username or password")
+)
+
+// Failed logins per username and address, and the locked accounts and addresses, kept in memory
+var loginFailureCache = cache.New(15*time.Minute, 30*time.Minute)
+
+// Get security events, newest first
+func (sr SecurityEventRepository) GetSecurityEvents(req *vo.SecurityEventListRequest) ([]model.SecurityEvent, int64, error) {
+	var list []model.SecurityEvent
+	db := securityEventListQuery(req)
+
+	// Paging
+	var total int64
+	err := db.Count(&total).Error
+	if err != nil {
+		return list, total, err
+	}
+	db = db.Order("id DESC")
+	pageNum := req.PageNum
+	pageSize := req.PageSize
+	if pageNum > 0 && pageSize > 0 {
+		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&list).Error
+	} else {
+		err = db.Find(&list).Error
+	}
+	return list, total, err
+}
+
+// Count the filtered security events by type
+func (sr SecurityEventRepository) GetSecurityEventCounts(req *vo.SecurityEventListRequest) ([]dto.SecurityEventCountDto, error) {
+	list := make([]dto.SecurityEventCountDto, 0)
+	err := securityEventListQuery(req).Select("type, COUNT(*) AS count").Group("type").Order("count DESC").Scan(&list).Error
+	return list, err
+}
+
+func securityEventListQuery(req *vo.SecurityEventListRequest) *gorm.DB {
+	db := common.DB.Model(&model.SecurityEvent{})
+	if req.Type != "" {
+		db = db.Where("type = ?", req.Type)
+	}
+	username := strings.TrimSpace(req.Username)
+	if username != "" {
+		db = db.Where("username LIKE ?", fmt.Sprintf("%%%s%%", username))
+	}
+	ip := strings.TrimSpace(req.Ip)
+	if ip != "" {
+		db = db.Where("ip LIKE ?", fmt.Sprintf("%%%s%%", ip))
+	}
+	if req.StartTimeFrom != "" {
+		from, _ := time.ParseInLocation(operationLogTimeLayout, req.StartTimeFrom, time.Local)
+		db = db.Where("created_at >= ?", from)
+	}
+	if req.StartTimeTo != "" {
+		to, _ := time.ParseInLocation(operationLogTimeLayout, req.StartTimeTo, time.Local)
+		db = db.Where("created_at <= ?", to)
+	}
+	return db
+}
+
+// Record a security event of a request
+func (sr SecurityEventRepository) RecordSecurityEvent(c *gin.Context, event *model.SecurityEvent) {
+	recordSecurityEvent(c, *event)
+}
+
+// Refuse the logins of locked addresses and accounts
+func (sr SecurityEventRepository) CheckLoginLockout(ip string, username string) error {
+	if _, locked := loginFailureCache.Get("locked-ip:" + ip); locked {
+		return ErrAddressLocked
+	}
+	if _, locked := loginFailureCache.Get("locked:" + username); locked {
+		return ErrAccountLocked
+	}
+	return nil
+}
+
+// Record a failed login. Counted failures lock the account when there are too many of them within the window,
+// and the address when it has too many of them, whatever accounts it tried.
+// Unknown accounts are counted too, so that they cannot be told apart from locked ones.
+func (sr SecurityEventRepository) RecordLoginFailure(c *gin.Context, username string, reason string, counted bool) {
+	recordSecurityEvent(c, model.SecurityEvent{Type: model.SecurityEventLoginFailure, Username: username, Reason: reason})
+
+	conf := config.Conf.Security
+	if !counted || conf == nil {
+		return
+	}
+	if failures, locked := countLoginFailure("failures:"+username, "locked:"+username, conf.MaxLoginFailures); locked {
+		recordLockout(c, username, ErrAccountLocked, failures)
+	}
+	if failures, locked := countLoginFailure("failures-ip:"+c.ClientIP(), "locked-ip:"+c.ClientIP(), conf.MaxIpLoginFailures); locked {
+		recordLockout(c, "", ErrAddressLocked, failures)
+	}
+}
+
+// Count a failed login under key and lock lockKey when there are max failures within the window, 0 never locks
+func countLoginFailure(key string, lockKey string, max int) (int, bool) {
+	conf := config.Conf.Security
+	if max <= 0 {
+		return 0, false
+	}
+	window := time.Duration(conf.LoginFailureWindow) * time.Minute
+	if window <= 0 {
+		window = 15 * time.Minute
+	}
+	failures := 1
+	if err := loginFailureCache.Add(key, failures, window); err != nil {
+		// Incrementing keeps the expiration of the first failure, so that the failures are counted within the window
+		failures, _ = loginFailureCache.IncrementInt(key, 1)
+	}
+	if failures < max {
+		return failures, false
+	}
+	loginFailureCache.Set(lockKey, true, lockoutDuration())
+	loginFailureCache.Delete(key)
+	return failures, true
+}
+
+func lockoutDuration() time.Duration {
+	duration := time.Duration(config.Conf.Security.LockoutDuration) * time.Minute
+	if duration <= 0 {
+		duration = 15 * time.Minute
+	}
+	return duration
+}
+
+func recordLockout(c *gin.Context, username string, reason error, failures int) {
+	detail, _ := util.MarshalJson(map[string]interface{}{
+		"failures": failures,
+		"until":    time.Now().Add(lockoutDuration()).Format("2006-01-02 15:04:05"),
+	})
+	recordSecurityEvent(c, model.SecurityEvent{Type: model.SecurityEventLockout, Username: username, Reason: reason.Error(), Detail: detail})
+}
+
+// Record a login and forget the failed ones before it
+func (sr SecurityEventRepository) RecordLoginSuccess(c *gin.Context, username string) {
+	loginFailureCache.Delete("failures:" + username)
+	recordSecurityEvent(c, model.SecurityEvent{Type: model.SecurityEventLoginSuccess, Username: username})
+}
+
+// Record a change of the roles of a user or the permissions of a role, nothing when nothing changed
+func recordPrivilegeChange(ctx context.Context, target string, changes []model.FieldChange) {
+	if len(changes) == 0 {
+		return
+	}
+	detail, _ := util.MarshalJson(changes)
+	recordSecurityEvent(ctx, model.SecurityEvent{Type: model.SecurityEventPrivilegeChange, Target: target, Detail: detail})
+}
+
+// Record the roles a user was created with, nothing for a user without roles
+func recordInitialRoles(ctx context.Context, user *model.User) {
+	recordPrivilegeChange(ctx, "user:"+user.Username, common.ListChanges("roles", nil, roleKeywords(user.Roles)))
+}
+
+// Fill in the address, path and users of the request the event happened in and write it.
+// An event that cannot be written is logged, it does not fail the request.
+func recordSecurityEvent(ctx context.Context, event model.SecurityEvent) {
+	if c, ok := ctx.(*gin.Context); ok {
+		event.Ip = c.ClientIP()
+		event.Method = c.Request.Method
+		event.Path = strings.TrimPrefix(c.FullPath(), "/"+config.Conf.System.UrlPathPrefix)
+		if user, ok := c.Value("user").(model.User); ok && event.Username == "" {
+			event.Username = user.Username
+		}
+		if actor, ok := c.Value("actor").(model.User); ok {
+			event.Impersonator = actor.Username
+		}
+	}
+	// Failed logins keep the account as it was entered
+	if runes := []rune(event.Username); len(runes) > 50 {
+		event.Username = string(runes[:50])
+	}
+	if runes := []rune(event.Reason); len(runes) > 255 {
+		event.Reason = string(runes[:255])
+	}
+	if err := common.DB.Create(&event).Error; err != nil {
+		common.Log.Errorf("Failed to record security event %s of %s: %v", event.Type, event.Username, err)
+	}
+}
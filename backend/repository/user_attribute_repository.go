@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"github.com/esyede/goadmin/backend/common"
+	"github.com/esyede/goadmin/backend/model"
+	"github.com/esyede/goadmin/backend/vo"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type IUserAttributeRepository interface {
+	GetUserAttributes(req *vo.UserAttributeListRequest) ([]model.UserAttribute, int64, error) // Get user attribute list
+	GetAllUserAttributes() ([]*model.UserAttribute, error)                                    // Get all user attributes in order
+	GetUserAttributesByIds(attributeIds []uint) ([]*model.UserAttribute, error)               // Get user attributes based on the attribute ID
+	CreateUserAttribute(attribute *model.UserAttribute) error                                 // Create user attribute
+	UpdateUserAttributeById(attributeId uint, attribute *model.UserAttribute) error           // Update user attribute
+	BatchDeleteUserAttributeByIds(attributeIds []uint) error                                  // Delete user attributes together with their values
+}
+
+type UserAttributeRepository struct {
+}
+
+func NewUserAttributeRepository() IUserAttributeRepository {
+	return UserAttributeRepository{}
+}
+
+// Get user attribute list
+func (a UserAttributeRepository) GetUserAttributes(req *vo.UserAttributeListRequest) ([]model.UserAttribute, int64, error) {
+	var list []model.UserAttribute
+	db := common.DB.Model(&model.UserAttribute{}).Order("sort").Order("created_at DESC")
+
+	key := strings.TrimSpace(req.Key)
+	if key != "" {
+		db = db.Where("`key` LIKE ?", fmt.Sprintf("%%%s%%", key))
+	}
+	name := strings.TrimSpace(req.Name)
+	if name != "" {
+		db = db.Where("name LIKE ?", fmt.Sprintf("%%%s%%", name))
+	}
+	status := req.Status
+	if status != 0 {
+		db = db.Where("status = ?", status)
+	}
+	// Paging only when pageNum > 0 and pageSize > 0
+	// Total number of records
+	var total int64
+	err := db.Count(&total).Error
+	if err != nil {
+		return list, total, err
+	}
+	pageNum := int(req.PageNum)
+	pageSize := int(req.PageSize)
+	if pageNum > 0 && pageSize > 0 {
+		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&list).Error
+	} else {
+		err = db.Find(&list).Error
+	}
+	return list, total, err
+}
+
+// Get all user attributes in order
+func (a UserAttributeRepository) GetAllUserAttributes() ([]*model.UserAttribute, error) {
+	var list []*model.UserAttribute
+	err := common.DB.Order("sort").Order("id").Find(&list).Error
+	return list, err
+}
+
+// Get user attributes based on the attribute ID
+func (a UserAttributeRepository) GetUserAttributesByIds(attributeIds []uint) ([]*model.UserAttribute, error) {
+	var list []*model.UserAttribute
+	err := common.DB.Where("id IN (?)", attributeIds).Find(&list).Error
+	return list, err
+}
+
+// Create user attribute
+func (a UserAttributeRepository) CreateUserAttribute(attribute *model.UserAttribute) error {
+	err := common.DB.Create(attribute).Error
+	return err
+}
+
+// Update user attribute
+func (a UserAttributeRepository) UpdateUserAttributeById(attributeId uint, attribute *model.UserAttribute) error {
+	// Select the columns explicitly, Updates would skip "required: false" and empty patterns
+	err := common.DB.Model(&model.UserAttribute{}).Where("id = ?", attributeId).
+		Select("key", "name", "type", "required", "pattern", "options", "sort", "status", "creator").
+		Updates(attribute).Error
+	// Cached users carry the attribute definitions with their values
+	if err == nil {
+		userInfoCache.Flush()
+	}
+	return err
+}
+
+// Delete user attributes together with their values
+func (a UserAttributeRepository) BatchDeleteUserAttributeByIds(attributeIds []uint) error {
+	err := common.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("attribute_id IN (?)", attributeIds).Delete(&model.UserAttributeValue{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id IN (?)", attributeIds).Unscoped().Delete(&model.UserAttribute{}).Error
+	})
+	if err == nil {
+		userInfoCache.Flush()
+	}
+	return err
+}
@@ -5,25 +5,38 @@ import (
 	"github.com/esyede/goadmin/backend/model"
 	"github.com/esyede/goadmin/backend/util"
 	"github.com/esyede/goadmin/backend/vo"
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/patrickmn/go-cache"
 	"github.com/thoas/go-funk"
+	"gorm.io/gorm"
 )
 
 type IUserRepository interface {
 	Login(user *model.User) (*model.User, error)       // Log in
 	ChangePwd(username string, newPasswd string) error // Update password
-
-	CreateUser(user *model.User) error                              // Create user
-	GetUserById(id uint) (model.User, error)                        // Get a single user
-	GetUsers(req *vo.UserListRequest) ([]*model.User, int64, error) // Get user list
-	UpdateUser(user *model.User) error                              // update user
-	BatchDeleteUserByIds(ids []uint) error                          // batch deletion
+	UpdateProfile(user *model.User) error              // Update the user's own profile
+	UpdateAvatar(user *model.User) error               // Update the user's avatar
+
+	CreateUser(user *model.User) error                                                                               // Create user
+	GetUserById(id uint) (model.User, error)                                                                         // Get a single user
+	GetUsersByIds(ids []uint) ([]*model.User, error)                                                                 // Get users based on the user ID
+	GetUsersWithRolesByIds(ids []uint) ([]*model.User, error)                                                        // Get users with their roles based on the user ID
+	GetUsers(req *vo.UserListRequest) ([]*model.User, int64, error)                                                  // Get user list
+	ExportUsers(req *vo.UserListRequest, fn func(users []*model.User) error) error                                   // Walk the filtered user list in batches
+	GetUsersByUsernamesMobilesOrEmails(usernames []string, mobiles []string, emails []string) ([]*model.User, error) // Get users matching any of the usernames, mobiles or emails
+	BatchCreateUsers(users []*model.User) error                                                                      // Create users in one transaction
+	UpdateUser(user *model.User) error                                                                               // update user
+	BatchDeleteUserByIds(ids []uint) error                                                                           // batch deletion
+	BatchUpdateUserStatus(users []*model.User, status uint) error                                                    // Change the status of users in one transaction
+	BatchUpdateUserRoles(users []*model.User) error                                                                  // Replace the roles of users in one transaction
+	BatchResetPwd(users []*model.User) error                                                                         // Set passwords that have to be changed at the next login in one transaction
 
 	GetCurrentUser(c *gin.Context) (model.User, error)                  // Get the current logged in user information
 	GetCurrentUserMinRoleSort(c *gin.Context) (uint, model.User, error) // Get the minimum value of the current user role sorting (the highest level role) and the current user information
@@ -32,33 +45,68 @@ type IUserRepository interface {
 	SetUserInfoCache(username string, user model.User) // Set user information cache
 	UpdateUserInfoCacheByRoleId(roleId uint) error     // Update the user information cache of the role based on the role ID
 	ClearUserInfoCache()                               // Clear all user information cache
+	WithContext(ctx context.Context) IUserRepository   // Repository whose changes are recorded as made by the user of the request context
 }
 
 type UserRepository struct {
+	ctx context.Context // Context the database is used with
 }
 
 // Cache current user information to avoid frequent database acquisitions
 var userInfoCache = cache.New(24*time.Hour, 48*time.Hour)
 
+// Login errors that are told to the client as ErrLoginFailed, so that it cannot find out which accounts exist
+var (
+	ErrUserNotFound  = errors.New("User does not exist")
+	ErrWrongPassword = errors.New("Wrong password")
+)
+
 // UserRepository constructor
 func NewUserRepository() IUserRepository {
 	return UserRepository{}
 }
 
+// Repository whose changes are recorded as made by the user of the request context
+func (ur UserRepository) WithContext(ctx context.Context) IUserRepository {
+	ur.ctx = ctx
+	return ur
+}
+
+func (ur UserRepository) db() *gorm.DB {
+	return common.DBWithContext(ur.ctx)
+}
+
 // Log in
 func (ur UserRepository) Login(user *model.User) (*model.User, error) {
-	// Get the user based on the user name (normal status: user status is normal)
+	// Get the user based on the user name, email or mobile (normal status: user status is normal).
+	// The account may be the username of one user and the email or mobile of another,
+	// so they are tried one after the other and the username wins.
+	account := strings.TrimSpace(user.Username)
+	lookups := []struct {
+		query string
+		arg   interface{}
+	}{
+		{"username = ?", account},
+		{"email = ?", strings.ToLower(account)},
+		{"mobile IN (?)", []string{account, common.NormalizeMobile(account)}},
+	}
 	var firstUser model.User
-	err := common.DB.
-		Where("username = ?", user.Username).
-		Preload("Roles").
-		First(&firstUser).Error
+	err := gorm.ErrRecordNotFound
+	for _, lookup := range lookups {
+		err = ur.db().Where(lookup.query, lookup.arg).Preload("Roles").First(&firstUser).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+	}
 	if err != nil {
-		return nil, errors.New("User does not exist")
+		return nil, ErrUserNotFound
 	}
 
 	// Determine the user's status
 	userStatus := firstUser.Status
+	if userStatus == 3 {
+		return nil, errors.New("User has not accepted the invitation yet")
+	}
 	if userStatus != 1 {
 		return nil, errors.New("User is banned")
 	}
@@ -81,7 +129,7 @@ func (ur UserRepository) Login(user *model.User) (*model.User, error) {
 	// Verify password
 	err = util.ComparePasswd(firstUser.Password, user.Password)
 	if err != nil {
-		return &firstUser, errors.New("Wrong password")
+		return &firstUser, ErrWrongPassword
 	}
 	return &firstUser, nil
 }
@@ -140,14 +188,65 @@ func (ur UserRepository) GetCurrentUserMinRoleSort(c *gin.Context) (uint, model.
 func (ur UserRepository) GetUserById(id uint) (model.User, error) {
 	fmt.Println("GetUserById---")
 	var user model.User
-	err := common.DB.Where("id = ?", id).Preload("Roles").First(&user).Error
+	err := ur.db().Where("id = ?", id).Preload("Roles").Preload("Departments").Preload("Posts").Preload("AttributeValues.Attribute").First(&user).Error
 	return user, err
 }
 
+// Get users based on the user ID
+func (ur UserRepository) GetUsersByIds(ids []uint) ([]*model.User, error) {
+	var list []*model.User
+	err := ur.db().Where("id IN (?)", ids).Find(&list).Error
+	return list, err
+}
+
+// Get users with their roles based on the user ID
+func (ur UserRepository) GetUsersWithRolesByIds(ids []uint) ([]*model.User, error) {
+	var list []*model.User
+	err := ur.db().Where("id IN (?)", ids).Preload("Roles").Find(&list).Error
+	return list, err
+}
+
 // Get user list
 func (ur UserRepository) GetUsers(req *vo.UserListRequest) ([]*model.User, int64, error) {
 	var list []*model.User
-	db := common.DB.Model(&model.User{}).Order("created_at DESC")
+	db, err := ur.userListQuery(req)
+	if err != nil {
+		return list, 0, err
+	}
+	// Paging only when pageNum > 0 and pageSize > 0
+	// Total number of records
+	var total int64
+	err = db.Count(&total).Error
+	if err != nil {
+		return list, total, err
+	}
+	db = db.Order("created_at DESC")
+	pageNum := int(req.PageNum)
+	pageSize := int(req.PageSize)
+	if pageNum > 0 && pageSize > 0 {
+		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Preload("Roles").Preload("Departments").Preload("Posts").Preload("AttributeValues.Attribute").Find(&list).Error
+	} else {
+		err = db.Preload("Roles").Preload("Departments").Preload("Posts").Preload("AttributeValues.Attribute").Find(&list).Error
+	}
+	return list, total, err
+}
+
+// Walk the filtered user list in batches, so that large exports are not loaded into memory at once
+func (ur UserRepository) ExportUsers(req *vo.UserListRequest, fn func(users []*model.User) error) error {
+	db, err := ur.userListQuery(req)
+	if err != nil {
+		return err
+	}
+	var list []*model.User
+	// Batches are ordered and continued by id, any other order would make them skip and repeat users
+	return db.Preload("Roles").Preload("AttributeValues.Attribute").FindInBatches(&list, 500, func(tx *gorm.DB, batch int) error {
+		return fn(list)
+	}).Error
+}
+
+// Build the user list query from the filter conditions
+func (ur UserRepository) userListQuery(req *vo.UserListRequest) (*gorm.DB, error) {
+	db := ur.db().Model(&model.User{})
 
 	username := strings.TrimSpace(req.Username)
 	if username != "" {
@@ -161,30 +260,92 @@ func (ur UserRepository) GetUsers(req *vo.UserListRequest) ([]*model.User, int64
 	if mobile != "" {
 		db = db.Where("mobile LIKE ?", fmt.Sprintf("%%%s%%", mobile))
 	}
+	email := strings.TrimSpace(req.Email)
+	if email != "" {
+		db = db.Where("email LIKE ?", fmt.Sprintf("%%%s%%", strings.ToLower(email)))
+	}
 	status := req.Status
 	if status != 0 {
 		db = db.Where("status = ?", status)
 	}
-	// Paging only when pageNum > 0 and pageSize > 0
-	// Total number of records
-	var total int64
-	err := db.Count(&total).Error
-	if err != nil {
-		return list, total, err
+	if req.DepartmentId != 0 {
+		departmentIds := []uint{req.DepartmentId}
+		if req.WithSubDepartments {
+			dr := NewDepartmentRepository()
+			ids, err := dr.GetDepartmentChildIds(req.DepartmentId)
+			if err != nil {
+				return nil, err
+			}
+			departmentIds = ids
+		}
+		db = db.Where("id IN (?)", ur.db().Table("user_departments").Select("user_id").Where("department_id IN (?)", departmentIds))
 	}
-	pageNum := int(req.PageNum)
-	pageSize := int(req.PageSize)
-	if pageNum > 0 && pageSize > 0 {
-		err = db.Offset((pageNum - 1) * pageSize).Limit(pageSize).Preload("Roles").Find(&list).Error
-	} else {
-		err = db.Preload("Roles").Find(&list).Error
+	if req.PostId != 0 {
+		db = db.Where("id IN (?)", ur.db().Table("user_posts").Select("user_id").Where("post_id = ?", req.PostId))
 	}
-	return list, total, err
+	// String attributes are matched partially, the other types exactly
+	for key, value := range req.Attributes {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		db = db.Where("id IN (?)", ur.db().Table("user_attribute_values AS v").
+			Select("v.user_id").
+			Joins("JOIN user_attributes AS a ON a.id = v.attribute_id AND a.deleted_at IS NULL").
+			Where("a.`key` = ?", key).
+			Where("(a.type = 'string' AND v.value LIKE ?) OR (a.type <> 'string' AND v.value = ?)", fmt.Sprintf("%%%s%%", value), value))
+	}
+	return db, nil
+}
+
+// Get users matching any of the usernames, mobiles or emails
+func (ur UserRepository) GetUsersByUsernamesMobilesOrEmails(usernames []string, mobiles []string, emails []string) ([]*model.User, error) {
+	var list []*model.User
+	if len(usernames) == 0 && len(mobiles) == 0 && len(emails) == 0 {
+		return list, nil
+	}
+	// IN () with an empty list is invalid SQL, use a value that never matches instead
+	if len(usernames) == 0 {
+		usernames = []string{""}
+	}
+	if len(mobiles) == 0 {
+		mobiles = []string{""}
+	}
+	if len(emails) == 0 {
+		emails = []string{""}
+	}
+	err := ur.db().Where("username IN (?) OR mobile IN (?) OR email IN (?)", usernames, mobiles, emails).Find(&list).Error
+	return list, err
+}
+
+// Create users in one transaction, nothing is written if any of them fails
+func (ur UserRepository) BatchCreateUsers(users []*model.User) error {
+	if err := checkRecycledDuplicates(ur.db(), "user", userUniqueValues(users...)); err != nil {
+		return err
+	}
+	err := ur.db().Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			if err := tx.Create(user).Error; err != nil {
+				return fmt.Errorf("Failed to create user %s: %v", user.Username, err)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, user := range users {
+			recordInitialRoles(ur.ctx, user)
+		}
+	}
+	return err
 }
 
 // Update password
 func (ur UserRepository) ChangePwd(username string, hashNewPasswd string) error {
-	err := common.DB.Model(&model.User{}).Where("username = ?", username).Update("password", hashNewPasswd).Error
+	// Changing the password also completes a forced reset
+	err := ur.db().Model(&model.User{}).Where("username = ?", username).Updates(map[string]interface{}{
+		"password":        hashNewPasswd,
+		"must_change_pwd": false,
+	}).Error
 	// If the password update is successful, update the current user information cache
 	// Get the cache first
 	cacheUser, found := userInfoCache.Get(username)
@@ -192,11 +353,12 @@ func (ur UserRepository) ChangePwd(username string, hashNewPasswd string) error
 		if found {
 			user := cacheUser.(model.User)
 			user.Password = hashNewPasswd
+			user.MustChangePwd = false
 			userInfoCache.Set(username, user, cache.DefaultExpiration)
 		} else {
 			// Get user information cache without cache
 			var user model.User
-			common.DB.Where("username = ?", username).First(&user)
+			ur.db().Where("username = ?", username).First(&user)
 			userInfoCache.Set(username, user, cache.DefaultExpiration)
 		}
 	}
@@ -204,21 +366,105 @@ func (ur UserRepository) ChangePwd(username string, hashNewPasswd string) error
 	return err
 }
 
+// Update the user's own profile, only the fields users may change themselves are written
+func (ur UserRepository) UpdateProfile(user *model.User) error {
+	err := ur.db().Model(&model.User{}).Where("id = ?", user.ID).
+		Select("mobile", "email", "email_verified_at", "nickname", "introduction", "locale").
+		Updates(user).Error
+	// Let the next request re-cache the latest user information
+	if err == nil {
+		userInfoCache.Delete(user.Username)
+	}
+	return err
+}
+
+// Update the user's avatar
+func (ur UserRepository) UpdateAvatar(user *model.User) error {
+	err := ur.db().Model(&model.User{}).Where("id = ?", user.ID).Update("avatar", user.Avatar).Error
+	if err == nil {
+		userInfoCache.Delete(user.Username)
+	}
+	return err
+}
+
 // Create user
 func (ur UserRepository) CreateUser(user *model.User) error {
-	err := common.DB.Create(user).Error
+	if err := checkRecycledDuplicates(ur.db(), "user", userUniqueValues(user)); err != nil {
+		return err
+	}
+	err := ur.db().Create(user).Error
+	if err == nil {
+		recordInitialRoles(ur.ctx, user)
+	}
 	return err
 }
 
+// Unique values of users, checked against users recycled before their values were released
+func userUniqueValues(users ...*model.User) map[string][]string {
+	values := make(map[string][]string)
+	for _, user := range users {
+		if user.Username != "" {
+			values["username"] = append(values["username"], user.Username)
+		}
+		if user.Mobile != "" {
+			values["mobile"] = append(values["mobile"], user.Mobile)
+		}
+		if user.Email != nil {
+			values["email"] = append(values["email"], *user.Email)
+		}
+	}
+	return values
+}
+
 // Update user
 func (ur UserRepository) UpdateUser(user *model.User) error {
-	err := common.DB.Model(user).Updates(user).Error
+	if err := checkRecycledDuplicates(ur.db(), "user", userUniqueValues(user)); err != nil {
+		return err
+	}
+	// Attribute values are replaced below, upserting them here would keep the old values
+	err := ur.db().Model(user).Omit("AttributeValues").Updates(user).Error
+	if err != nil {
+		return err
+	}
+	// Updates skips nil fields, the email may be removed or become unverified
+	err = ur.db().Model(user).Select("email", "email_verified_at").Updates(user).Error
+	if err != nil {
+		return err
+	}
+	beforeRoles, err := userRoleKeywords(ur.db(), user.ID)
+	if err != nil {
+		return err
+	}
+	err = ur.db().Model(user).Association("Roles").Replace(user.Roles)
+	if err != nil {
+		return err
+	}
+	// Replacing an association is not recorded by the change history callbacks
+	changes := common.ListChanges("roles", beforeRoles, roleKeywords(user.Roles))
+	common.RecordChange(ur.db(), "user", user.ID, "update", changes)
+	recordPrivilegeChange(ur.ctx, "user:"+user.Username, changes)
+	err = ur.db().Model(user).Association("Departments").Replace(user.Departments)
 	if err != nil {
 		return err
 	}
-	err = common.DB.Model(user).Association("Roles").Replace(user.Roles)
+	err = ur.db().Model(user).Association("Posts").Replace(user.Posts)
+	if err != nil {
+		return err
+	}
+	err = ur.db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&model.UserAttributeValue{}).Error; err != nil {
+			return err
+		}
+		if len(user.AttributeValues) == 0 {
+			return nil
+		}
+		for _, value := range user.AttributeValues {
+			value.UserId = user.ID
+		}
+		return tx.Omit("Attribute").Create(&user.AttributeValues).Error
+	})
 
-	// err := common.DB.Session(&gorm.Session{FullSaveAssociations: true}).Updates(&user).Error
+	// err := ur.db().Session(&gorm.Session{FullSaveAssociations: true}).Updates(&user).Error
 
 	// If the update is successful, update the user information cache
 	if err == nil {
@@ -240,7 +486,10 @@ func (ur UserRepository) BatchDeleteUserByIds(ids []uint) error {
 		users = append(users, user)
 	}
 
-	err := common.DB.Select("Roles").Unscoped().Delete(&users).Error
+	// Move the users to the recycle bin, their roles, departments and posts are kept for a restore
+	err := ur.db().Transaction(func(tx *gorm.DB) error {
+		return recycle(tx, "user", ids, nil)
+	})
 	// If the user is successfully deleted, the user information cache will be deleted.
 	if err == nil {
 		for _, user := range users {
@@ -250,11 +499,96 @@ func (ur UserRepository) BatchDeleteUserByIds(ids []uint) error {
 	return err
 }
 
+// Change the status of users in one transaction
+func (ur UserRepository) BatchUpdateUserStatus(users []*model.User, status uint) error {
+	err := ur.db().Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			if err := tx.Model(&model.User{}).Where("id = ?", user.ID).Update("status", status).Error; err != nil {
+				return fmt.Errorf("Failed to update user %s: %v", user.Username, err)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, user := range users {
+			userInfoCache.Delete(user.Username)
+		}
+	}
+	return err
+}
+
+// Replace the roles of users in one transaction
+func (ur UserRepository) BatchUpdateUserRoles(users []*model.User) error {
+	beforeRoles := make([][]string, len(users))
+	err := ur.db().Transaction(func(tx *gorm.DB) error {
+		for i, user := range users {
+			keywords, err := userRoleKeywords(tx, user.ID)
+			if err != nil {
+				return fmt.Errorf("Failed to update user %s: %v", user.Username, err)
+			}
+			beforeRoles[i] = keywords
+			if err := tx.Model(user).Association("Roles").Replace(user.Roles); err != nil {
+				return fmt.Errorf("Failed to update user %s: %v", user.Username, err)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for i, user := range users {
+			userInfoCache.Delete(user.Username)
+			changes := common.ListChanges("roles", beforeRoles[i], roleKeywords(user.Roles))
+			common.RecordChange(ur.db(), "user", user.ID, "update", changes)
+			recordPrivilegeChange(ur.ctx, "user:"+user.Username, changes)
+		}
+	}
+	return err
+}
+
+// Keywords of the roles a user has in the database
+func userRoleKeywords(db *gorm.DB, userId uint) ([]string, error) {
+	var keywords []string
+	err := db.Model(&model.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userId).
+		Pluck("roles.keyword", &keywords).Error
+	return keywords, err
+}
+
+func roleKeywords(roles []*model.Role) []string {
+	keywords := make([]string, 0, len(roles))
+	for _, role := range roles {
+		keywords = append(keywords, role.Keyword)
+	}
+	return keywords
+}
+
+// Set passwords that have to be changed at the next login in one transaction
+func (ur UserRepository) BatchResetPwd(users []*model.User) error {
+	err := ur.db().Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			err := tx.Model(&model.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+				"password":        user.Password,
+				"must_change_pwd": true,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("Failed to update user %s: %v", user.Username, err)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, user := range users {
+			userInfoCache.Delete(user.Username)
+		}
+	}
+	return err
+}
+
 // Get the minimum value of user role sorting based on user ID
 func (ur UserRepository) GetUserMinRoleSortsByIds(ids []uint) ([]int, error) {
 	// Get user information based on user ID
 	var userList []model.User
-	err := common.DB.Where("id IN (?)", ids).Preload("Roles").Find(&userList).Error
+	err := ur.db().Where("id IN (?)", ids).Preload("Roles").Find(&userList).Error
 	if err != nil {
 		return []int{}, err
 	}
@@ -268,6 +602,11 @@ func (ur UserRepository) GetUserMinRoleSortsByIds(ids []uint) ([]int, error) {
 		for _, role := range roles {
 			roleSortList = append(roleSortList, int(role.Sort))
 		}
+		// Users left without roles (e.g. their roles were deleted) have the lowest level
+		if len(roleSortList) == 0 {
+			roleMinSortList = append(roleMinSortList, math.MaxInt32)
+			continue
+		}
 		roleMinSort := funk.MinInt(roleSortList).(int)
 		roleMinSortList = append(roleMinSortList, roleMinSort)
 	}
@@ -283,7 +622,7 @@ func (ur UserRepository) SetUserInfoCache(username string, user model.User) {
 func (ur UserRepository) UpdateUserInfoCacheByRoleId(roleId uint) error {
 
 	var role model.Role
-	err := common.DB.Where("id = ?", roleId).Preload("Users").First(&role).Error
+	err := ur.db().Where("id = ?", roleId).Preload("Users").First(&role).Error
 	if err != nil {
 		return errors.New("Failed to get role information based on role ID")
 	}
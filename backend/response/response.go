@@ -1,13 +1,15 @@
 package response
 
 import (
+	"github.com/esyede/goadmin/backend/common"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Messages are translated into the locale of the request
 func Response(c *gin.Context, httpStatus int, code int, data gin.H, message string) {
-	c.JSON(httpStatus, gin.H{"code": code, "data": data, "message": message})
+	c.JSON(httpStatus, gin.H{"code": code, "data": data, "message": common.T(common.Locale(c), message)})
 }
 
 func Success(c *gin.Context, data gin.H, message string) {
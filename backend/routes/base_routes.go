@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"github.com/esyede/goadmin/backend/controller"
+
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 )
@@ -13,6 +15,11 @@ func InitBaseRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gi
 		router.POST("/login", authMiddleware.LoginHandler)
 		router.POST("/logout", authMiddleware.LogoutHandler)
 		router.POST("/refreshToken", authMiddleware.RefreshHandler)
+
+		// Accept user invitations (no authentication required, the token authenticates the invitee)
+		invitationController := controller.NewInvitationController()
+		router.GET("/invitation/check", invitationController.CheckInvitation)
+		router.POST("/invitation/accept", invitationController.AcceptInvitation)
 	}
 
 	return r
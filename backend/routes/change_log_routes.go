@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/esyede/goadmin/backend/controller"
+	"github.com/esyede/goadmin/backend/middleware"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func InitChangeLogRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gin.IRoutes {
+	changeLogController := controller.NewChangeLogController()
+	router := r.Group("/change")
+	// Enable jwt auth middleware
+	router.Use(authMiddleware.MiddlewareFunc())
+	// Enable casbin auth middleware
+	router.Use(middleware.CasbinMiddleware())
+	{
+		router.GET("/history/:entityType/:entityId", changeLogController.GetChangeHistory)
+	}
+
+	return r
+}
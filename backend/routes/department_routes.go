@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/esyede/goadmin/backend/controller"
+	"github.com/esyede/goadmin/backend/middleware"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func InitDepartmentRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gin.IRoutes {
+	departmentController := controller.NewDepartmentController()
+	router := r.Group("/department")
+	// Enable jwt auth middleware
+	router.Use(authMiddleware.MiddlewareFunc())
+	// Enable casbin auth middleware
+	router.Use(middleware.CasbinMiddleware())
+	{
+		router.GET("/tree", departmentController.GetDepartmentTree)
+		router.GET("/list", departmentController.GetDepartments)
+		router.POST("/create", departmentController.CreateDepartment)
+		router.PATCH("/update/:departmentId", departmentController.UpdateDepartmentById)
+		router.DELETE("/delete/batch", departmentController.BatchDeleteDepartmentByIds)
+		router.GET("/users/get/:departmentId", departmentController.GetDepartmentUsersById)
+		router.PATCH("/users/update/:departmentId", departmentController.UpdateDepartmentUsersById)
+	}
+
+	return r
+}
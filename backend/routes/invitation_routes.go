@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/esyede/goadmin/backend/controller"
+	"github.com/esyede/goadmin/backend/middleware"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func InitInvitationRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gin.IRoutes {
+	invitationController := controller.NewInvitationController()
+	router := r.Group("/invitation")
+	// Enable jwt auth middleware
+	router.Use(authMiddleware.MiddlewareFunc())
+	// Enable casbin auth middleware
+	router.Use(middleware.CasbinMiddleware())
+	{
+		router.POST("/create", invitationController.InviteUser)
+		router.GET("/list", invitationController.GetInvitations)
+		router.PATCH("/resend/:invitationId", invitationController.ResendInvitation)
+		router.DELETE("/revoke/:invitationId", invitationController.RevokeInvitation)
+	}
+
+	return r
+}
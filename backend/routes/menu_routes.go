@@ -21,6 +21,10 @@ func InitMenuRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gi
 		router.POST("/create", menuController.CreateMenu)
 		router.PATCH("/update/:menuId", menuController.UpdateMenuById)
 		router.DELETE("/delete/batch", menuController.BatchDeleteMenuByIds)
+		router.PATCH("/move", menuController.MoveMenus)
+		router.GET("/export", menuController.ExportMenus)
+		router.POST("/import/diff", menuController.DiffMenus)
+		router.POST("/import", menuController.ImportMenus)
 		router.GET("/access/list/:userId", menuController.GetUserMenusByUserId)
 		router.GET("/access/tree/:userId", menuController.GetUserMenuTreeByUserId)
 	}
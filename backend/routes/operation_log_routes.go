@@ -17,7 +17,18 @@ func InitOperationLogRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddle
 	router.Use(middleware.CasbinMiddleware())
 	{
 		router.GET("/operation/list", operationLogController.GetOperationLogs)
+		router.GET("/operation/detail/:operationLogId", operationLogController.GetOperationLogById)
+		router.GET("/operation/export", operationLogController.ExportOperationLogs)
+		router.GET("/operation/tail", operationLogController.TailOperationLogs)
+		router.GET("/operation/verify", operationLogController.VerifyOperationLogs)
 		router.DELETE("/operation/delete/batch", operationLogController.BatchDeleteOperationLogByIds)
+		router.PATCH("/ipLocation/reload", operationLogController.ReloadIpLocation)
+		router.GET("/stats/traffic", operationLogController.GetTrafficStats)
+		router.GET("/stats/users", operationLogController.GetTopUserStats)
+		router.GET("/stats/paths", operationLogController.GetTopPathStats)
+		router.GET("/stats/statuses", operationLogController.GetStatusStats)
+		router.GET("/stats/logins", operationLogController.GetLoginFailureStats)
+		router.GET("/stats/clients", operationLogController.GetClientStats)
 	}
 
 	return r
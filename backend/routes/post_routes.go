@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/esyede/goadmin/backend/controller"
+	"github.com/esyede/goadmin/backend/middleware"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func InitPostRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gin.IRoutes {
+	postController := controller.NewPostController()
+	router := r.Group("/post")
+	// Enable jwt auth middleware
+	router.Use(authMiddleware.MiddlewareFunc())
+	// Enable casbin auth middleware
+	router.Use(middleware.CasbinMiddleware())
+	{
+		router.GET("/list", postController.GetPosts)
+		router.POST("/create", postController.CreatePost)
+		router.PATCH("/update/:postId", postController.UpdatePostById)
+		router.DELETE("/delete/batch", postController.BatchDeletePostByIds)
+	}
+
+	return r
+}
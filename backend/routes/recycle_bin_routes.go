@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/esyede/goadmin/backend/controller"
+	"github.com/esyede/goadmin/backend/middleware"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func InitRecycleBinRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gin.IRoutes {
+	recycleBinController := controller.NewRecycleBinController()
+	router := r.Group("/recycle")
+	// Enable jwt auth middleware
+	router.Use(authMiddleware.MiddlewareFunc())
+	// Enable casbin auth middleware
+	router.Use(middleware.CasbinMiddleware())
+	{
+		router.GET("/list/:entityType", recycleBinController.GetRecycleBin)
+		router.PATCH("/restore/:entityType", recycleBinController.RestoreByIds)
+		router.DELETE("/purge/:entityType", recycleBinController.PurgeByIds)
+	}
+
+	return r
+}
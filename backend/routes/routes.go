@@ -20,6 +20,9 @@ func InitRoutes() *gin.Engine {
 	// r := gin.New()
 	// r.Use(gin.Recovery())
 
+	// Enable i18n middleware, it comes first so that every response message is translated
+	r.Use(middleware.I18nMiddleware())
+
 	// Enable rate limiting middleware
 	// Default is to fill one token every 50 milliseconds, up to 200
 	fillInterval := time.Duration(config.Conf.RateLimit.FillInterval)
@@ -32,6 +35,11 @@ func InitRoutes() *gin.Engine {
 	// Enable operation log middleware
 	r.Use(middleware.OperationLogMiddleware())
 
+	// Serve files saved by the local storage backend
+	if config.Conf.Upload.Driver == "" || config.Conf.Upload.Driver == "local" {
+		r.Static(config.Conf.Upload.UrlPrefix, config.Conf.Upload.Path)
+	}
+
 	// Initialize JWT auth middleware
 	authMiddleware, err := middleware.InitAuth()
 
@@ -44,12 +52,19 @@ func InitRoutes() *gin.Engine {
 	apiGroup := r.Group("/" + config.Conf.System.UrlPathPrefix)
 
 	// 注册路由
-	InitBaseRoutes(apiGroup, authMiddleware)         // Register basic routes, no jwt auth middleware, no casbin middleware required
-	InitUserRoutes(apiGroup, authMiddleware)         // Register user routes, jwt auth middleware, casbin auth middleware
-	InitRoleRoutes(apiGroup, authMiddleware)         // Register role routes, jwt auth middleware, casbin auth middleware
-	InitMenuRoutes(apiGroup, authMiddleware)         // Registration menu routes, jwt auth middleware, casbin auth middleware
-	InitApiRoutes(apiGroup, authMiddleware)          // Register interface routes, jwt auth middleware, casbin auth middleware
-	InitOperationLogRoutes(apiGroup, authMiddleware) // Register operation log routes, jwt auth middleware, casbin auth middleware
+	InitBaseRoutes(apiGroup, authMiddleware)          // Register basic routes, no jwt auth middleware, no casbin middleware required
+	InitUserRoutes(apiGroup, authMiddleware)          // Register user routes, jwt auth middleware, casbin auth middleware
+	InitRoleRoutes(apiGroup, authMiddleware)          // Register role routes, jwt auth middleware, casbin auth middleware
+	InitMenuRoutes(apiGroup, authMiddleware)          // Registration menu routes, jwt auth middleware, casbin auth middleware
+	InitApiRoutes(apiGroup, authMiddleware)           // Register interface routes, jwt auth middleware, casbin auth middleware
+	InitOperationLogRoutes(apiGroup, authMiddleware)  // Register operation log routes, jwt auth middleware, casbin auth middleware
+	InitDepartmentRoutes(apiGroup, authMiddleware)    // Register department routes, jwt auth middleware, casbin auth middleware
+	InitPostRoutes(apiGroup, authMiddleware)          // Register post routes, jwt auth middleware, casbin auth middleware
+	InitRecycleBinRoutes(apiGroup, authMiddleware)    // Register recycle bin routes, jwt auth middleware, casbin auth middleware
+	InitInvitationRoutes(apiGroup, authMiddleware)    // Register user invitation routes, jwt auth middleware, casbin auth middleware
+	InitUserAttributeRoutes(apiGroup, authMiddleware) // Register user attribute routes, jwt auth middleware, casbin auth middleware
+	InitChangeLogRoutes(apiGroup, authMiddleware)     // Register change history routes, jwt auth middleware, casbin auth middleware
+	InitSecurityEventRoutes(apiGroup, authMiddleware) // Register security event routes, jwt auth middleware, casbin auth middleware
 
 	common.Log.Info("Initial routing is completed!")
 	return r
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/esyede/goadmin/backend/controller"
+	"github.com/esyede/goadmin/backend/middleware"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func InitSecurityEventRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gin.IRoutes {
+	securityEventController := controller.NewSecurityEventController()
+	router := r.Group("/security")
+	// Enable jwt auth middleware
+	router.Use(authMiddleware.MiddlewareFunc())
+	// Enable casbin auth middleware
+	router.Use(middleware.CasbinMiddleware())
+	{
+		router.GET("/event/list", securityEventController.GetSecurityEvents)
+		router.GET("/event/counts", securityEventController.GetSecurityEventCounts)
+	}
+
+	return r
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/esyede/goadmin/backend/controller"
+	"github.com/esyede/goadmin/backend/middleware"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func InitUserAttributeRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gin.IRoutes {
+	userAttributeController := controller.NewUserAttributeController()
+	router := r.Group("/user-attribute")
+	// Enable jwt auth middleware
+	router.Use(authMiddleware.MiddlewareFunc())
+	// Enable casbin auth middleware
+	router.Use(middleware.CasbinMiddleware())
+	{
+		router.GET("/list", userAttributeController.GetUserAttributes)
+		router.POST("/create", userAttributeController.CreateUserAttribute)
+		router.PATCH("/update/:attributeId", userAttributeController.UpdateUserAttributeById)
+		router.DELETE("/delete/batch", userAttributeController.BatchDeleteUserAttributeByIds)
+	}
+
+	return r
+}
@@ -22,6 +22,14 @@ func InitUserRoutes(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) gi
 		router.POST("/create", userController.CreateUser)
 		router.PATCH("/update/:userId", userController.UpdateUserById)
 		router.DELETE("/delete/batch", userController.BatchDeleteUserByIds)
+		router.PATCH("/batch/status", userController.BatchUpdateUserStatus)
+		router.PATCH("/batch/roles", userController.BatchUpdateUserRoles)
+		router.PATCH("/batch/password/reset", userController.BatchResetPwd)
+		router.POST("/import", userController.ImportUsers)
+		router.GET("/export", userController.ExportUsers)
+		router.PATCH("/profile", userController.UpdateProfile)
+		router.POST("/profile/avatar", userController.UploadAvatar)
+		router.POST("/impersonate/:userId", userController.ImpersonateUser)
 	}
 
 	return r
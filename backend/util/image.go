@@ -0,0 +1,63 @@
+package util
+
+import (
+	"image"
+	"image/color"
+)
+
+// Crop the image to the aspect ratio of width x height around its center and scale it to exactly that size
+func CropResize(src image.Image, width int, height int) image.Image {
+	b := src.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+
+	// Largest centered area with the target aspect ratio
+	cropW, cropH := srcW, srcW*height/width
+	if cropH > srcH {
+		cropW, cropH = srcH*width/height, srcH
+	}
+	if cropW < 1 {
+		cropW = 1
+	}
+	if cropH < 1 {
+		cropH = 1
+	}
+	x0 := b.Min.X + (srcW-cropW)/2
+	y0 := b.Min.Y + (srcH-cropH)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	scaleX := float64(cropW) / float64(width)
+	scaleY := float64(cropH) / float64(height)
+	for y := 0; y < height; y++ {
+		// Average all source pixels covered by the target pixel (box filter), which also works when enlarging
+		sy0 := y0 + int(float64(y)*scaleY)
+		sy1 := y0 + int(float64(y+1)*scaleY)
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < width; x++ {
+			sx0 := x0 + int(float64(x)*scaleX)
+			sx1 := x0 + int(float64(x+1)*scaleX)
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					bl += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+// Layout of an ip2region xdb file: a 256 byte header, a vector index of 256*256 (start, end) segment index pointers
+// by the first two bytes of an address, then sorted segment index blocks pointing to the region strings
+const (
+	xdbHeaderLength      = 256
+	xdbVectorIndexCols   = 256
+	xdbVectorIndexSize   = 8
+	xdbSegmentIndexSize  = 14
+	xdbVectorIndexLength = xdbVectorIndexCols * xdbVectorIndexCols * xdbVectorIndexSize
+)
+
+// Searcher of an ip2region xdb database held in memory, only IPv4 addresses are covered
+type Ip2Region struct {
+	data []byte
+}
+
+func NewIp2Region(data []byte) (*Ip2Region, error) {
+	if len(data) < xdbHeaderLength+xdbVectorIndexLength {
+		return nil, errors.New("Not a valid ip2region xdb file")
+	}
+	return &Ip2Region{data: data}, nil
+}
+
+// Region of an address as stored in the database, e.g. "Country|0|Province|City|ISP" with 0 for unknown parts.
+// The region is empty when the address is not in the database.
+func (r *Ip2Region) Search(ip net.IP) (string, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return "", nil
+	}
+	n := binary.BigEndian.Uint32(ip4)
+
+	idx := xdbHeaderLength + (int(ip4[0])*xdbVectorIndexCols+int(ip4[1]))*xdbVectorIndexSize
+	sPtr := int(binary.LittleEndian.Uint32(r.data[idx:]))
+	ePtr := int(binary.LittleEndian.Uint32(r.data[idx+4:]))
+	if sPtr == 0 || ePtr < sPtr || ePtr+xdbSegmentIndexSize > len(r.data) {
+		return "", nil
+	}
+
+	// Binary search of the segments starting with the same two bytes
+	l, h := 0, (ePtr-sPtr)/xdbSegmentIndexSize
+	for l <= h {
+		m := (l + h) / 2
+		p := sPtr + m*xdbSegmentIndexSize
+		startIp := binary.LittleEndian.Uint32(r.data[p:])
+		endIp := binary.LittleEndian.Uint32(r.data[p+4:])
+		switch {
+		case n < startIp:
+			h = m - 1
+		case n > endIp:
+			l = m + 1
+		default:
+			dataLen := int(binary.LittleEndian.Uint16(r.data[p+8:]))
+			dataPtr := int(binary.LittleEndian.Uint32(r.data[p+10:]))
+			if dataPtr+dataLen > len(r.data) {
+				return "", errors.New("Not a valid ip2region xdb file")
+			}
+			return string(r.data[dataPtr : dataPtr+dataLen]), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Fixed-size cache of strings evicting the least recently used entry, safe for concurrent use
+type LRUCache struct {
+	size  int
+	mu    sync.Mutex
+	order *list.List // Front is the most recently used
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value string
+}
+
+func NewLRUCache(size int) *LRUCache {
+	if size < 1 {
+		size = 1
+	}
+	return &LRUCache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *LRUCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *LRUCache) Set(key string, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Remove all entries
+func (c *LRUCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ttacon/libphonenumber"
+)
+
+// Whether national phone numbers of a region (ISO 3166-1 alpha-2 code) can be read
+func IsPhoneRegion(region string) bool {
+	_, ok := libphonenumber.GetSupportedRegions()[strings.ToUpper(region)]
+	return ok
+}
+
+// Normalize a phone number to E.164 ("+" followed by at most 15 digits), checked against the numbering plan of its region.
+// Numbers written without a country calling code ("+" or "00" prefix) are read as national numbers of defaultRegion.
+func NormalizePhone(number string, defaultRegion string) (string, error) {
+	number = strings.TrimSpace(number)
+	if number == "" {
+		return "", errors.New("Phone number is empty")
+	}
+	if !IsPhoneRegion(defaultRegion) {
+		return "", fmt.Errorf("Unknown phone region %s", defaultRegion)
+	}
+	// Only the separators people usually write numbers with, no letters or extensions
+	for i, ch := range number {
+		switch {
+		case ch >= '0' && ch <= '9':
+		case ch == ' ' || ch == '-' || ch == '.' || ch == '(' || ch == ')':
+		case ch == '+' && i == 0:
+		default:
+			return "", fmt.Errorf("Invalid character %q in phone number", ch)
+		}
+	}
+	// "00" is the international prefix of most regions, the library only knows the one of defaultRegion
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+
+	parsed, err := libphonenumber.Parse(number, strings.ToUpper(defaultRegion))
+	if err != nil || !libphonenumber.IsValidNumber(parsed) {
+		return "", errors.New("Phone number is not valid")
+	}
+	return libphonenumber.Format(parsed, libphonenumber.E164), nil
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Replaces the values of redacted fields
+const RedactedValue = "******"
+
+// Replace the values of the fields in a decoded json value, field names are compared case-insensitively
+func RedactValue(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if containsFold(fields, key) {
+				v[key] = RedactedValue
+			} else {
+				v[key] = RedactValue(item, fields)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = RedactValue(item, fields)
+		}
+	}
+	return value
+}
+
+// Replace the values of the fields in a json document.
+// A document that is not valid json, e.g. because it was cut off, is redacted as text.
+func RedactJson(data []byte, fields []string) string {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		if redacted, err := MarshalJson(RedactValue(value, fields)); err == nil {
+			return redacted
+		}
+	}
+	return redactText(string(data), fields)
+}
+
+// Encode a value as json without escaping html characters, which only makes logs harder to read
+func MarshalJson(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func redactText(text string, fields []string) string {
+	if len(fields) == 0 {
+		return text
+	}
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		quoted[i] = regexp.QuoteMeta(field)
+	}
+	// A string value may be cut off without its closing quote
+	re := regexp.MustCompile(`(?i)"(` + strings.Join(quoted, "|") + `)"\s*:\s*("(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`)
+	return re.ReplaceAllString(text, `"${1}":"`+RedactedValue+`"`)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
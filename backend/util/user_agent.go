@@ -0,0 +1,93 @@
+package util
+
+import "strings"
+
+// Browser, operating system and device type of a User-Agent header
+type UserAgent struct {
+	Browser    string // Browser or client name like Chrome or curl, empty when unknown
+	Os         string // Operating system name like Windows or Android, empty when unknown
+	DeviceType string // desktop, mobile, tablet or bot, empty when unknown
+}
+
+// Rule matching a User-Agent by any of its tokens, checked in order.
+// Tokens are matched anywhere in the lowercased header, so short ones carry the separator
+// that follows them, e.g. "cros " would otherwise match "microsoft" and "bot/" the CUBOT phones.
+type userAgentRule struct {
+	Name   string
+	Tokens []string
+}
+
+// Bots and command line clients, they are recognized before browsers because many of them mimic one
+var userAgentBots = []userAgentRule{
+	{"Googlebot", []string{"googlebot"}},
+	{"Bingbot", []string{"bingbot"}},
+	{"curl", []string{"curl/"}},
+	{"Wget", []string{"wget/"}},
+	{"Postman", []string{"postmanruntime/"}},
+	{"Python", []string{"python-requests/", "python-urllib/", "aiohttp/"}},
+	{"Go", []string{"go-http-client/"}},
+	{"Java", []string{"java/", "okhttp/", "apache-httpclient/"}},
+	{"Bot", []string{"bot/", "bot;", "bot)", "bot-", "crawler", "spider", "headless"}},
+}
+
+// Browsers that are built on others carry their tokens too, so they come first
+var userAgentBrowsers = []userAgentRule{
+	{"Edge", []string{"edg/", "edga/", "edgios/", "edge/"}},
+	{"Opera", []string{"opr/", "opera"}},
+	{"Samsung Internet", []string{"samsungbrowser/"}},
+	{"UC Browser", []string{"ucbrowser/"}},
+	{"WeChat", []string{"micromessenger/"}},
+	{"Firefox", []string{"firefox/", "fxios/"}},
+	{"Chrome", []string{"chrome/", "crios/", "chromium/"}},
+	{"Safari", []string{"safari/"}},
+	{"Internet Explorer", []string{"msie ", "trident/"}},
+}
+
+// iOS and Android devices carry the tokens of desktop systems too, so they come first
+var userAgentSystems = []userAgentRule{
+	{"iOS", []string{"iphone", "ipad", "ipod"}},
+	{"Android", []string{"android"}},
+	{"Windows", []string{"windows"}},
+	{"ChromeOS", []string{"cros "}},
+	{"macOS", []string{"macintosh", "mac os x"}},
+	{"Linux", []string{"linux", "x11"}},
+}
+
+// Parse a User-Agent header by the tokens of well-known browsers, systems and clients
+func ParseUserAgent(header string) UserAgent {
+	ua := strings.ToLower(header)
+	var result UserAgent
+	if strings.TrimSpace(ua) == "" {
+		return result
+	}
+	result.Os = matchUserAgent(ua, userAgentSystems)
+	if bot := matchUserAgent(ua, userAgentBots); bot != "" {
+		result.Browser = bot
+		result.DeviceType = "bot"
+		return result
+	}
+	result.Browser = matchUserAgent(ua, userAgentBrowsers)
+
+	switch {
+	// Android tablets leave out the "mobile" token
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		result.DeviceType = "tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		result.DeviceType = "mobile"
+	case result.Os != "" || result.Browser != "":
+		result.DeviceType = "desktop"
+	}
+	return result
+}
+
+func matchUserAgent(ua string, rules []userAgentRule) string {
+	for _, rule := range rules {
+		for _, token := range rule.Tokens {
+			if strings.Contains(ua, token) {
+				return rule.Name
+			}
+		}
+	}
+	return ""
+}
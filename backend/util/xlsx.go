@@ -0,0 +1,301 @@
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Minimal xlsx support (first worksheet only, cell values as strings), enough for importing and exporting tables
+
+const (
+	xlsxMaxColumns  = 16384    // Columns of a worksheet, "A" to "XFD"
+	xlsxMaxPartSize = 64 << 20 // Decompressed size a part of an uploaded file may have, so that zip bombs are rejected
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		Rid  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxRichText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt xlsxRichText) String() string {
+	if len(rt.R) == 0 {
+		return rt.T
+	}
+	var sb strings.Builder
+	for _, r := range rt.R {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref   string        `xml:"r,attr"`
+			Type  string        `xml:"t,attr"`
+			Value string        `xml:"v"`
+			Is    *xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Read all rows of the first worksheet
+func ReadXlsxRows(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("Not a valid xlsx file: %v", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := xlsxFirstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var sharedStrings xlsxSharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := xlsxDecode(f, &sharedStrings); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("Worksheet %s not found in xlsx file", sheetPath)
+	}
+	var sheet xlsxWorksheet
+	if err := xlsxDecode(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		values := make([]string, 0, len(row.Cells))
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col, err = xlsxColumnIndex(cell.Ref)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if col >= xlsxMaxColumns {
+				return nil, fmt.Errorf("Row has more than %d columns", xlsxMaxColumns)
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+			var value string
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err == nil && idx >= 0 && idx < len(sharedStrings.Items) {
+					value = sharedStrings.Items[idx].String()
+				}
+			case "inlineStr":
+				if cell.Is != nil {
+					value = cell.Is.String()
+				}
+			default:
+				value = cell.Value
+			}
+			if col < len(values) {
+				values[col] = value
+			} else {
+				values = append(values, value)
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+func xlsxFirstSheetPath(files map[string]*zip.File) (string, error) {
+	const defaultPath = "xl/worksheets/sheet1.xml"
+	wf, ok := files["xl/workbook.xml"]
+	if !ok {
+		return defaultPath, nil
+	}
+	var workbook xlsxWorkbook
+	if err := xlsxDecode(wf, &workbook); err != nil {
+		return "", err
+	}
+	rf, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok || len(workbook.Sheets) == 0 {
+		return defaultPath, nil
+	}
+	var rels xlsxRelationships
+	if err := xlsxDecode(rf, &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.Id == workbook.Sheets[0].Rid {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return defaultPath, nil
+}
+
+func xlsxDecode(f *zip.File, v interface{}) error {
+	// The sizes in the zip headers can be forged, the limit reader stops the decompression anyway
+	if f.UncompressedSize64 > xlsxMaxPartSize {
+		return fmt.Errorf("%s of the xlsx file is too large", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	lr := &io.LimitedReader{R: rc, N: xlsxMaxPartSize + 1}
+	if err := xml.NewDecoder(lr).Decode(v); err != nil {
+		if lr.N <= 0 {
+			return fmt.Errorf("%s of the xlsx file is too large", f.Name)
+		}
+		return fmt.Errorf("Failed to parse %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+// Convert a cell reference such as "AB12" to a zero-based column index
+func xlsxColumnIndex(ref string) (int, error) {
+	col := 0
+	letters := 0
+	for letters < len(ref) && ref[letters] >= 'A' && ref[letters] <= 'Z' {
+		// Longer references are rejected below, stop before the index overflows
+		if letters < 3 {
+			col = col*26 + int(ref[letters]-'A'+1)
+		}
+		letters++
+	}
+	digits := ref[letters:]
+	valid := letters >= 1 && letters <= 3 && digits != ""
+	for i := 0; valid && i < len(digits); i++ {
+		valid = digits[i] >= '0' && digits[i] <= '9'
+	}
+	if !valid || col > xlsxMaxColumns {
+		return 0, fmt.Errorf("Invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// Convert a zero-based column index to its letters, such as 27 to "AB"
+func xlsxColumnName(col int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+	return name
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookXml = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// Write rows as a single-sheet xlsx file, every cell is stored as an inline string
+func WriteXlsx(w io.Writer, rows [][]string) error {
+	zw := zip.NewWriter(w)
+	staticParts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookXml},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range staticParts {
+		fw, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, part.content); err != nil {
+			return err
+		}
+	}
+
+	fw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&buf, `<row r="%d">`, i+1)
+		for j, value := range row {
+			fmt.Fprintf(&buf, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, xlsxColumnName(j), i+1)
+			if err := xml.EscapeText(&buf, []byte(value)); err != nil {
+				return err
+			}
+			buf.WriteString(`</t></is></c>`)
+		}
+		buf.WriteString(`</row>`)
+		// Flush the buffer regularly so that large exports are not held in memory as one string
+		if buf.Len() > 64*1024 {
+			if _, err := buf.WriteTo(fw); err != nil {
+				return err
+			}
+		}
+	}
+	buf.WriteString(`</sheetData></worksheet>`)
+	if _, err := buf.WriteTo(fw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Prefix values that spreadsheet programs would run as formulas with a quote, for csv and xlsx exports
+func EscapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Remove the quote added by EscapeFormula, so that exported files can be imported again
+func UnescapeFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
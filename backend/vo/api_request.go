@@ -14,6 +14,8 @@ type CreateApiRequest struct {
 	Path     string `json:"path" form:"path" validate:"required,min=1,max=100"`
 	Category string `json:"category" form:"category" validate:"required,min=1,max=50"`
 	Desc     string `json:"desc" form:"desc" validate:"min=0,max=100"`
+	// Descriptions in other locales by locale
+	Descs map[string]string `json:"descs" form:"-" validate:"dive,keys,checkLocale,endkeys,max=100"`
 }
 
 type UpdateApiRequest struct {
@@ -21,6 +23,8 @@ type UpdateApiRequest struct {
 	Path     string `json:"path" form:"path" validate:"min=1,max=100"`
 	Category string `json:"category" form:"category" validate:"min=1,max=50"`
 	Desc     string `json:"desc" form:"desc" validate:"min=0,max=100"`
+	// Descriptions in other locales by locale
+	Descs map[string]string `json:"descs" form:"-" validate:"dive,keys,checkLocale,endkeys,max=100"`
 }
 
 type DeleteApiRequest struct {
@@ -0,0 +1,8 @@
+package vo
+
+type ChangeHistoryRequest struct {
+	EntityType string `json:"entityType" form:"entityType" validate:"oneof=user role menu api"`
+	EntityId   uint   `json:"entityId" form:"entityId" validate:"required"`
+	PageNum    int    `json:"pageNum" form:"pageNum"`
+	PageSize   int    `json:"pageSize" form:"pageSize"`
+}
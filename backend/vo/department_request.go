@@ -0,0 +1,27 @@
+package vo
+
+type DepartmentListRequest struct {
+	Name     string `json:"name" form:"name"`
+	Code     string `json:"code" form:"code"`
+	Status   uint   `json:"status" form:"status"`
+	PageNum  uint   `json:"pageNum" form:"pageNum"`
+	PageSize uint   `json:"pageSize" form:"pageSize"`
+}
+
+type CreateDepartmentRequest struct {
+	Name      string `json:"name" form:"name" validate:"required,min=1,max=50"`
+	Code      string `json:"code" form:"code" validate:"required,min=1,max=50"`
+	Desc      string `json:"desc" form:"desc" validate:"min=0,max=100"`
+	Sort      uint   `json:"sort" form:"sort" validate:"gte=1,lte=999"`
+	Status    uint   `json:"status" form:"status" validate:"oneof=1 2"`
+	ParentId  uint   `json:"parentId" form:"parentId"`
+	LeaderIds []uint `json:"leaderIds" form:"leaderIds"`
+}
+
+type DeleteDepartmentRequest struct {
+	DepartmentIds []uint `json:"departmentIds" form:"departmentIds"`
+}
+
+type UpdateDepartmentUsersRequest struct {
+	UserIds []uint `json:"userIds" form:"userIds"`
+}
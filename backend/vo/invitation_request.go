@@ -0,0 +1,30 @@
+package vo
+
+type InviteUserRequest struct {
+	Username      string `form:"username" json:"username" validate:"required,min=2,max=20,checkUnreserved"`
+	Mobile        string `form:"mobile" json:"mobile" validate:"required,checkMobile"`
+	Email         string `form:"email" json:"email" validate:"required,email,max=100"`
+	Nickname      string `form:"nickname" json:"nickname" validate:"min=0,max=20"`
+	Introduction  string `form:"introduction" json:"introduction" validate:"min=0,max=255"`
+	RoleIds       []uint `form:"roleIds" json:"roleIds" validate:"required"`
+	DepartmentIds []uint `form:"departmentIds" json:"departmentIds"`
+	DepartmentId  uint   `form:"departmentId" json:"departmentId"`
+	PostIds       []uint `form:"postIds" json:"postIds"`
+	// Custom attribute values by attribute key
+	Attributes map[string]string `form:"-" json:"attributes"`
+}
+
+type InvitationListRequest struct {
+	Username string `json:"username" form:"username"`
+	PageNum  uint   `json:"pageNum" form:"pageNum"`
+	PageSize uint   `json:"pageSize" form:"pageSize"`
+}
+
+type CheckInvitationRequest struct {
+	Token string `json:"token" form:"token" validate:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" form:"token" validate:"required"`
+	Password string `json:"password" form:"password" validate:"required"`
+}
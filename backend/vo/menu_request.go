@@ -1,7 +1,7 @@
 package vo
 
 type CreateMenuRequest struct {
-	Name       string `json:"name" form:"name" validate:"required,min=1,max=50"`
+	Name       string `json:"name" form:"name" validate:"required,min=1,max=50,checkUnreserved"`
 	Title      string `json:"title" form:"title" validate:"required,min=1,max=50"`
 	Icon       string `json:"icon" form:"icon" validate:"min=0,max=50"`
 	Path       string `json:"path" form:"path" validate:"required,min=1,max=100"`
@@ -15,10 +15,12 @@ type CreateMenuRequest struct {
 	Breadcrumb uint   `json:"breadcrumb" form:"breadcrumb" validate:"oneof=1 2"`
 	ActiveMenu string `json:"activeMenu" form:"activeMenu" validate:"min=0,max=100"`
 	ParentId   uint   `json:"parentId" form:"parentId"`
+	// Titles in other locales by locale
+	Titles map[string]string `json:"titles" form:"-" validate:"dive,keys,checkLocale,endkeys,max=50"`
 }
 
 type UpdateMenuRequest struct {
-	Name       string `json:"name" form:"name" validate:"required,min=1,max=50"`
+	Name       string `json:"name" form:"name" validate:"required,min=1,max=50,checkUnreserved"`
 	Title      string `json:"title" form:"title" validate:"required,min=1,max=50"`
 	Icon       string `json:"icon" form:"icon" validate:"min=0,max=50"`
 	Path       string `json:"path" form:"path" validate:"required,min=1,max=100"`
@@ -32,8 +34,27 @@ type UpdateMenuRequest struct {
 	Breadcrumb uint   `json:"breadcrumb" form:"breadcrumb" validate:"oneof=1 2"`
 	ActiveMenu string `json:"activeMenu" form:"activeMenu" validate:"min=0,max=100"`
 	ParentId   uint   `json:"parentId" form:"parentId"`
+	// Titles in other locales by locale
+	Titles map[string]string `json:"titles" form:"-" validate:"dive,keys,checkLocale,endkeys,max=50"`
 }
 
 type DeleteMenuRequest struct {
 	MenuIds []uint `json:"menuIds" form:"menuIds"`
 }
+
+type MoveMenusRequest struct {
+	Menus []MoveMenuItem `json:"menus" form:"menus" validate:"required,min=1,dive"`
+}
+
+// New position of a menu
+type MoveMenuItem struct {
+	ID       uint `json:"ID" form:"ID" validate:"required"`
+	ParentId uint `json:"parentId" form:"parentId"`
+	Sort     uint `json:"sort" form:"sort" validate:"gte=1,lte=999"`
+}
+
+// The menu file is uploaded as the "file" form field
+type ImportMenusRequest struct {
+	// Move the menus missing from the file to the recycle bin
+	Prune bool `json:"prune" form:"prune"`
+}
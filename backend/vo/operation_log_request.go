@@ -1,14 +1,49 @@
 package vo
 
 type OperationLogListRequest struct {
-	Username string `json:"username" form:"username"`
-	Ip       string `json:"ip" form:"ip"`
-	Path     string `json:"path" form:"path"`
-	Status   int    `json:"status" form:"status"`
-	PageNum  int    `json:"pageNum" form:"pageNum"`
-	PageSize int    `json:"pageSize" form:"pageSize"`
+	Username      string `json:"username" form:"username"`
+	Ip            string `json:"ip" form:"ip"`
+	Path          string `json:"path" form:"path"`
+	Status        int    `json:"status" form:"status"`
+	StatusClass   int    `json:"statusClass" form:"statusClass" validate:"omitempty,oneof=1 2 3 4 5"`
+	Method        string `json:"method" form:"method" validate:"omitempty,oneof=GET POST PUT PATCH DELETE HEAD OPTIONS"`
+	Browser       string `json:"browser" form:"browser"`
+	Os            string `json:"os" form:"os"`
+	DeviceType    string `json:"deviceType" form:"deviceType" validate:"omitempty,oneof=desktop mobile tablet bot"`
+	StartTimeFrom string `json:"startTimeFrom" form:"startTimeFrom" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	StartTimeTo   string `json:"startTimeTo" form:"startTimeTo" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	MinTimeCost   int64  `json:"minTimeCost" form:"minTimeCost" validate:"gte=0"`
+	MaxTimeCost   int64  `json:"maxTimeCost" form:"maxTimeCost" validate:"gte=0"`
+	Desc          string `json:"desc" form:"desc"`
+	Keyword       string `json:"keyword" form:"keyword" validate:"max=100"`
+	SortBy        string `json:"sortBy" form:"sortBy" validate:"omitempty,oneof=startTime timeCost status"`
+	SortOrder     string `json:"sortOrder" form:"sortOrder" validate:"omitempty,oneof=asc desc"`
+	Keyset        bool   `json:"keyset" form:"keyset"`
+	Cursor        string `json:"cursor" form:"cursor"`
+	PageNum       int    `json:"pageNum" form:"pageNum"`
+	PageSize      int    `json:"pageSize" form:"pageSize" validate:"gte=0,lte=1000"`
+}
+
+type ExportOperationLogsRequest struct {
+	OperationLogListRequest
+	Format string `json:"format" form:"format" validate:"omitempty,oneof=csv ndjson"`
+}
+
+// Filters of the live tail, the status is a code like 404 or a class like 5xx
+type OperationLogTailRequest struct {
+	Username   string `json:"username" form:"username"`
+	PathPrefix string `json:"pathPrefix" form:"pathPrefix"`
+	Status     string `json:"status" form:"status" validate:"omitempty,len=3"`
 }
 
 type DeleteOperationLogRequest struct {
 	OperationLogIds []uint `json:"operationLogIds" form:"operationLogIds"`
 }
+
+type OperationLogStatsRequest struct {
+	StartTimeFrom string `json:"startTimeFrom" form:"startTimeFrom" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	StartTimeTo   string `json:"startTimeTo" form:"startTimeTo" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	Interval      string `json:"interval" form:"interval" validate:"omitempty,oneof=hour day"`
+	Top           int    `json:"top" form:"top" validate:"gte=0,lte=100"`
+	Source        string `json:"source" form:"source" validate:"omitempty,oneof=raw rollup"`
+}
@@ -0,0 +1,21 @@
+package vo
+
+type CreatePostRequest struct {
+	Code   string `json:"code" form:"code" validate:"required,min=1,max=50"`
+	Name   string `json:"name" form:"name" validate:"required,min=1,max=50"`
+	Desc   string `json:"desc" form:"desc" validate:"min=0,max=100"`
+	Sort   uint   `json:"sort" form:"sort" validate:"gte=1,lte=999"`
+	Status uint   `json:"status" form:"status" validate:"oneof=1 2"`
+}
+
+type PostListRequest struct {
+	Code     string `json:"code" form:"code"`
+	Name     string `json:"name" form:"name"`
+	Status   uint   `json:"status" form:"status"`
+	PageNum  uint   `json:"pageNum" form:"pageNum"`
+	PageSize uint   `json:"pageSize" form:"pageSize"`
+}
+
+type DeletePostRequest struct {
+	PostIds []uint `json:"postIds" form:"postIds"`
+}
@@ -0,0 +1,12 @@
+package vo
+
+type RecycleBinListRequest struct {
+	EntityType string `json:"entityType" form:"entityType" validate:"oneof=user role menu api operationLog"`
+	PageNum    uint   `json:"pageNum" form:"pageNum"`
+	PageSize   uint   `json:"pageSize" form:"pageSize"`
+}
+
+type RecycleBinIdsRequest struct {
+	EntityType string `json:"entityType" form:"entityType" validate:"oneof=user role menu api operationLog"`
+	Ids        []uint `json:"ids" form:"ids" validate:"required,min=1"`
+}
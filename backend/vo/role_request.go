@@ -1,8 +1,8 @@
 package vo
 
 type CreateRoleRequest struct {
-	Name    string `json:"name" form:"name" validate:"required,min=1,max=20"`
-	Keyword string `json:"keyword" form:"keyword" validate:"required,min=1,max=20"`
+	Name    string `json:"name" form:"name" validate:"required,min=1,max=20,checkUnreserved"`
+	Keyword string `json:"keyword" form:"keyword" validate:"required,min=1,max=20,checkUnreserved"`
 	Desc    string `json:"desc" form:"desc" validate:"min=0,max=100"`
 	Status  uint   `json:"status" form:"status" validate:"oneof=1 2"`
 	Sort    uint   `json:"sort" form:"sort" validate:"gte=1,lte=999"`
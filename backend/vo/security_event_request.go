@@ -0,0 +1,11 @@
+package vo
+
+type SecurityEventListRequest struct {
+	Type          string `json:"type" form:"type" validate:"omitempty,oneof=login_success login_failure logout token_refresh token_invalid lockout permission_denied privilege_change"`
+	Username      string `json:"username" form:"username"`
+	Ip            string `json:"ip" form:"ip"`
+	StartTimeFrom string `json:"startTimeFrom" form:"startTimeFrom" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	StartTimeTo   string `json:"startTimeTo" form:"startTimeTo" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	PageNum       int    `json:"pageNum" form:"pageNum"`
+	PageSize      int    `json:"pageSize" form:"pageSize" validate:"gte=0,lte=1000"`
+}
@@ -0,0 +1,24 @@
+package vo
+
+type CreateUserAttributeRequest struct {
+	Key      string   `json:"key" form:"key" validate:"required,min=1,max=50,alphanum"`
+	Name     string   `json:"name" form:"name" validate:"required,min=1,max=50"`
+	Type     string   `json:"type" form:"type" validate:"oneof=string number boolean date enum"`
+	Required bool     `json:"required" form:"required"`
+	Pattern  string   `json:"pattern" form:"pattern" validate:"max=255"`
+	Options  []string `json:"options" form:"options" validate:"dive,required,max=255"`
+	Sort     uint     `json:"sort" form:"sort" validate:"gte=1,lte=999"`
+	Status   uint     `json:"status" form:"status" validate:"oneof=1 2"`
+}
+
+type UserAttributeListRequest struct {
+	Key      string `json:"key" form:"key"`
+	Name     string `json:"name" form:"name"`
+	Status   uint   `json:"status" form:"status"`
+	PageNum  uint   `json:"pageNum" form:"pageNum"`
+	PageSize uint   `json:"pageSize" form:"pageSize"`
+}
+
+type DeleteUserAttributeRequest struct {
+	AttributeIds []uint `json:"attributeIds" form:"attributeIds"`
+}
@@ -1,34 +1,79 @@
 package vo
 
 type RegisterAndLoginRequest struct {
+	// Username, email or mobile
 	Username string `form:"username" json:"username" binding:"required"`
 	Password string `form:"password" json:"password" binding:"required"`
 }
 
 type CreateUserRequest struct {
-	Username     string `form:"username" json:"username" validate:"required,min=2,max=20"`
-	Password     string `form:"password" json:"password"`
-	Mobile       string `form:"mobile" json:"mobile" validate:"required,checkMobile"`
-	Avatar       string `form:"avatar" json:"avatar"`
-	Nickname     string `form:"nickname" json:"nickname" validate:"min=0,max=20"`
-	Introduction string `form:"introduction" json:"introduction" validate:"min=0,max=255"`
-	Status       uint   `form:"status" json:"status" validate:"oneof=1 2"`
-	RoleIds      []uint `form:"roleIds" json:"roleIds" validate:"required"`
+	Username      string `form:"username" json:"username" validate:"required,min=2,max=20,checkUnreserved"`
+	Password      string `form:"password" json:"password"`
+	Mobile        string `form:"mobile" json:"mobile" validate:"required,checkMobile"`
+	Email         string `form:"email" json:"email" validate:"omitempty,email,max=100"`
+	Avatar        string `form:"avatar" json:"avatar"`
+	Nickname      string `form:"nickname" json:"nickname" validate:"min=0,max=20"`
+	Introduction  string `form:"introduction" json:"introduction" validate:"min=0,max=255"`
+	Status        uint   `form:"status" json:"status" validate:"oneof=1 2"`
+	RoleIds       []uint `form:"roleIds" json:"roleIds" validate:"required"`
+	DepartmentIds []uint `form:"departmentIds" json:"departmentIds"`
+	DepartmentId  uint   `form:"departmentId" json:"departmentId"`
+	PostIds       []uint `form:"postIds" json:"postIds"`
+	// Custom attribute values by attribute key
+	Attributes map[string]string `form:"-" json:"attributes"`
 }
 
 type UserListRequest struct {
-	Username string `json:"username" form:"username" `
-	Mobile   string `json:"mobile" form:"mobile" `
-	Nickname string `json:"nickname" form:"nickname" `
-	Status   uint   `json:"status" form:"status" `
-	PageNum  uint   `json:"pageNum" form:"pageNum"`
-	PageSize uint   `json:"pageSize" form:"pageSize"`
+	Username           string `json:"username" form:"username" `
+	Mobile             string `json:"mobile" form:"mobile" `
+	Email              string `json:"email" form:"email"`
+	Nickname           string `json:"nickname" form:"nickname" `
+	Status             uint   `json:"status" form:"status" `
+	DepartmentId       uint   `json:"departmentId" form:"departmentId"`
+	WithSubDepartments bool   `json:"withSubDepartments" form:"withSubDepartments"`
+	PostId             uint   `json:"postId" form:"postId"`
+	// Custom attribute filters by attribute key, sent as attributes[key]=value in the query
+	Attributes map[string]string `json:"attributes" form:"-"`
+	PageNum    uint              `json:"pageNum" form:"pageNum"`
+	PageSize   uint              `json:"pageSize" form:"pageSize"`
+}
+
+type ImportUsersRequest struct {
+	DryRun bool `json:"dryRun" form:"dryRun"`
+}
+
+type ExportUsersRequest struct {
+	UserListRequest
+	Format string `json:"format" form:"format" validate:"omitempty,oneof=csv xlsx"`
 }
 
 type DeleteUserRequest struct {
 	UserIds []uint `json:"userIds" form:"userIds"`
 }
 
+type BatchUserStatusRequest struct {
+	UserIds []uint `json:"userIds" form:"userIds" validate:"required,min=1,max=100"`
+	Status  uint   `json:"status" form:"status" validate:"oneof=1 2"`
+}
+
+type BatchUserRolesRequest struct {
+	UserIds       []uint `json:"userIds" form:"userIds" validate:"required,min=1,max=100"`
+	AddRoleIds    []uint `json:"addRoleIds" form:"addRoleIds"`
+	RemoveRoleIds []uint `json:"removeRoleIds" form:"removeRoleIds"`
+}
+
+type BatchResetPwdRequest struct {
+	UserIds []uint `json:"userIds" form:"userIds" validate:"required,min=1,max=100"`
+}
+
+type UpdateProfileRequest struct {
+	Mobile       string `form:"mobile" json:"mobile" validate:"required,checkMobile"`
+	Email        string `form:"email" json:"email" validate:"omitempty,email,max=100"`
+	Nickname     string `form:"nickname" json:"nickname" validate:"min=0,max=20"`
+	Introduction string `form:"introduction" json:"introduction" validate:"min=0,max=255"`
+	Locale       string `form:"locale" json:"locale" validate:"omitempty,checkLocale"`
+}
+
 type ChangePwdRequest struct {
 	OldPassword string `json:"oldPassword" form:"oldPassword" validate:"required"`
 	NewPassword string `json:"newPassword" form:"newPassword" validate:"required"`